@@ -4,10 +4,17 @@ import (
 	"context"
 
 	"github.com/think-free/ABCFitness-challenge/internal/api"
+	"github.com/think-free/ABCFitness-challenge/internal/audit"
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
 	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
 	"github.com/think-free/ABCFitness-challenge/internal/database"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/grpcapi"
 	"github.com/think-free/ABCFitness-challenge/internal/service"
+	"github.com/think-free/ABCFitness-challenge/internal/webhook"
 	"github.com/think-free/ABCFitness-challenge/lib/logging"
+
+	idempotencymemory "github.com/think-free/ABCFitness-challenge/internal/idempotency/memory"
 )
 
 func main() {
@@ -15,10 +22,62 @@ func main() {
 	cp := cliparams.New()
 
 	logging.Init(cp.LogLevel)
+	err := cp.Validate()
+	if err != nil {
+		logging.Logger(ctx).Fatalf("invalid configuration : %v", err)
+	}
+
+	err = logging.ConfigurePII(cp.LogPII, cp.LogPIISalt)
+	if err != nil {
+		logging.Logger(ctx).Fatalf("error configuring pii logging : %v", err)
+	}
+
+	sink, err := audit.New(ctx, cp)
+	if err != nil {
+		logging.Logger(ctx).Fatalf("error initializing audit sink : %v", err)
+	}
 
 	db := database.New(ctx, cp)
-	srv := service.New(ctx, db)
-	ap := api.New(ctx, srv)
+	opts := []service.Option{
+		service.WithAuditSink(sink),
+		service.WithWebhookPolicy(&webhook.RetryPolicy{
+			MaxAttempts: cp.WebhookMaxAttempts,
+			Backoff:     cp.WebhookBackoff,
+			MaxBackoff:  cp.WebhookMaxBackoff,
+		}),
+		service.WithNoShowPolicy(&datamodel.NoShowPolicy{
+			Limit:  cp.NoShowLimit,
+			Window: cp.NoShowWindow,
+			Period: cp.SuspensionPeriod,
+		}),
+	}
+	if cp.WebhookAllowPrivate {
+		opts = append(opts, service.WithPrivateWebhooks())
+	}
+	srv := service.New(ctx, db, opts...)
+
+	au, err := auth.New(&auth.Config{
+		APIKeys:      cp.APIKeys,
+		JWTSecret:    cp.JWTSecret,
+		JWTPublicKey: cp.JWTPublicKey,
+	})
+	if err != nil {
+		logging.Logger(ctx).Fatalf("error initializing authentication : %v", err)
+	}
+
+	ap := api.New(ctx, srv,
+		api.WithAuthenticator(au),
+		api.WithIdempotencyStore(idempotencymemory.New(ctx, cp.IdempotencyTTL)),
+		api.WithMaxBodyBytes(cp.MaxBodyBytes),
+	)
+
+	gs := grpcapi.New(ctx, srv, grpcapi.WithAuthenticator(au))
+
+	go srv.RunNoShowJob(ctx, cp.NoShowInterval)
+	go srv.RunEventRelay(ctx, cp.EventRelayInterval)
+	go srv.RunWebhookDispatcher(ctx, cp.WebhookInterval)
+
+	go gs.Run(cp.GRPCPort)
 
 	ap.Run()
 }
@@ -3,38 +3,140 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
 
+	"github.com/think-free/ABCFitness-challenge/internal/audit"
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
 	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/graphqlapi"
+	"github.com/think-free/ABCFitness-challenge/internal/idempotency"
 	"github.com/think-free/ABCFitness-challenge/internal/service"
 	"github.com/think-free/ABCFitness-challenge/lib/logging"
 
 	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+	idempotencymemory "github.com/think-free/ABCFitness-challenge/internal/idempotency/memory"
+)
+
+const (
+	HeaderRequestID    = "X-Request-ID"
+	maxRequestIDLength = 128
+
+	defaultIdempotencyTTL = 24 * time.Hour
+	defaultMaxBodyBytes   = 1 << 20
 )
 
 type Api struct {
 	srv    *service.Service
 	router *mux.Router
+	auth   *auth.Authenticator
+
+	idempotency  idempotency.Store
+	graphql      *graphqlapi.Schema
+	maxBodyBytes int64
+}
+
+// Option configures optional dependencies of the api
+type Option func(*Api)
+
+// WithAuthenticator requires the requests to be authenticated by the given authenticator
+func WithAuthenticator(au *auth.Authenticator) Option {
+	return func(a *Api) {
+		a.auth = au
+	}
 }
 
-func New(ctx context.Context, srv *service.Service) *Api {
+// WithIdempotencyStore replaces the default memory store of the responses replayed for the idempotency keys
+func WithIdempotencyStore(store idempotency.Store) Option {
+	return func(a *Api) {
+		a.idempotency = store
+	}
+}
+
+// WithMaxBodyBytes limits the size of the json and import bodies of the requests, the larger ones are rejected with 413
+func WithMaxBodyBytes(n int64) Option {
+	return func(a *Api) {
+		a.maxBodyBytes = n
+	}
+}
+
+func New(ctx context.Context, srv *service.Service, opts ...Option) *Api {
 	api := &Api{
-		srv:    srv,
-		router: mux.NewRouter(),
+		srv:          srv,
+		router:       mux.NewRouter(),
+		idempotency:  idempotencymemory.New(ctx, defaultIdempotencyTTL),
+		graphql:      graphqlapi.New(srv),
+		maxBodyBytes: defaultMaxBodyBytes,
 	}
 
-	api.router.HandleFunc("/users", api.CreateUser).Methods("POST")
+	for _, opt := range opts {
+		opt(api)
+	}
+
+	api.router.HandleFunc("/users", api.idempotent(api.CreateUser)).Methods("POST")
 	api.router.HandleFunc("/users", api.ListUsers).Methods("GET")
-	api.router.HandleFunc("/classes", api.CreateClass).Methods("POST")
+	api.router.HandleFunc("/users:import", api.ImportUsers).Methods("POST")
+	api.router.HandleFunc("/users/{id}/credits", api.GetCredits).Methods("GET")
+	api.router.HandleFunc("/users/{id}/membership", api.SetMembership).Methods("PUT")
+	api.router.HandleFunc("/users/{id}/attendance", api.GetAttendance).Methods("GET")
+	api.router.HandleFunc("/users/{id}/suspensions", api.ListUserSuspensions).Methods("GET")
+	api.router.HandleFunc("/users/{id}/export", api.ExportUser).Methods("GET")
+	api.router.HandleFunc("/users/{id}/calendar.ics", api.GetUserCalendar).Methods("GET")
+	api.router.HandleFunc("/users/{id}", api.GetUser).Methods("GET")
+	api.router.HandleFunc("/users/{id}", api.UpdateUser).Methods("PATCH")
+	api.router.HandleFunc("/users/{id}", api.EraseUser).Methods("DELETE")
+	api.router.HandleFunc("/classes", api.idempotent(api.CreateClass)).Methods("POST")
 	api.router.HandleFunc("/classes", api.ListClasses).Methods("GET")
-	api.router.HandleFunc("/bookings", api.CreateBooking).Methods("POST")
+	api.router.HandleFunc("/classes:import", api.ImportClasses).Methods("POST")
+	api.router.HandleFunc("/classes/{id}", api.GetClass).Methods("GET")
+	api.router.HandleFunc("/classes/{id}", api.UpdateClass).Methods("PATCH")
+	api.router.HandleFunc("/classes/{id}/attendees", api.ListAttendees).Methods("GET")
+	api.router.HandleFunc("/classes/{id}/calendar.ics", api.GetClassCalendar).Methods("GET")
+	api.router.HandleFunc("/classes/{id}/availability", api.GetAvailability).Methods("GET")
+	api.router.HandleFunc("/classes/{id}/availability/stream", api.StreamAvailability).Methods("GET")
+	api.router.HandleFunc("/studios/{studio}/rules", api.SetStudioRules).Methods("PUT")
+	api.router.HandleFunc("/studios/{studio}/rules", api.GetStudioRules).Methods("GET")
+	api.router.HandleFunc("/bookings", api.idempotent(api.CreateBooking)).Methods("POST")
 	api.router.HandleFunc("/bookings", api.ListBookings).Methods("GET")
+	api.router.HandleFunc("/bookings:batch", api.idempotent(api.CreateBookings)).Methods("POST")
+	api.router.HandleFunc("/bookings/{id}", api.GetBookingByID).Methods("GET")
+	api.router.HandleFunc("/bookings/{id}", api.CancelBooking).Methods("DELETE")
+	api.router.HandleFunc("/bookings/{id}/checkin", api.CheckIn).Methods("POST")
 	api.router.HandleFunc("/booking", api.GetBooking).Methods("GET")
+	api.router.HandleFunc("/suspensions", api.ListSuspensions).Methods("GET")
+	api.router.HandleFunc("/suspensions/{id}", api.LiftSuspension).Methods("DELETE")
+	api.router.HandleFunc("/me", api.GetMe).Methods("GET")
+	api.router.HandleFunc("/me/bookings", api.ListMyBookings).Methods("GET")
+	api.router.HandleFunc("/me/calendar.ics", api.GetMyCalendar).Methods("GET")
+	api.router.HandleFunc("/me/bookings", api.idempotent(api.CreateMyBooking)).Methods("POST")
+	api.router.HandleFunc("/me/bookings/{id}", api.CancelMyBooking).Methods("DELETE")
+	api.router.HandleFunc("/audit", api.ListAudit).Methods("GET")
+	api.router.HandleFunc("/webhooks", api.idempotent(api.CreateWebhook)).Methods("POST")
+	api.router.HandleFunc("/webhooks", api.ListWebhooks).Methods("GET")
+	api.router.HandleFunc("/webhooks/dead-letters", api.ListDeadLetters).Methods("GET")
+	api.router.HandleFunc("/webhooks/dead-letters/{id}/retry", api.RetryDeadLetter).Methods("POST")
+	api.router.HandleFunc("/webhooks/{id}", api.GetWebhook).Methods("GET")
+	api.router.HandleFunc("/webhooks/{id}", api.UpdateWebhook).Methods("PATCH")
+	api.router.HandleFunc("/webhooks/{id}", api.DeleteWebhook).Methods("DELETE")
+	api.router.HandleFunc("/webhooks/{id}/deliveries", api.ListWebhookDeliveries).Methods("GET")
+	api.router.HandleFunc("/graphql", api.GraphQL).Methods("POST")
+	api.router.HandleFunc(openAPIPath, api.OpenAPI).Methods("GET")
+
+	api.router.Use(api.requestID)
+	api.router.Use(api.preconditions)
+	api.router.Use(api.negotiate)
+
+	if api.auth.Enabled() {
+		api.router.Use(api.authenticate)
+	} else {
+		logging.Logger(ctx).Warn("authentication disabled, all the routes are public")
+	}
 
 	return api
 }
@@ -44,6 +146,11 @@ func (a *Api) Run() {
 	log.Fatal(http.ListenAndServe(":8080", a.router))
 }
 
+// ServeHTTP dispatches the request to the router of the api
+func (a *Api) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.router.ServeHTTP(w, r)
+}
+
 // CreateUser accept a CreateUserRequest as json in the body and returns a User as json in the data field
 func (a *Api) CreateUser(w http.ResponseWriter, r *http.Request) {
 	ctx := logging.ContextWithLogger(r.Context())
@@ -61,10 +168,51 @@ func (a *Api) CreateUser(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.setETag(w, resp.Version)
+
 	w.WriteHeader(http.StatusCreated)
 	a.writeResponse(ctx, w, NewResponse(ctx, resp))
 }
 
+// GetUser returns the User with the id of the path as json in the data field, it honors If-None-Match
+func (a *Api) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.GetUser(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	if a.notModified(w, r, resp.Version) {
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// UpdateUser accept an UpdateUserRequest as json in the body and returns the updated User as json in the data field, it honors If-Match
+func (a *Api) UpdateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var req datamodel.UpdateUserRequest
+	err := a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	resp, err := a.srv.UpdateUser(ctx, mux.Vars(r)["id"], &req)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
 // ListUsers returns a list of Users as json in the data field, it accepts offset and count as query params
 func (a *Api) ListUsers(w http.ResponseWriter, r *http.Request) {
 	ctx := logging.ContextWithLogger(r.Context())
@@ -81,6 +229,102 @@ func (a *Api) ListUsers(w http.ResponseWriter, r *http.Request) {
 	a.writeResponse(ctx, w, NewResponse(ctx, resp))
 }
 
+// GetCredits returns the remaining Credits of the user as json in the data field, it accepts a date as query param to select the month
+func (a *Api) GetCredits(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	date := time.Now()
+	if d := r.URL.Query().Get("date"); d != "" {
+		var err error
+		date, err = time.Parse(time.RFC3339, d)
+		if err != nil {
+			http.Error(w, NewErrorResponse(ctx, err).String(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	resp, err := a.srv.GetCredits(ctx, mux.Vars(r)["id"], date)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// SetMembership accept a Membership as json in the body and returns the updated User as json in the data field
+func (a *Api) SetMembership(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var req datamodel.Membership
+	err := a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	resp, err := a.srv.SetMembership(ctx, mux.Vars(r)["id"], &req)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// GetAttendance returns the Attendance of the user of the path as json in the data field
+func (a *Api) GetAttendance(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.GetAttendance(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// ExportUser returns the UserExport of the user of the path as a json file to download
+func (a *Api) ExportUser(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.ExportUser(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="user-%s.json"`, resp.User.ID))
+
+	err = json.NewEncoder(w).Encode(resp)
+	if err != nil {
+		logging.Logger(ctx).Errorf("error encoding export : %v", err)
+	}
+}
+
+// EraseUser anonymizes the user of the path and returns it as json in the data field
+func (a *Api) EraseUser(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.EraseUser(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
 // CreateClass accept a CreateClassRequest as json in the body and returns a Class as json in the data field
 func (a *Api) CreateClass(w http.ResponseWriter, r *http.Request) {
 	ctx := logging.ContextWithLogger(r.Context())
@@ -98,6 +342,8 @@ func (a *Api) CreateClass(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.setETag(w, resp.Version)
+
 	w.WriteHeader(http.StatusCreated)
 	a.writeResponse(ctx, w, NewResponse(ctx, resp))
 }
@@ -118,6 +364,79 @@ func (a *Api) ListClasses(w http.ResponseWriter, r *http.Request) {
 	a.writeResponse(ctx, w, NewResponse(ctx, resp))
 }
 
+// GetClass returns the Class with the id of the path as json in the data field, it honors If-None-Match
+func (a *Api) GetClass(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.GetClass(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	if a.notModified(w, r, resp.Version) {
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// UpdateClass accept an UpdateClassRequest as json in the body and returns the updated Class as json in the data field, it honors If-Match
+func (a *Api) UpdateClass(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var req datamodel.UpdateClassRequest
+	err := a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	resp, err := a.srv.UpdateClass(ctx, mux.Vars(r)["id"], &req)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// SetStudioRules accept BookingRules as json in the body and returns the StudioRules of the studio of the path as json in the data field
+func (a *Api) SetStudioRules(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var req datamodel.BookingRules
+	err := a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	resp, err := a.srv.SetStudioRules(ctx, mux.Vars(r)["studio"], &req)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// GetStudioRules returns the StudioRules of the studio of the path as json in the data field
+func (a *Api) GetStudioRules(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.GetStudioRules(ctx, mux.Vars(r)["studio"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
 // CreateBooking accept a CreateBookingRequest as json in the body and returns a Booking as json in the data field
 func (a *Api) CreateBooking(w http.ResponseWriter, r *http.Request) {
 	ctx := logging.ContextWithLogger(r.Context())
@@ -135,10 +454,42 @@ func (a *Api) CreateBooking(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	a.setETag(w, resp.Version)
+
 	w.WriteHeader(http.StatusCreated)
 	a.writeResponse(ctx, w, NewResponse(ctx, resp))
 }
 
+// CreateBookings accept a CreateBatchBookingRequest as json in the body and returns a BatchBookingResponse as json in
+// the data field, the status is 201 if all the bookings were created, 422 if an atomic batch was rolled back and 207 if
+// a best effort batch created only some of them
+func (a *Api) CreateBookings(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var req datamodel.CreateBatchBookingRequest
+	err := a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	resp, err := a.srv.CreateBookings(ctx, &req)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	switch {
+	case resp.Created == len(resp.Results):
+		w.WriteHeader(http.StatusCreated)
+	case resp.Mode == datamodel.BatchModeAtomic:
+		w.WriteHeader(http.StatusUnprocessableEntity)
+	default:
+		w.WriteHeader(http.StatusMultiStatus)
+	}
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
 // ListBookings returns a list of Bookings as json in the data field, it accepts offset and count as query params
 func (a *Api) ListBookings(w http.ResponseWriter, r *http.Request) {
 	ctx := logging.ContextWithLogger(r.Context())
@@ -171,6 +522,165 @@ func (a *Api) GetBooking(w http.ResponseWriter, r *http.Request) {
 	a.writeResponse(ctx, w, NewResponse(ctx, resp))
 }
 
+// GetBookingByID returns the Booking with the id of the path as json in the data field, it honors If-None-Match
+func (a *Api) GetBookingByID(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.GetBooking(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	if a.notModified(w, r, resp.Version) {
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, &resp.Booking))
+}
+
+// CancelBooking cancels the Booking with the id of the path, refunds its credit and returns it as json in the data field
+func (a *Api) CancelBooking(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.CancelBooking(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// CheckIn marks the Booking with the id of the path as attended and returns it as json in the data field
+func (a *Api) CheckIn(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.CheckIn(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// ListSuspensions returns a list of Suspensions as json in the data field, it accepts offset, count and active as query params
+func (a *Api) ListSuspensions(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	req := a.getListRequestParams(ctx, r)
+	active, _ := strconv.ParseBool(r.URL.Query().Get("active"))
+
+	resp, err := a.srv.ListSuspensions(ctx, req, active)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// ListUserSuspensions returns the Suspensions of the user of the path as json in the data field
+func (a *Api) ListUserSuspensions(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.ListUserSuspensions(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// LiftSuspension lifts the Suspension with the id of the path and returns it as json in the data field
+func (a *Api) LiftSuspension(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.LiftSuspension(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// ListAudit returns the audit entries as json in the data field, it accepts actor, action, entity, entity_id, offset and count as query params
+func (a *Api) ListAudit(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	q := r.URL.Query()
+	list := a.getListRequestParams(ctx, r)
+
+	resp, err := a.srv.ListAudit(ctx, &datamodel.AuditFilter{
+		Actor:    q.Get("actor"),
+		Action:   q.Get("action"),
+		Entity:   q.Get("entity"),
+		EntityID: q.Get("entity_id"),
+		Offset:   list.Offset,
+		Count:    list.Count,
+	})
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// requestID stores a new id of the request in its context and returns it in the X-Request-ID header, the id sent by
+// the client is stored apart so the calls can be correlated across services without trusting it
+func (a *Api) requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := uuid.NewString()
+		ctx := audit.ContextWithRequestID(r.Context(), id)
+
+		clientID := r.Header.Get(HeaderRequestID)
+		if clientID != "" && len(clientID) <= maxRequestIDLength {
+			ctx = audit.ContextWithClientRequestID(ctx, clientID)
+		}
+
+		w.Header().Set(HeaderRequestID, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticate rejects the requests without valid credentials and stores the principal of the others in their context,
+// the specification of the api is public
+func (a *Api) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := logging.ContextWithLogger(r.Context())
+
+		if r.URL.Path == openAPIPath {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		p, err := a.auth.Authenticate(r)
+		if err != nil {
+			logging.Logger(ctx).Warnf("authentication failed for '%s %s' : %v", r.Method, r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="abcfitness"`)
+			http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.ContextWithPrincipal(r.Context(), p)))
+	})
+}
+
 // tagRequest adds tags information about the query to the logger
 func (a *Api) tagRequest(ctx context.Context, r *http.Request) context.Context {
 	ctx = logging.ContextWithLogger(ctx)
@@ -179,38 +689,45 @@ func (a *Api) tagRequest(ctx context.Context, r *http.Request) context.Context {
 	log.SetTag("api.remote", r.Host)
 	log.SetTag("api.method", r.Method)
 	log.SetTag("api.url", r.URL.String())
-	log.SetTag("api.api_uuid", uuid.NewString())
+	log.SetTag("api.api_uuid", audit.RequestIDFromContext(ctx))
+
+	if p := auth.PrincipalFromContext(ctx); p != nil {
+		log.SetTag("api.principal.id", p.ID)
+		log.SetTag("api.principal.role", p.Role)
+		log.SetTag("api.principal.method", p.Method)
+	}
 
 	return ctx
 }
 
 // getHttpStatusForError returns the http status code for the given internal error
 func (a *Api) getHttpStatusForError(ctx context.Context, err error) int {
-	switch {
-	case ierrors.IsAlreadyExists(err):
-		return http.StatusConflict
-	case ierrors.IsValidationError(err):
+	switch ierrors.KindOf(err) {
+	case ierrors.KindValidation:
 		return http.StatusBadRequest
+	case ierrors.KindNotFound:
+		return http.StatusNotFound
+	case ierrors.KindAlreadyExists, ierrors.KindConflict, ierrors.KindInvalidState, ierrors.KindClassFull:
+		return http.StatusConflict
+	case ierrors.KindUnauthorized:
+		return http.StatusUnauthorized
+	case ierrors.KindForbidden:
+		return http.StatusForbidden
+	case ierrors.KindNoCredits:
+		return http.StatusPaymentRequired
+	case ierrors.KindPreconditionFailed:
+		return http.StatusPreconditionFailed
+	case ierrors.KindUnsupportedMediaType:
+		return http.StatusUnsupportedMediaType
+	case ierrors.KindRequestTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case ierrors.KindRejected:
+		return http.StatusUnprocessableEntity
 	default:
 		return http.StatusInternalServerError
-
 	}
 }
 
-// decodeRequest decodes the json body of the request into the given interface, used for POST requests
-func (a *Api) decodeRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, v interface{}) error {
-	log := logging.Logger(ctx)
-
-	err := json.NewDecoder(r.Body).Decode(v)
-	if err != nil {
-		log.Errorf("error decoding request : %v", err)
-		http.Error(w, NewErrorResponse(ctx, err).String(), http.StatusBadRequest)
-		return err
-	}
-
-	return nil
-}
-
 // getListRequestParams returns the offset and count query params of the request, used for GET requests
 func (a *Api) getListRequestParams(ctx context.Context, r *http.Request) *datamodel.ListRequest {
 	log := logging.Logger(ctx)
@@ -235,10 +752,21 @@ func (a *Api) getListRequestParams(ctx context.Context, r *http.Request) *datamo
 	}
 }
 
-// writeResponse encodes the given interface into the response body, used for all requests, return an error if encoding fails
+// writeResponse encodes the given interface into the response body, used for all requests, return an error if encoding fails.
+// The lists are encoded as csv when the request accepts it, the other data always as json
 func (a *Api) writeResponse(ctx context.Context, w http.ResponseWriter, v *Response) {
 	log := logging.Logger(ctx)
 
+	if mediaTypeFromContext(ctx) == MediaTypeCSV {
+		written, err := writeCSV(w, v.value)
+		if err != nil {
+			log.Errorf("error encoding csv response : %v", err)
+		}
+		if written {
+			return
+		}
+	}
+
 	err := json.NewEncoder(w).Encode(v)
 	if err != nil {
 		log.Errorf("error encoding response : %v", err)
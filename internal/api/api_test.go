@@ -1,21 +1,30 @@
 package api_test
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/think-free/ABCFitness-challenge/internal/api"
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
 	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
 	"github.com/think-free/ABCFitness-challenge/internal/database"
 	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
 	"github.com/think-free/ABCFitness-challenge/internal/service"
+	"github.com/think-free/ABCFitness-challenge/internal/webhook"
 )
 
 type Message struct {
@@ -127,12 +136,1202 @@ func Test(t *testing.T) {
 	assert.Nil(t, b)
 }
 
+func TestRoomConflict(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+	api := api.New(context.Background(), srv)
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC)
+	class := &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Name:          "Yoga",
+			Studio:        "Studio 1",
+			Room:          "Room 1",
+			StartDate:     &startDate,
+			EndDate:       &endDate,
+			Duration:      60,
+			DailyCapacity: 10,
+		},
+	}
+
+	c := createClass(t, api, class, false)
+	assert.Equal(t, class.Room, c.Room)
+
+	// Another class in the same room starting during the yoga session is rejected with the clashing class
+	overlapStart := startDate.AddDate(0, 0, 5).Add(30 * time.Minute)
+	overlap := &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Name:          "Pilates",
+			Studio:        "Studio 1",
+			Room:          "Room 1",
+			StartDate:     &overlapStart,
+			EndDate:       &endDate,
+			DailyCapacity: 10,
+		},
+	}
+
+	body, err := json.Marshal(overlap)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/classes", bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	http.HandlerFunc(api.CreateClass).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Contains(t, rr.Body.String(), c.ID)
+
+	// The same class in another room is accepted
+	overlap.Room = "Room 2"
+	createClass(t, api, overlap, false)
+}
+
+func TestMembership(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+	api := api.New(context.Background(), srv)
+
+	u := createUser(t, api, &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{
+			Name:    "John",
+			Surname: "Doe",
+			Email:   "john.doe@example.com",
+			Phone:   "+34123456789",
+		},
+	}, false)
+
+	// The users are created with the unlimited plan, the clients can't choose their membership
+	assert.Equal(t, datamodel.PlanUnlimited, getCredits(t, api, u.ID).Plan)
+	rr := sendBody(t, api, "POST", "/users", "application/json", `{"name":"Jane","surname":"Doe","email":"jane.doe@example.com","phone":"+34123456789","membership":{"plan":"pack","credits":1000}}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	setMembership(t, api, u.ID, &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 1})
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC)
+	c := createClass(t, api, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Name:          "Yoga",
+			Studio:        "Studio 1",
+			StartDate:     &startDate,
+			EndDate:       &endDate,
+			DailyCapacity: 10,
+		},
+	}, false)
+
+	credits := getCredits(t, api, u.ID)
+	assert.Equal(t, datamodel.PlanPack, credits.Plan)
+	assert.Equal(t, 1, credits.Remaining)
+
+	// The only credit of the pack is consumed by the first booking
+	booking := &datamodel.CreateBookingRequest{
+		BaseBooking: datamodel.BaseBooking{
+			UserID:  u.ID,
+			ClassID: c.ID,
+			Date:    time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	b := createBooking(t, api, booking, false)
+	assert.Equal(t, 0, getCredits(t, api, u.ID).Remaining)
+
+	other := *booking
+	other.Date = other.Date.AddDate(0, 0, 1)
+	createBooking(t, api, &other, true)
+
+	// Cancelling the booking refunds the credit
+	req, err := http.NewRequest("DELETE", "/bookings/"+b.ID, nil)
+	assert.NoError(t, err)
+
+	rr = httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, 1, getCredits(t, api, u.ID).Remaining)
+
+	b = createBooking(t, api, &other, false)
+
+	// The credit consumed from a previous plan isn't refunded to the new one
+	setMembership(t, api, u.ID, &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 10})
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/bookings/"+b.ID).Code)
+	assert.Equal(t, 10, getCredits(t, api, u.ID).Remaining)
+
+	// Neither is a booking made with the unlimited plan, that consumed nothing
+	setMembership(t, api, u.ID, &datamodel.Membership{Plan: datamodel.PlanUnlimited})
+	other.Date = other.Date.AddDate(0, 0, 1)
+	b = createBooking(t, api, &other, false)
+	setMembership(t, api, u.ID, &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 10})
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/bookings/"+b.ID).Code)
+	assert.Equal(t, 10, getCredits(t, api, u.ID).Remaining)
+}
+
+func TestBookingRules(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+	api := api.New(context.Background(), srv)
+
+	u := createUser(t, api, &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{
+			Name:    "John",
+			Surname: "Doe",
+			Email:   "john.doe@example.com",
+			Phone:   "+34123456789",
+		},
+	}, false)
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	c := createClass(t, api, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Name:          "Yoga",
+			Studio:        "Studio 1",
+			StartDate:     &startDate,
+			EndDate:       &endDate,
+			DailyCapacity: 10,
+			Rules:         &datamodel.BookingRules{MaxOpenBookings: 1},
+		},
+	}, false)
+
+	// The studio rules are applied to its classes
+	body, err := json.Marshal(&datamodel.BookingRules{MaxAdvanceDays: 14})
+	assert.NoError(t, err)
+	req, err := http.NewRequest("PUT", "/studios/Studio 1/rules", bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	booking := &datamodel.CreateBookingRequest{
+		BaseBooking: datamodel.BaseBooking{
+			UserID:  u.ID,
+			ClassID: c.ID,
+			Date:    time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	rr = postBooking(t, api, booking)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "advance_window")
+
+	// The class rules are applied with the studio ones
+	booking.Date = time.Date(2023, 10, 11, 0, 0, 0, 0, time.UTC)
+	createBooking(t, api, booking, false)
+
+	booking.Date = time.Date(2023, 10, 12, 0, 0, 0, 0, time.UTC)
+	rr = postBooking(t, api, booking)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "max_open_bookings")
+
+	// A class can disable a rule of its studio
+	open := createClass(t, api, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Name:          "Pilates",
+			Studio:        "Studio 1",
+			StartDate:     &startDate,
+			EndDate:       &endDate,
+			DailyCapacity: 10,
+			Rules:         &datamodel.BookingRules{MaxAdvanceDays: datamodel.RuleDisabled},
+		},
+	}, false)
+
+	booking.ClassID = open.ID
+	booking.Date = time.Date(2023, 10, 30, 0, 0, 0, 0, time.UTC)
+	createBooking(t, api, booking, false)
+}
+
+func TestCancelBooking(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+	api := api.New(context.Background(), srv)
+
+	u := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	setMembership(t, api, u.ID, &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 10})
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	c := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, Duration: 60, DailyCapacity: 10}}, false)
+
+	day := func(d int) time.Time { return time.Date(2023, 10, d, 0, 0, 0, 0, time.UTC) }
+	ended := createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u.ID, ClassID: c.ID, Date: day(11)}}, false)
+	started := createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u.ID, ClassID: c.ID, Date: day(12)}}, false)
+	cutOff := createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u.ID, ClassID: c.ID, Date: day(13)}}, false)
+	assert.Equal(t, 7, getCredits(t, api, u.ID).Remaining)
+
+	// A session that ended or started can't be cancelled anymore, and its credit is kept
+	now = time.Date(2023, 10, 11, 20, 0, 0, 0, time.UTC)
+	assert.Equal(t, http.StatusConflict, do(t, api, "DELETE", "/bookings/"+ended.ID).Code)
+	now = time.Date(2023, 10, 12, 18, 30, 0, 0, time.UTC)
+	assert.Equal(t, http.StatusConflict, do(t, api, "DELETE", "/bookings/"+started.ID).Code)
+	assert.Equal(t, 7, getCredits(t, api, u.ID).Remaining)
+
+	// The cut-off of the rules closes the cancellations with the bookings
+	rr := sendWithHeader(t, api, "PUT", "/studios/Studio 1/rules", "", "", &datamodel.BookingRules{CutOffMinutes: 60})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	now = time.Date(2023, 10, 13, 17, 30, 0, 0, time.UTC)
+	assert.Equal(t, http.StatusConflict, do(t, api, "DELETE", "/bookings/"+cutOff.ID).Code)
+	now = time.Date(2023, 10, 13, 16, 30, 0, 0, time.UTC)
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/bookings/"+cutOff.ID).Code)
+	assert.Equal(t, 8, getCredits(t, api, u.ID).Remaining)
+}
+
+func TestAttendance(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+	api := api.New(context.Background(), srv)
+
+	u := createUser(t, api, &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{
+			Name:    "John",
+			Surname: "Doe",
+			Email:   "john.doe@example.com",
+			Phone:   "+34123456789",
+		},
+	}, false)
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	c := createClass(t, api, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Name:          "Yoga",
+			Studio:        "Studio 1",
+			StartDate:     &startDate,
+			EndDate:       &endDate,
+			DailyCapacity: 10,
+		},
+	}, false)
+
+	newBooking := func(day int) *datamodel.Booking {
+		return createBooking(t, api, &datamodel.CreateBookingRequest{
+			BaseBooking: datamodel.BaseBooking{
+				UserID:  u.ID,
+				ClassID: c.ID,
+				Date:    time.Date(2023, 10, day, 0, 0, 0, 0, time.UTC),
+			},
+		}, false)
+	}
+
+	attended := newBooking(10)
+	missed := newBooking(11)
+	cancelled := newBooking(12)
+	assert.Equal(t, datamodel.BookingStatusBooked, attended.Status)
+
+	// The check-in is not open yet
+	assert.Equal(t, http.StatusConflict, do(t, api, "POST", "/bookings/"+attended.ID+"/checkin").Code)
+
+	now = time.Date(2023, 10, 10, 17, 50, 0, 0, time.UTC)
+	assert.Equal(t, http.StatusOK, do(t, api, "POST", "/bookings/"+attended.ID+"/checkin").Code)
+	assert.Equal(t, http.StatusConflict, do(t, api, "POST", "/bookings/"+attended.ID+"/checkin").Code)
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/bookings/"+cancelled.ID).Code)
+
+	// Once the session of the 11th ended, the no-show job marks the missed booking
+	now = time.Date(2023, 10, 11, 20, 0, 0, 0, time.UTC)
+	marked, err := srv.MarkNoShows(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, marked, 1)
+	assert.Equal(t, missed.ID, marked[0].ID)
+
+	rr := do(t, api, "GET", "/users/"+u.ID+"/attendance")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var attendance datamodel.Attendance
+	assert.NoError(t, DecodeBody(rr.Body, &attendance))
+	assert.Equal(t, 1, attendance.CheckedIn)
+	assert.Equal(t, 1, attendance.NoShows)
+	assert.Equal(t, 1, attendance.Cancelled)
+	assert.Equal(t, 0, attendance.Booked)
+	assert.Len(t, attendance.Bookings, 3)
+	assert.Equal(t, attended.ID, attendance.Bookings[0].ID)
+}
+
+func TestNoShowSuspension(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db,
+		service.WithClock(func() time.Time { return now }),
+		service.WithNoShowPolicy(&datamodel.NoShowPolicy{Limit: 2, Window: 30 * 24 * time.Hour, Period: 7 * 24 * time.Hour}),
+	)
+	api := api.New(context.Background(), srv)
+
+	u := createUser(t, api, &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{
+			Name:    "John",
+			Surname: "Doe",
+			Email:   "john.doe@example.com",
+			Phone:   "+34123456789",
+		},
+	}, false)
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	c := createClass(t, api, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Name:          "Yoga",
+			Studio:        "Studio 1",
+			StartDate:     &startDate,
+			EndDate:       &endDate,
+			DailyCapacity: 10,
+		},
+	}, false)
+
+	booking := func(day int) *datamodel.CreateBookingRequest {
+		return &datamodel.CreateBookingRequest{
+			BaseBooking: datamodel.BaseBooking{
+				UserID:  u.ID,
+				ClassID: c.ID,
+				Date:    time.Date(2023, 10, day, 0, 0, 0, 0, time.UTC),
+			},
+		}
+	}
+
+	createBooking(t, api, booking(10), false)
+	createBooking(t, api, booking(11), false)
+
+	// Missing both sessions suspends the user
+	now = time.Date(2023, 10, 12, 12, 0, 0, 0, time.UTC)
+	_, err := srv.MarkNoShows(ctx)
+	assert.NoError(t, err)
+
+	rr := postBooking(t, api, booking(20))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Contains(t, rr.Body.String(), "suspended")
+
+	rr = do(t, api, "GET", "/suspensions?active=true")
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var suspensions []*datamodel.Suspension
+	assert.NoError(t, DecodeBody(rr.Body, &suspensions))
+	assert.Len(t, suspensions, 1)
+	assert.Equal(t, u.ID, suspensions[0].UserID)
+
+	// Once lifted by the staff, the user can book again
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/suspensions/"+suspensions[0].ID).Code)
+	assert.Equal(t, http.StatusConflict, do(t, api, "DELETE", "/suspensions/"+suspensions[0].ID).Code)
+	createBooking(t, api, booking(20), false)
+
+	rr = do(t, api, "GET", "/users/"+u.ID+"/suspensions")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &suspensions))
+	assert.Len(t, suspensions, 1)
+	assert.NotNil(t, suspensions[0].LiftedAt)
+}
+
+func TestAuthentication(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+
+	au, err := auth.New(&auth.Config{APIKeys: "kiosk-key:kiosk-1:staff", JWTSecret: "secret"})
+	assert.NoError(t, err)
+	api := api.New(context.Background(), srv, api.WithAuthenticator(au))
+
+	// Anonymous requests are rejected
+	rr := do(t, api, "GET", "/users")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.NotEmpty(t, rr.Header().Get("WWW-Authenticate"))
+
+	req, err := http.NewRequest("GET", "/users", nil)
+	assert.NoError(t, err)
+	req.Header.Set(auth.HeaderAPIKey, "kiosk-key")
+	rr = httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	token, err := auth.SignHS256(&auth.Claims{Subject: "user-id", Role: "admin", ExpiresAt: time.Now().Add(time.Hour).Unix()}, []byte("secret"))
+	assert.NoError(t, err)
+	req, err = http.NewRequest("GET", "/users", nil)
+	assert.NoError(t, err)
+	req.Header.Set(auth.HeaderAuthorization, "Bearer "+token)
+	rr = httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+}
+
+func TestAuthorization(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+
+	au, err := auth.New(&auth.Config{JWTSecret: "secret"})
+	assert.NoError(t, err)
+	api := api.New(context.Background(), srv, api.WithAuthenticator(au))
+
+	token := func(sub, role, studio string) string {
+		return signToken(t, sub, role, studio)
+	}
+	send := func(tk, method, url string, v interface{}) *httptest.ResponseRecorder {
+		return sendAs(t, api, tk, method, url, v)
+	}
+
+	admin := token("admin", "admin", "")
+	staff := token("staff", "staff", "Studio 1")
+
+	var u1, u2 datamodel.User
+	rr := send(admin, "POST", "/users", &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &u1))
+	rr = send(staff, "POST", "/users", &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", Phone: "+34123456780"}})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &u2))
+	member := token(u1.ID, "member", "")
+
+	// The staff can only manage the classes of its studio
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 2", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}}
+	assert.Equal(t, http.StatusForbidden, send(staff, "POST", "/classes", class).Code)
+	assert.Equal(t, http.StatusForbidden, send(member, "POST", "/classes", class).Code)
+
+	var c datamodel.Class
+	class.Studio = "Studio 1"
+	rr = send(staff, "POST", "/classes", class)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &c))
+
+	// A member can only book for itself and can't list the users
+	booking := func(userID string) *datamodel.CreateBookingRequest {
+		return &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: userID, ClassID: c.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}}
+	}
+	assert.Equal(t, http.StatusForbidden, send(member, "POST", "/bookings", booking(u2.ID)).Code)
+	assert.Equal(t, http.StatusCreated, send(member, "POST", "/bookings", booking(u1.ID)).Code)
+	assert.Equal(t, http.StatusCreated, send(staff, "POST", "/bookings", booking(u2.ID)).Code)
+	assert.Equal(t, http.StatusForbidden, send(member, "GET", "/users", nil).Code)
+	assert.Equal(t, http.StatusOK, send(member, "GET", "/users/"+u1.ID+"/credits", nil).Code)
+
+	// The users that can't be read are not found like the unknown ids, the others answer forbidden
+	assert.Equal(t, http.StatusNotFound, send(member, "GET", "/users/"+u2.ID+"/credits", nil).Code)
+	assert.Equal(t, http.StatusNotFound, send(member, "GET", "/users/unknown/credits", nil).Code)
+	assert.Equal(t, http.StatusForbidden, send(member, "PUT", "/users/"+u1.ID+"/membership", &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 10}).Code)
+
+	// The staff only manage the members of their studio, the users they create belong to it
+	assert.Equal(t, "Studio 1", u2.Studio)
+	assert.Empty(t, u1.Studio)
+	assert.Equal(t, http.StatusOK, send(staff, "GET", "/users/"+u2.ID, nil).Code)
+	assert.Equal(t, http.StatusNotFound, send(staff, "GET", "/users/"+u1.ID, nil).Code)
+	assert.Equal(t, http.StatusOK, send(staff, "PUT", "/users/"+u2.ID+"/membership", &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 10}).Code)
+	assert.Equal(t, http.StatusNotFound, send(staff, "PUT", "/users/"+u1.ID+"/membership", &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 10}).Code)
+	assert.Equal(t, http.StatusForbidden, send(staff, "POST", "/users", &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "Jim", Surname: "Doe", Email: "jim.doe@example.com", Phone: "+34123456781"}, Studio: "Studio 2"}).Code)
+
+	var users []*datamodel.User
+	rr = send(staff, "GET", "/users", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &users))
+	assert.Len(t, users, 1)
+	assert.Equal(t, u2.ID, users[0].ID)
+
+	// The bookings of the other members are filtered out of the list
+	var bookings []*datamodel.Booking
+	rr = send(member, "GET", "/bookings", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &bookings))
+	assert.Len(t, bookings, 1)
+	assert.Equal(t, u1.ID, bookings[0].UserID)
+
+	rr = send(staff, "GET", "/bookings", nil)
+	assert.NoError(t, DecodeBody(rr.Body, &bookings))
+	assert.Len(t, bookings, 2)
+
+	// The bookings of the other members are not found like the unknown ids
+	other := bookings[0].ID
+	if bookings[0].UserID == u1.ID {
+		other = bookings[1].ID
+	}
+	assert.Equal(t, http.StatusNotFound, send(member, "GET", "/booking?id="+other, nil).Code)
+	assert.Equal(t, http.StatusNotFound, send(member, "GET", "/booking?id=unknown", nil).Code)
+}
+
+func TestMe(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+
+	au, err := auth.New(&auth.Config{JWTSecret: "secret"})
+	assert.NoError(t, err)
+	api := api.New(context.Background(), srv, api.WithAuthenticator(au))
+
+	admin := signToken(t, "admin", "admin", "")
+
+	var u1, u2 datamodel.User
+	rr := sendAs(t, api, admin, "POST", "/users", &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}})
+	assert.NoError(t, DecodeBody(rr.Body, &u1))
+	rr = sendAs(t, api, admin, "POST", "/users", &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", Phone: "+34123456780"}})
+	assert.NoError(t, DecodeBody(rr.Body, &u2))
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	var c datamodel.Class
+	rr = sendAs(t, api, admin, "POST", "/classes", &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}})
+	assert.NoError(t, DecodeBody(rr.Body, &c))
+
+	var other datamodel.Booking
+	rr = sendAs(t, api, admin, "POST", "/bookings", &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u2.ID, ClassID: c.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}})
+	assert.NoError(t, DecodeBody(rr.Body, &other))
+
+	member := signToken(t, u1.ID, "member", "")
+
+	var me datamodel.User
+	rr = sendAs(t, api, member, "GET", "/me", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &me))
+	assert.Equal(t, u1.ID, me.ID)
+
+	// A forged user field is rejected, the booking is always for the principal
+	rr = sendAs(t, api, member, "POST", "/me/bookings", map[string]interface{}{"class": c.ID, "user": u2.ID, "date": "2023-10-10T00:00:00Z"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	var b datamodel.Booking
+	rr = sendAs(t, api, member, "POST", "/me/bookings", map[string]interface{}{"class": c.ID, "date": "2023-10-10T00:00:00Z"})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &b))
+	assert.Equal(t, u1.ID, b.UserID)
+
+	var bookings []*datamodel.Booking
+	rr = sendAs(t, api, member, "GET", "/me/bookings", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &bookings))
+	assert.Len(t, bookings, 1)
+	assert.Equal(t, b.ID, bookings[0].ID)
+
+	// The bookings of the other users can't be cancelled through /me
+	assert.Equal(t, http.StatusNotFound, sendAs(t, api, member, "DELETE", "/me/bookings/"+other.ID, nil).Code)
+	assert.Equal(t, http.StatusOK, sendAs(t, api, member, "DELETE", "/me/bookings/"+b.ID, nil).Code)
+
+	// A principal that is not a user is not found
+	assert.Equal(t, http.StatusNotFound, sendAs(t, api, admin, "GET", "/me", nil).Code)
+}
+
+func TestGDPR(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+
+	au, err := auth.New(&auth.Config{JWTSecret: "secret"})
+	assert.NoError(t, err)
+	api := api.New(context.Background(), srv, api.WithAuthenticator(au))
+
+	admin := signToken(t, "admin", "admin", "")
+
+	var u datamodel.User
+	rr := sendAs(t, api, admin, "POST", "/users", &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}})
+	assert.NoError(t, DecodeBody(rr.Body, &u))
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	var c datamodel.Class
+	rr = sendAs(t, api, admin, "POST", "/classes", &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}})
+	assert.NoError(t, DecodeBody(rr.Body, &c))
+
+	var b datamodel.Booking
+	rr = sendAs(t, api, admin, "POST", "/bookings", &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u.ID, ClassID: c.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}})
+	assert.NoError(t, DecodeBody(rr.Body, &b))
+
+	member := signToken(t, u.ID, "member", "")
+	other := signToken(t, "other", "member", "")
+
+	// The export is only available to the member and the staff, the others don't find the user
+	assert.Equal(t, http.StatusNotFound, sendAs(t, api, other, "GET", "/users/"+u.ID+"/export", nil).Code)
+
+	rr = sendAs(t, api, member, "GET", "/users/"+u.ID+"/export", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+
+	var export datamodel.UserExport
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&export))
+	assert.Equal(t, u.Email, export.User.Email)
+	assert.Len(t, export.Attendance.Bookings, 1)
+	assert.Equal(t, b.ID, export.Attendance.Bookings[0].ID)
+
+	// The erasure anonymizes the user and keeps its bookings
+	assert.Equal(t, http.StatusForbidden, sendAs(t, api, other, "DELETE", "/users/"+u.ID, nil).Code)
+
+	var erased datamodel.User
+	rr = sendAs(t, api, member, "DELETE", "/users/"+u.ID, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &erased))
+	assert.Equal(t, u.ID, erased.ID)
+	assert.Empty(t, erased.Email)
+	assert.Empty(t, erased.Name)
+	assert.NotNil(t, erased.ErasedAt)
+	assert.Equal(t, http.StatusConflict, sendAs(t, api, member, "DELETE", "/users/"+u.ID, nil).Code)
+
+	rr = sendAs(t, api, admin, "GET", "/users/"+u.ID+"/export", nil)
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&export))
+	assert.Empty(t, export.User.Email)
+	assert.Len(t, export.Attendance.Bookings, 1)
+
+	// The audit trail of the user doesn't keep the personal data the erasure removed
+	var entries []*datamodel.AuditEntry
+	rr = sendAs(t, api, admin, "GET", "/audit?entity=user&entity_id="+u.ID, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.NoError(t, DecodeBody(rr.Body, &entries))
+	assert.NotEmpty(t, entries)
+	for _, pii := range []string{u.Name, u.Surname, u.Email, u.Phone} {
+		assert.NotContains(t, body, pii)
+	}
+
+	var erasure *datamodel.AuditEntry
+	for _, e := range entries {
+		if e.Action == datamodel.AuditActionErase {
+			erasure = e
+		}
+	}
+	assert.NotNil(t, erasure)
+
+	var before, after datamodel.User
+	assert.NoError(t, json.Unmarshal(erasure.Before, &before))
+	assert.NoError(t, json.Unmarshal(erasure.After, &after))
+	assert.Nil(t, before.ErasedAt)
+	assert.NotNil(t, after.ErasedAt)
+}
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+
+	au, err := auth.New(&auth.Config{JWTSecret: "secret"})
+	assert.NoError(t, err)
+	api := api.New(context.Background(), srv, api.WithAuthenticator(au))
+
+	admin := signToken(t, "admin", "admin", "")
+	staff := signToken(t, "staff", "staff", "Studio 1")
+
+	var u datamodel.User
+	rr := sendAs(t, api, staff, "POST", "/users", &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}})
+	assert.NoError(t, DecodeBody(rr.Body, &u))
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	var c datamodel.Class
+	rr = sendAs(t, api, staff, "POST", "/classes", &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}})
+	assert.NoError(t, DecodeBody(rr.Body, &c))
+
+	// The request id is generated by the server, the one sent by the client is only recorded next to it
+	body, err := json.Marshal(&datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u.ID, ClassID: c.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}})
+	assert.NoError(t, err)
+	req, err := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.HeaderAuthorization, "Bearer "+staff)
+	req.Header.Set("X-Request-ID", "client-1")
+	rr = httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+
+	var b datamodel.Booking
+	assert.NoError(t, DecodeBody(rr.Body, &b))
+	createRequestID := rr.Header().Get("X-Request-ID")
+	assert.NotEmpty(t, createRequestID)
+	assert.NotEqual(t, "client-1", createRequestID)
+
+	rr = sendAs(t, api, staff, "DELETE", "/bookings/"+b.ID, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	// The audit trail is reserved to the admins
+	assert.Equal(t, http.StatusForbidden, sendAs(t, api, staff, "GET", "/audit", nil).Code)
+
+	var entries []*datamodel.AuditEntry
+	rr = sendAs(t, api, admin, "GET", "/audit", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &entries))
+	assert.Len(t, entries, 4)
+
+	rr = sendAs(t, api, admin, "GET", "/audit?entity=booking&entity_id="+b.ID, nil)
+	assert.NoError(t, DecodeBody(rr.Body, &entries))
+	assert.Len(t, entries, 2)
+
+	created, cancelled := entries[0], entries[1]
+	assert.Equal(t, datamodel.AuditActionCreate, created.Action)
+	assert.Equal(t, "staff", created.Actor)
+	assert.Equal(t, createRequestID, created.RequestID)
+	assert.Equal(t, "client-1", created.ClientRequestID)
+	assert.Nil(t, created.Before)
+
+	var before, after datamodel.Booking
+	assert.Equal(t, datamodel.AuditActionUpdate, cancelled.Action)
+	assert.NoError(t, json.Unmarshal(cancelled.Before, &before))
+	assert.NoError(t, json.Unmarshal(cancelled.After, &after))
+	assert.Equal(t, datamodel.BookingStatusBooked, before.Status)
+	assert.Equal(t, datamodel.BookingStatusCancelled, after.Status)
+	assert.NotEqual(t, createRequestID, cancelled.RequestID)
+	assert.Empty(t, cancelled.ClientRequestID)
+}
+
+func TestIdempotency(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+	api := api.New(context.Background(), srv)
+
+	user := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}}, false)
+
+	booking := &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}}
+
+	// The retry gets the response of the first attempt
+	var first, retry datamodel.Booking
+	rr := postIdempotent(t, api, "/bookings", "key-1", booking)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+	assert.NoError(t, DecodeBody(rr.Body, &first))
+
+	rr = postIdempotent(t, api, "/bookings", "key-1", booking)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+	assert.NoError(t, DecodeBody(rr.Body, &retry))
+	assert.Equal(t, first.ID, retry.ID)
+
+	// The key can't be reused for another request
+	other := *booking
+	other.Date = time.Date(2023, 10, 11, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, http.StatusUnprocessableEntity, postIdempotent(t, api, "/bookings", "key-1", &other).Code)
+	assert.Equal(t, http.StatusUnprocessableEntity, postIdempotent(t, api, "/users", "key-1", booking).Code)
+
+	// Without key the retry is a duplicate
+	assert.Equal(t, http.StatusConflict, postIdempotent(t, api, "/bookings", "", booking).Code)
+
+	// The errors are replayed too
+	assert.Equal(t, http.StatusConflict, postIdempotent(t, api, "/bookings", "key-2", booking).Code)
+	rr = postIdempotent(t, api, "/bookings", "key-2", booking)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+}
+
+// panickingDatabase panics on the next save of a user
+type panickingDatabase struct {
+	database.Database
+	panics bool
+}
+
+func (db *panickingDatabase) SaveUser(ctx context.Context, u *datamodel.User, events ...*datamodel.Event) error {
+	if db.panics {
+		db.panics = false
+		panic("database down")
+	}
+	return db.Database.SaveUser(ctx, u, events...)
+}
+
+func TestIdempotencyPanic(t *testing.T) {
+	ctx := context.Background()
+	db := &panickingDatabase{Database: database.New(ctx, cliparams.New()), panics: true}
+	srv := service.New(ctx, db)
+	api := api.New(ctx, srv)
+
+	user := &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}
+
+	// The panic goes on to the server and the key is not left in progress, the retry runs the request again
+	assert.PanicsWithValue(t, "database down", func() { postIdempotent(t, api, "/users", "key-1", user) })
+
+	rr := postIdempotent(t, api, "/users", "key-1", user)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Empty(t, rr.Header().Get("Idempotent-Replayed"))
+}
+
+// postIdempotent sends v as json body with the given idempotency key through the router of the api
+func postIdempotent(t *testing.T, api *api.Api, url, key string, v interface{}) *httptest.ResponseRecorder {
+	body, err := json.Marshal(v)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", url, bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if key != "" {
+		req.Header.Set("Idempotency-Key", key)
+	}
+
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestConcurrencyControl(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+	api := api.New(context.Background(), srv)
+
+	user := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	assert.Equal(t, 1, user.Version)
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}}, false)
+
+	// The GET returns the version as ETag and a 304 when the client has it
+	rr := sendWithHeader(t, api, "GET", "/classes/"+class.ID, "", "", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"1"`, rr.Header().Get("ETag"))
+
+	rr = sendWithHeader(t, api, "GET", "/classes/"+class.ID, "If-None-Match", `"1"`, nil)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+
+	// Two front-desk staff edit the version 1, the second edit is rejected
+	capacity := 12
+	rr = sendWithHeader(t, api, "PATCH", "/classes/"+class.ID, "If-Match", `"1"`, &datamodel.UpdateClassRequest{DailyCapacity: &capacity})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+	name := "Power Yoga"
+	rr = sendWithHeader(t, api, "PATCH", "/classes/"+class.ID, "If-Match", `"1"`, &datamodel.UpdateClassRequest{Name: &name})
+	assert.Equal(t, http.StatusPreconditionFailed, rr.Code)
+
+	var updated datamodel.Class
+	rr = sendWithHeader(t, api, "GET", "/classes/"+class.ID, "If-None-Match", `"1"`, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &updated))
+	assert.Equal(t, 12, updated.DailyCapacity)
+	assert.Equal(t, "Yoga", updated.Name)
+
+	// Without If-Match the last write wins
+	rr = sendWithHeader(t, api, "PATCH", "/classes/"+class.ID, "", "", &datamodel.UpdateClassRequest{Name: &name})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"3"`, rr.Header().Get("ETag"))
+
+	// The users follow the same rules
+	email := "john@example.com"
+	assert.Equal(t, http.StatusPreconditionFailed, sendWithHeader(t, api, "PATCH", "/users/"+user.ID, "If-Match", `"2"`, &datamodel.UpdateUserRequest{Email: &email}).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, sendWithHeader(t, api, "PATCH", "/users/"+user.ID, "If-Match", `W/"1"`, &datamodel.UpdateUserRequest{Email: &email}).Code)
+	rr = sendWithHeader(t, api, "PATCH", "/users/"+user.ID, "If-Match", `"1"`, &datamodel.UpdateUserRequest{Email: &email})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+
+	invalid := "john"
+	assert.Equal(t, http.StatusBadRequest, sendWithHeader(t, api, "PATCH", "/users/"+user.ID, "", "", &datamodel.UpdateUserRequest{Email: &invalid}).Code)
+	assert.Equal(t, http.StatusNotModified, sendWithHeader(t, api, "GET", "/users/"+user.ID, "If-None-Match", `"2"`, nil).Code)
+
+	// The DELETE of a booking changed since it was read is rejected
+	booking := createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}}, false)
+	assert.Equal(t, http.StatusPreconditionFailed, sendWithHeader(t, api, "DELETE", "/bookings/"+booking.ID, "If-Match", `"2"`, nil).Code)
+
+	rr = sendWithHeader(t, api, "DELETE", "/bookings/"+booking.ID, "If-Match", `"1"`, nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, `"2"`, rr.Header().Get("ETag"))
+	assert.Equal(t, http.StatusNotModified, sendWithHeader(t, api, "GET", "/bookings/"+booking.ID, "If-None-Match", `"2"`, nil).Code)
+}
+
+func TestBatchBooking(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+	api := api.New(context.Background(), srv)
+
+	u1 := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	u2 := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", Phone: "+34987654321"}}, false)
+	u3 := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "Jim", Surname: "Doe", Email: "jim.doe@example.com", Phone: "+34555555555"}}, false)
+	setMembership(t, api, u3.ID, &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 1})
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 2}}, false)
+
+	day := func(d int) time.Time { return time.Date(2023, 10, d, 0, 0, 0, 0, time.UTC) }
+	booking := func(u *datamodel.User, d int) *datamodel.CreateBookingRequest {
+		return &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u.ID, ClassID: class.ID, Date: day(d)}}
+	}
+	batch := func(mode datamodel.BatchMode, bookings ...*datamodel.CreateBookingRequest) (int, *datamodel.BatchBookingResponse) {
+		rr := sendWithHeader(t, api, "POST", "/bookings:batch", "", "", &datamodel.CreateBatchBookingRequest{Mode: mode, Bookings: bookings})
+		var resp datamodel.BatchBookingResponse
+		if rr.Code == http.StatusCreated || rr.Code == http.StatusMultiStatus || rr.Code == http.StatusUnprocessableEntity {
+			assert.NoError(t, DecodeBody(rr.Body, &resp))
+		}
+		return rr.Code, &resp
+	}
+
+	// The capacity is checked across the batch, an atomic batch creates nothing if a booking fails
+	code, resp := batch(datamodel.BatchModeAtomic, booking(u1, 10), booking(u2, 10), booking(u3, 10))
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, 0, resp.Created)
+	assert.Equal(t, 1, resp.Failed)
+	assert.Equal(t, datamodel.BatchItemAborted, resp.Results[0].Status)
+	assert.Equal(t, datamodel.BatchItemAborted, resp.Results[1].Status)
+	assert.Equal(t, datamodel.BatchItemFailed, resp.Results[2].Status)
+	assert.Equal(t, "class full", resp.Results[2].Error)
+	assert.Empty(t, listBookings(t, api, &datamodel.ListRequest{}))
+	assert.Equal(t, 1, getCredits(t, api, u3.ID).Remaining)
+
+	// The entitlement is consumed across the batch too
+	code, resp = batch(datamodel.BatchModeAtomic, booking(u3, 11), booking(u3, 12))
+	assert.Equal(t, http.StatusUnprocessableEntity, code)
+	assert.Equal(t, "no credits left", resp.Results[1].Error)
+	assert.Equal(t, 1, getCredits(t, api, u3.ID).Remaining)
+
+	// A best effort batch creates what it can
+	code, resp = batch(datamodel.BatchModeBestEffort, booking(u1, 10), booking(u1, 10), booking(u3, 10), booking(u2, 10))
+	assert.Equal(t, http.StatusMultiStatus, code)
+	assert.Equal(t, 2, resp.Created)
+	assert.Equal(t, 2, resp.Failed)
+	assert.Equal(t, datamodel.BatchItemCreated, resp.Results[0].Status)
+	assert.Equal(t, "already exists", resp.Results[1].Error)
+	assert.Equal(t, datamodel.BatchItemCreated, resp.Results[2].Status)
+	assert.Equal(t, "class full", resp.Results[3].Error)
+	assert.Len(t, listBookings(t, api, &datamodel.ListRequest{}), 2)
+	assert.Equal(t, 0, getCredits(t, api, u3.ID).Remaining)
+
+	// A week of sessions in one call
+	code, resp = batch("", booking(u2, 16), booking(u2, 17), booking(u2, 18), booking(u2, 19), booking(u2, 20))
+	assert.Equal(t, http.StatusCreated, code)
+	assert.Equal(t, datamodel.BatchModeAtomic, resp.Mode)
+	assert.Equal(t, 5, resp.Created)
+	assert.NotEmpty(t, resp.Results[4].Booking.ID)
+	assert.Len(t, listBookings(t, api, &datamodel.ListRequest{}), 7)
+
+	// The single bookings respect the capacity as well
+	assert.Equal(t, http.StatusConflict, postBooking(t, api, booking(u2, 10)).Code)
+
+	code, _ = batch("sometimes", booking(u2, 21))
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = batch(datamodel.BatchModeAtomic)
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+// sendWithHeader sends a request with the given header if not empty and v as json body if not nil through the router of the api
+func sendWithHeader(t *testing.T, api *api.Api, method, url, header, value string, v interface{}) *httptest.ResponseRecorder {
+	var body []byte
+	if v != nil {
+		var err error
+		body, err = json.Marshal(v)
+		assert.NoError(t, err)
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	if header != "" {
+		req.Header.Set(header, value)
+	}
+
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func TestImport(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+	api := api.New(context.Background(), srv)
+
+	existing := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+
+	users := "name,surname,email,phone\n" +
+		"Jane,Doe,jane.doe@example.com,+34111111111\n" +
+		"John,Doe,john.doe@example.com,+34123456789\n" +
+		"Bad,Email,bad-email,+34222222222\n" +
+		"Jane,Doe,jane.doe@example.com,+34111111111\n" +
+		"Too,Few,fields\n" +
+		"Bad,Phone,bad.phone@example.com,34333333333\n"
+
+	// The dry-run reports the rows without saving them
+	var report datamodel.ImportReport
+	rr := sendBody(t, api, "POST", "/users:import?dry_run=true", "text/csv", users)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &report))
+	assert.True(t, report.DryRun)
+	assert.Equal(t, 1, report.Created)
+	assert.Equal(t, 2, report.Duplicates)
+	assert.Equal(t, 3, report.Invalid)
+	assert.Len(t, listUsers(t, api, &datamodel.ListRequest{}), 1)
+
+	rr = sendBody(t, api, "POST", "/users:import", "text/csv", users)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &report))
+	assert.False(t, report.DryRun)
+	assert.Len(t, report.Rows, 6)
+
+	expected := []datamodel.ImportStatus{
+		datamodel.ImportStatusCreated,
+		datamodel.ImportStatusDuplicate,
+		datamodel.ImportStatusInvalid,
+		datamodel.ImportStatusDuplicate,
+		datamodel.ImportStatusInvalid,
+		datamodel.ImportStatusInvalid,
+	}
+	for i, row := range report.Rows {
+		assert.Equal(t, i+2, row.Line)
+		assert.Equal(t, expected[i], row.Status, "line %d", row.Line)
+	}
+	assert.Equal(t, existing.ID, report.Rows[1].ID)
+	assert.Equal(t, "duplicate of line 2", report.Rows[3].Error)
+
+	assert.Equal(t, datamodel.PlanUnlimited, getCredits(t, api, report.Rows[0].ID).Plan)
+	assert.Len(t, listUsers(t, api, &datamodel.ListRequest{}), 2)
+
+	// The memberships are not imported, they are set by the staff
+	rr = sendBody(t, api, "POST", "/users:import", "text/csv", "name,surname,email,phone,plan,credits\nJim,Doe,jim.doe@example.com,+34555555555,pack,10\n")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = sendBody(t, api, "POST", "/users:import", "application/x-ndjson", `{"name":"Jim","surname":"Doe","email":"jim.doe@example.com","phone":"+34555555555","membership":{"plan":"pack","credits":10}}`+"\n")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &report))
+	assert.Equal(t, 1, report.Invalid)
+	assert.Len(t, listUsers(t, api, &datamodel.ListRequest{}), 2)
+
+	// The classes are checked against the rooms and against each other
+	classes := `{"studio":"Studio 1","room":"Room 1","class_name":"Yoga","start_date":"2023-10-01T18:00:00Z","end_date":"2023-10-31T00:00:00Z","capacity":10}
+
+{"studio":"Studio 1","room":"Room 1","class_name":"Pilates","start_date":"2023-10-15T18:30:00Z","end_date":"2023-11-15T00:00:00Z","capacity":10}
+{"studio":"Studio 1","room":"Room 1","class_name":"Boxing","start_date":"2023-10-15T20:00:00Z","end_date":"2023-11-15T00:00:00Z","capacity":10,"rules":{"max_advance_days":7}}
+{"studio":"Studio 1","class_name":"Spinning","start_date":"not a date"}
+`
+	rr = sendBody(t, api, "POST", "/classes:import?dry_run=true", "application/x-ndjson", classes)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &report))
+	assert.Equal(t, 2, report.Created)
+	assert.Contains(t, report.Rows[1].Error, "line 1")
+	assert.Empty(t, listClasses(t, api, &datamodel.ListRequest{}))
+
+	rr = sendBody(t, api, "POST", "/classes:import", "application/x-ndjson", classes)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &report))
+	assert.Equal(t, 2, report.Created)
+	assert.Equal(t, 2, report.Invalid)
+	assert.Equal(t, 3, report.Rows[1].Line)
+	assert.Equal(t, datamodel.ImportStatusInvalid, report.Rows[1].Status)
+	assert.Contains(t, report.Rows[1].Error, report.Rows[0].ID)
+	assert.Equal(t, 5, report.Rows[3].Line)
+
+	listed := listClasses(t, api, &datamodel.ListRequest{})
+	assert.Len(t, listed, 2)
+
+	// The rows are decoded as strictly as the json bodies
+	rr = sendBody(t, api, "POST", "/classes:import", "application/x-ndjson", `{"studio":"Studio 2","class_name":"Yoga","teacher":"Jane","start_date":"2023-10-01T18:00:00Z","end_date":"2023-10-31T00:00:00Z","capacity":10}`+"\n"+
+		`{"studio":"Studio 2","class_name":"Pilates","start_date":"2023-10-01T18:00:00Z","end_date":"2023-10-31T00:00:00Z","capacity":10} {}`+"\n")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &report))
+	assert.Equal(t, 2, report.Invalid)
+	assert.Contains(t, report.Rows[0].Error, "unknown field")
+	assert.Contains(t, report.Rows[0].Error, "teacher")
+	assert.Contains(t, report.Rows[1].Error, "unexpected data after the json value")
+	assert.Len(t, listClasses(t, api, &datamodel.ListRequest{}), 2)
+
+	classesCSV := "studio,room,class_name,start_date,end_date,capacity\n" +
+		"Studio 1,Room 1,Yoga,2023-10-01T18:00:00Z,2023-10-31T00:00:00Z,10\n" +
+		"Studio 1,Room 2,Zumba,2023-10-01T18:00:00Z,2023-10-31T00:00:00Z,20\n"
+	rr = sendBody(t, api, "POST", "/classes:import", "text/csv; charset=utf-8", classesCSV)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &report))
+	assert.Equal(t, datamodel.ImportStatusDuplicate, report.Rows[0].Status)
+	assert.Equal(t, datamodel.ImportStatusCreated, report.Rows[1].Status)
+
+	// The files that can't be read at all are rejected
+	assert.Equal(t, http.StatusUnsupportedMediaType, sendBody(t, api, "POST", "/users:import", "application/xml", "<users/>").Code)
+	assert.Equal(t, http.StatusBadRequest, sendBody(t, api, "POST", "/users:import", "text/csv", "name,age\nJohn,42\n").Code)
+}
+
+// sendBody sends a request with the given raw body and content type through the router of the api
+func sendBody(t *testing.T, api *api.Api, method, url, contentType, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", contentType)
+
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// signToken returns a HS256 token signed with the secret used by the tests
+func signToken(t *testing.T, sub, role, studio string) string {
+	tk, err := auth.SignHS256(&auth.Claims{Subject: sub, Role: role, Studio: studio, ExpiresAt: time.Now().Add(time.Hour).Unix()}, []byte("secret"))
+	assert.NoError(t, err)
+	return tk
+}
+
+// sendAs sends a request with the given bearer token and v as json body if not nil through the router of the api
+func sendAs(t *testing.T, api *api.Api, token, method, url string, v interface{}) *httptest.ResponseRecorder {
+	var body []byte
+	if v != nil {
+		var err error
+		body, err = json.Marshal(v)
+		assert.NoError(t, err)
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(auth.HeaderAuthorization, "Bearer "+token)
+
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+
+	return rr
+}
+
+// do sends a request without body through the router of the api
+func do(t *testing.T, api *api.Api, method, url string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, url, nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func postBooking(t *testing.T, api *api.Api, booking *datamodel.CreateBookingRequest) *httptest.ResponseRecorder {
+	body, err := json.Marshal(booking)
+	assert.NoError(t, err)
+
+	req, err := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+
+	return rr
+}
+
+func getCredits(t *testing.T, api *api.Api, userID string) *datamodel.Credits {
+	req, err := http.NewRequest("GET", fmt.Sprintf("/users/%s/credits", userID), nil)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	api.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var credits datamodel.Credits
+	err = DecodeBody(rr.Body, &credits)
+	assert.NoError(t, err)
+
+	return &credits
+}
+
+func setMembership(t *testing.T, api *api.Api, userID string, membership *datamodel.Membership) *datamodel.User {
+	rr := sendWithHeader(t, api, "PUT", "/users/"+userID+"/membership", "", "", membership)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var user datamodel.User
+	assert.NoError(t, DecodeBody(rr.Body, &user))
+
+	return &user
+}
+
 func createUser(t *testing.T, api *api.Api, user *datamodel.CreateUserRequest, shouldFail bool) *datamodel.User {
 	body, err := json.Marshal(user)
 	assert.NoError(t, err)
 
 	req, err := http.NewRequest("POST", "/users", bytes.NewReader(body))
 	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(api.CreateUser)
@@ -175,6 +1374,7 @@ func createClass(t *testing.T, api *api.Api, class *datamodel.CreateClassRequest
 
 	req, err := http.NewRequest("POST", "/classes", bytes.NewReader(body))
 	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(api.CreateClass)
@@ -220,6 +1420,7 @@ func createBooking(t *testing.T, api *api.Api, booking *datamodel.CreateBookingR
 
 	req, err := http.NewRequest("POST", "/bookings", bytes.NewReader(body))
 	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
 
 	rr := httptest.NewRecorder()
 	handler := http.HandlerFunc(api.CreateBooking)
@@ -278,3 +1479,732 @@ func getBooking(t *testing.T, api *api.Api, id string) *datamodel.BookingFullInf
 
 	return &bookingResp
 }
+
+func TestExport(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+	api := api.New(context.Background(), srv)
+
+	user := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	other := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "=HYPERLINK(\"x\")", Surname: "Abe", Email: "abe@example.com", Phone: "+34987654321"}}, false)
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga, level 1", Studio: "Studio 1", Room: "Room 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}}, false)
+
+	day := time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)
+	booking := createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: day}}, false)
+	createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: other.ID, ClassID: class.ID, Date: day}}, false)
+	createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: day.AddDate(0, 0, 1)}}, false)
+
+	readCSV := func(url string) [][]string {
+		rr := sendWithHeader(t, api, "GET", url, "Accept", "text/csv", nil)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+		records, err := csv.NewReader(rr.Body).ReadAll()
+		assert.NoError(t, err)
+		return records
+	}
+
+	// The lists are exported as csv when asked for
+	bookings := readCSV("/bookings")
+	assert.Len(t, bookings, 4)
+	assert.Equal(t, []string{"id", "user", "class", "date", "status", "checked_in_at", "cancelled_at", "version"}, bookings[0])
+
+	classes := readCSV("/classes")
+	assert.Len(t, classes, 2)
+	assert.Equal(t, "Yoga, level 1", classes[1][3])
+
+	// The attendees of a session are sorted by surname and the cells that a spreadsheet would run are escaped
+	attendees := readCSV(fmt.Sprintf("/classes/%s/attendees?date=2023-10-10", class.ID))
+	assert.Len(t, attendees, 3)
+	assert.Equal(t, `'=HYPERLINK("x")`, attendees[1][5])
+	assert.Equal(t, "+34987654321", attendees[1][8])
+	assert.Equal(t, booking.ID, attendees[2][0])
+
+	assert.Len(t, readCSV(fmt.Sprintf("/classes/%s/attendees", class.ID)), 4)
+
+	// Json stays the default, also when csv is less preferred
+	rr := sendWithHeader(t, api, "GET", fmt.Sprintf("/classes/%s/attendees", class.ID), "Accept", "text/csv;q=0.5, application/json", nil)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var listed []*datamodel.Attendee
+	assert.NoError(t, DecodeBody(rr.Body, &listed))
+	assert.Len(t, listed, 3)
+
+	assert.Equal(t, http.StatusBadRequest, do(t, api, "GET", fmt.Sprintf("/classes/%s/attendees?date=tomorrow", class.ID)).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, api, "GET", "/classes/unknown/attendees").Code)
+
+	// The sessions booked by a member are one event each
+	rr = do(t, api, "GET", fmt.Sprintf("/users/%s/calendar.ics", user.ID))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/calendar; charset=utf-8", rr.Header().Get("Content-Type"))
+	feed := rr.Body.String()
+	assert.True(t, strings.HasPrefix(feed, "BEGIN:VCALENDAR\r\n"))
+	assert.Equal(t, 2, strings.Count(feed, "BEGIN:VEVENT"))
+	assert.Contains(t, feed, "UID:"+booking.ID+"@abcfitness\r\n")
+	assert.Contains(t, feed, "DTSTART:20231010T180000Z\r\n")
+	assert.Contains(t, feed, "SUMMARY:Yoga\\, level 1\r\n")
+	assert.Contains(t, feed, "LOCATION:Studio 1\\, Room 1\r\n")
+
+	// The cancelled bookings leave the feed
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", fmt.Sprintf("/bookings/%s", booking.ID)).Code)
+	rr = do(t, api, "GET", fmt.Sprintf("/users/%s/calendar.ics", user.ID))
+	assert.Equal(t, 1, strings.Count(rr.Body.String(), "BEGIN:VEVENT"))
+
+	// The class is a daily recurring event
+	rr = do(t, api, "GET", fmt.Sprintf("/classes/%s/calendar.ics", class.ID))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	feed = rr.Body.String()
+	assert.Equal(t, 1, strings.Count(feed, "BEGIN:VEVENT"))
+	assert.Contains(t, feed, "DTSTART:20231001T180000Z\r\n")
+	assert.Contains(t, feed, "RRULE:FREQ=DAILY;UNTIL=20231031T180000Z\r\n")
+
+	assert.Equal(t, http.StatusNotFound, do(t, api, "GET", "/users/unknown/calendar.ics").Code)
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db,
+		service.WithClock(func() time.Time { return now }),
+		service.WithWebhookPolicy(&webhook.RetryPolicy{MaxAttempts: 3, Backoff: time.Minute, MaxBackoff: time.Hour}),
+		service.WithPrivateWebhooks(),
+	)
+	api := api.New(context.Background(), srv)
+
+	// The partner records what it receives and answers with its current status
+	type received struct {
+		header http.Header
+		body   []byte
+	}
+	var mu sync.Mutex
+	var calls []received
+	status := http.StatusOK
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, received{header: r.Header.Clone(), body: body})
+		w.WriteHeader(status)
+	}))
+	defer partner.Close()
+
+	setStatus := func(code int) {
+		mu.Lock()
+		defer mu.Unlock()
+		status = code
+	}
+	sent := func() []received {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]received(nil), calls...)
+	}
+	lastCall := func() received {
+		all := sent()
+		return all[len(all)-1]
+	}
+	deliver := func() int {
+		_, err := srv.PublishEvents(ctx)
+		assert.NoError(t, err)
+		n, err := srv.DeliverWebhooks(ctx)
+		assert.NoError(t, err)
+		return n
+	}
+
+	// The subscriptions are validated and their secret is only returned on creation
+	bad := []*datamodel.CreateWebhookRequest{
+		{URL: "ftp://partner.example.com", Events: []datamodel.EventType{datamodel.EventBookingCreated}},
+		{URL: partner.URL, Events: []datamodel.EventType{"booking.exploded"}},
+		{URL: partner.URL},
+	}
+	for _, req := range bad {
+		assert.Equal(t, http.StatusBadRequest, sendWithHeader(t, api, "POST", "/webhooks", "", "", req).Code)
+	}
+
+	rr := sendWithHeader(t, api, "POST", "/webhooks", "", "", &datamodel.CreateWebhookRequest{
+		URL:    partner.URL,
+		Events: []datamodel.EventType{datamodel.EventBookingCreated, datamodel.EventBookingCancelled},
+	})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var hook datamodel.Webhook
+	assert.NoError(t, DecodeBody(rr.Body, &hook))
+	assert.Len(t, hook.Secret, 64)
+
+	rr = do(t, api, "GET", "/webhooks/"+hook.ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var read datamodel.Webhook
+	assert.NoError(t, DecodeBody(rr.Body, &read))
+	assert.Empty(t, read.Secret)
+
+	user := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}}, false)
+	booking := createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}}, false)
+
+	// Only the subscribed events are sent, signed with the secret of the webhook
+	assert.Equal(t, 1, deliver())
+	call := lastCall()
+	assert.Equal(t, "booking.created", call.header.Get(webhook.HeaderEvent))
+	assert.NoError(t, webhook.Verify(hook.Secret, call.header.Get(webhook.HeaderSignature), call.body, now, 5*time.Minute))
+	var event datamodel.Event
+	assert.NoError(t, json.Unmarshal(call.body, &event))
+	assert.Equal(t, booking.ID, event.EntityID)
+
+	// A failing partner gets the delivery again with an exponential backoff, then it goes to the dead-letters
+	setStatus(http.StatusServiceUnavailable)
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/bookings/"+booking.ID).Code)
+	assert.Equal(t, 0, deliver())
+
+	listDeliveries := func(url string) []*datamodel.WebhookDelivery {
+		rr := do(t, api, "GET", url)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var deliveries []*datamodel.WebhookDelivery
+		assert.NoError(t, DecodeBody(rr.Body, &deliveries))
+		return deliveries
+	}
+
+	pending := listDeliveries("/webhooks/" + hook.ID + "/deliveries?status=pending")
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 1, pending[0].Attempts)
+	assert.Equal(t, http.StatusServiceUnavailable, pending[0].ResponseCode)
+	assert.Equal(t, now.Add(time.Minute), pending[0].NextAttemptAt.UTC())
+
+	// Nothing is sent before the retry is due
+	assert.Equal(t, 0, deliver())
+	assert.Len(t, sent(), 2)
+
+	now = now.Add(time.Minute)
+	deliver()
+	pending = listDeliveries("/webhooks/" + hook.ID + "/deliveries?status=pending")
+	assert.Equal(t, 2, pending[0].Attempts)
+	assert.Equal(t, now.Add(2*time.Minute), pending[0].NextAttemptAt.UTC())
+
+	now = now.Add(2 * time.Minute)
+	deliver()
+	assert.Empty(t, listDeliveries("/webhooks/"+hook.ID+"/deliveries?status=pending"))
+
+	dead := listDeliveries("/webhooks/dead-letters")
+	assert.Len(t, dead, 1)
+	assert.Equal(t, datamodel.EventBookingCancelled, dead[0].Event.Type)
+	assert.Equal(t, 3, dead[0].Attempts)
+	assert.Equal(t, "unexpected status 503", dead[0].Error)
+
+	// A dead letter can be sent again once the partner is back
+	setStatus(http.StatusNoContent)
+	assert.Equal(t, http.StatusOK, do(t, api, "POST", "/webhooks/dead-letters/"+dead[0].ID+"/retry").Code)
+	assert.Equal(t, 1, deliver())
+	assert.Empty(t, listDeliveries("/webhooks/dead-letters"))
+	assert.Equal(t, http.StatusConflict, do(t, api, "POST", "/webhooks/dead-letters/"+dead[0].ID+"/retry").Code)
+
+	// The retry is part of the audit trail
+	var entries []*datamodel.AuditEntry
+	rr = do(t, api, "GET", "/audit?entity=webhook_delivery&entity_id="+dead[0].ID)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &entries))
+	assert.Len(t, entries, 1)
+	assert.Equal(t, datamodel.AuditActionUpdate, entries[0].Action)
+
+	log := listDeliveries("/webhooks/" + hook.ID + "/deliveries")
+	assert.Len(t, log, 2)
+	for _, d := range log {
+		assert.Equal(t, datamodel.WebhookDeliveryDelivered, d.Status)
+	}
+
+	// Replacing the secret returns it once, the next deliveries are signed with it
+	rr = sendWithHeader(t, api, "PATCH", "/webhooks/"+hook.ID, "", "", map[string]interface{}{"secret": "rotated"})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NoError(t, DecodeBody(rr.Body, &read))
+	assert.Equal(t, "rotated", read.Secret)
+
+	createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: time.Date(2023, 10, 11, 0, 0, 0, 0, time.UTC)}}, false)
+	assert.Equal(t, 1, deliver())
+	call = lastCall()
+	assert.NoError(t, webhook.Verify("rotated", call.header.Get(webhook.HeaderSignature), call.body, now, 5*time.Minute))
+
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/webhooks/"+hook.ID).Code)
+	assert.Equal(t, http.StatusNotFound, do(t, api, "GET", "/webhooks/"+hook.ID).Code)
+}
+
+func TestWebhookTargets(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+	api := api.New(context.Background(), srv)
+
+	var calls int32
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+	}))
+	defer partner.Close()
+
+	events := []datamodel.EventType{datamodel.EventBookingCreated}
+
+	// The webhooks on the network of the server are rejected
+	for _, url := range []string{
+		partner.URL,
+		"http://localhost:8080/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://10.0.0.1/hooks",
+		"http://192.168.1.1/hooks",
+		"http://100.64.0.1/hooks",
+		"http://[::1]/hooks",
+		"http://[fd00::1]/hooks",
+		"http://[::ffff:127.0.0.1]/hooks",
+	} {
+		rr := sendWithHeader(t, api, "POST", "/webhooks", "", "", &datamodel.CreateWebhookRequest{URL: url, Events: events})
+		assert.Equal(t, http.StatusBadRequest, rr.Code, url)
+	}
+
+	rr := sendWithHeader(t, api, "POST", "/webhooks", "", "", &datamodel.CreateWebhookRequest{URL: "https://203.0.113.10/hooks", Events: events})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var hook datamodel.Webhook
+	assert.NoError(t, DecodeBody(rr.Body, &hook))
+
+	rr = sendWithHeader(t, api, "PATCH", "/webhooks/"+hook.ID, "", "", map[string]interface{}{"url": "http://169.254.169.254/latest/meta-data"})
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.NoError(t, db.DeleteWebhook(ctx, hook.ID))
+
+	// A webhook reaching the network of the server anyway, like a name resolving to another address after its check,
+	// is not connected to by the sender
+	assert.NoError(t, db.SaveWebhook(ctx, &datamodel.Webhook{ID: "rebound", URL: partner.URL, Events: events, Secret: "secret"}))
+
+	user := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 10}}, false)
+	createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}}, false)
+
+	_, err := srv.PublishEvents(ctx)
+	assert.NoError(t, err)
+	n, err := srv.DeliverWebhooks(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, n)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&calls))
+
+	rr = do(t, api, "GET", "/webhooks/rebound/deliveries")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var deliveries []*datamodel.WebhookDelivery
+	assert.NoError(t, DecodeBody(rr.Body, &deliveries))
+	assert.Len(t, deliveries, 1)
+	assert.Contains(t, deliveries[0].Error, "is not public")
+}
+
+func TestWebhookErasure(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }), service.WithPrivateWebhooks())
+	api := api.New(context.Background(), srv)
+
+	var mu sync.Mutex
+	var bodies []string
+	status := http.StatusServiceUnavailable
+	partner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		bodies = append(bodies, string(body))
+		w.WriteHeader(status)
+	}))
+	defer partner.Close()
+
+	rr := sendWithHeader(t, api, "POST", "/webhooks", "", "", &datamodel.CreateWebhookRequest{
+		URL:    partner.URL,
+		Events: []datamodel.EventType{datamodel.EventUserCreated, datamodel.EventUserErased},
+	})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var hook datamodel.Webhook
+	assert.NoError(t, DecodeBody(rr.Body, &hook))
+
+	deliver := func() {
+		_, err := srv.PublishEvents(ctx)
+		assert.NoError(t, err)
+		_, err = srv.DeliverWebhooks(ctx)
+		assert.NoError(t, err)
+	}
+
+	// The delivery of the creation of the user fails and waits for its retry with the personal data of the user
+	user := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	deliver()
+
+	listDeliveries := func() string {
+		rr := do(t, api, "GET", "/webhooks/"+hook.ID+"/deliveries")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		return rr.Body.String()
+	}
+	assert.Contains(t, listDeliveries(), user.Email)
+
+	// The erasure scrubs the stored deliveries, the partner doesn't get the personal data on the retry either
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/users/"+user.ID).Code)
+
+	deliveries := listDeliveries()
+	for _, pii := range []string{user.Name, user.Surname, user.Email, user.Phone} {
+		assert.NotContains(t, deliveries, pii)
+	}
+
+	mu.Lock()
+	status = http.StatusOK
+	failed := len(bodies)
+	mu.Unlock()
+
+	now = now.Add(time.Hour)
+	deliver()
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Greater(t, len(bodies), failed)
+	for _, body := range bodies[failed:] {
+		for _, pii := range []string{user.Name, user.Surname, user.Email, user.Phone} {
+			assert.NotContains(t, body, pii)
+		}
+	}
+}
+
+func TestAvailabilityStream(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+	api := api.New(context.Background(), srv)
+
+	server := httptest.NewServer(api)
+	defer server.Close()
+
+	user := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 2}}, false)
+
+	assert.Equal(t, http.StatusNotFound, do(t, api, "GET", "/classes/unknown/availability/stream").Code)
+	assert.Equal(t, http.StatusBadRequest, do(t, api, "GET", fmt.Sprintf("/classes/%s/availability/stream?date=2023-11-01", class.ID)).Code)
+
+	streamCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(streamCtx, "GET", fmt.Sprintf("%s/classes/%s/availability/stream?date=2023-10-10", server.URL, class.ID), nil)
+	assert.NoError(t, err)
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(resp.Body)
+	next := func() *datamodel.Availability {
+		var data string
+		for {
+			line, err := reader.ReadString('\n')
+			assert.NoError(t, err)
+			line = strings.TrimRight(line, "\n")
+			if line == "" && data != "" {
+				break
+			}
+			if strings.HasPrefix(line, "data: ") {
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+
+		var av datamodel.Availability
+		assert.NoError(t, json.Unmarshal([]byte(data), &av))
+		return &av
+	}
+
+	// The stream starts with the current availability of the session
+	av := next()
+	assert.Equal(t, class.ID, av.ClassID)
+	assert.Equal(t, 2, av.Capacity)
+	assert.Equal(t, 2, av.Remaining)
+
+	booking := createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)}}, false)
+	_, err = srv.PublishEvents(ctx)
+	assert.NoError(t, err)
+	av = next()
+	assert.Equal(t, 1, av.Booked)
+	assert.Equal(t, 1, av.Remaining)
+
+	// The bookings of the other days are not pushed
+	createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: time.Date(2023, 10, 11, 0, 0, 0, 0, time.UTC)}}, false)
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/bookings/"+booking.ID).Code)
+	_, err = srv.PublishEvents(ctx)
+	assert.NoError(t, err)
+	av = next()
+	assert.Equal(t, 0, av.Booked)
+	assert.Equal(t, 2, av.Remaining)
+
+	// A new capacity is pushed too
+	rr := sendWithHeader(t, api, "PATCH", "/classes/"+class.ID, "", "", map[string]interface{}{"capacity": 5})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	_, err = srv.PublishEvents(ctx)
+	assert.NoError(t, err)
+	av = next()
+	assert.Equal(t, 5, av.Remaining)
+}
+
+func TestAvailability(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	srv := service.New(ctx, db, service.WithClock(func() time.Time { return now }))
+	api := api.New(context.Background(), srv)
+
+	u1 := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"}}, false)
+	u2 := createUser(t, api, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", Phone: "+34987654321"}}, false)
+
+	startDate := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	endDate := time.Date(2023, 10, 5, 0, 0, 0, 0, time.UTC)
+	class := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Yoga", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 2}}, false)
+
+	day := func(d int) time.Time { return time.Date(2023, 10, d, 0, 0, 0, 0, time.UTC) }
+	createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u1.ID, ClassID: class.ID, Date: day(2)}}, false)
+	createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u2.ID, ClassID: class.ID, Date: day(2)}}, false)
+	cancelled := createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u1.ID, ClassID: class.ID, Date: day(3)}}, false)
+	createBooking(t, api, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{UserID: u2.ID, ClassID: class.ID, Date: day(3)}}, false)
+	assert.Equal(t, http.StatusOK, do(t, api, "DELETE", "/bookings/"+cancelled.ID).Code)
+
+	availability := func(query string) (int, []*datamodel.Availability) {
+		rr := do(t, api, "GET", fmt.Sprintf("/classes/%s/availability%s", class.ID, query))
+		var resp []*datamodel.Availability
+		if rr.Code == http.StatusOK {
+			assert.NoError(t, DecodeBody(rr.Body, &resp))
+		}
+		return rr.Code, resp
+	}
+
+	// The sessions from today by default
+	code, days := availability("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, days, 5)
+	assert.Equal(t, day(1), days[0].Date.UTC())
+	assert.Equal(t, day(5), days[4].Date.UTC())
+	assert.Equal(t, 2, days[0].Remaining)
+	assert.Equal(t, 2, days[1].Booked)
+	assert.Equal(t, 0, days[1].Remaining)
+	assert.Equal(t, 1, days[2].Booked)
+	assert.Equal(t, 1, days[2].Remaining)
+
+	// The range is limited to the sessions of the class
+	code, days = availability("?from=2023-10-03&to=2023-12-31")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, days, 3)
+	assert.Equal(t, day(3), days[0].Date.UTC())
+
+	code, days = availability("?from=2023-10-02T10:00:00Z&to=2023-10-02T10:00:00Z")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, days, 1)
+	assert.Equal(t, 2, days[0].Capacity)
+
+	code, _ = availability("?from=2023-10-04&to=2023-10-02")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = availability("?from=2023-11-01")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = availability("?to=yesterday")
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, http.StatusNotFound, do(t, api, "GET", "/classes/unknown/availability").Code)
+
+	rr := sendWithHeader(t, api, "GET", fmt.Sprintf("/classes/%s/availability?from=2023-10-02&to=2023-10-02", class.ID), "Accept", "text/csv", nil)
+	assert.Equal(t, "class,date,capacity,booked,remaining\n"+class.ID+",2023-10-02,2,2,0\n", rr.Body.String())
+
+	// The sessions of a long class are listed for a month by default and for a year at most
+	endDate = time.Date(2025, 10, 1, 0, 0, 0, 0, time.UTC)
+	long := createClass(t, api, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: "Pilates", Studio: "Studio 1", StartDate: &startDate, EndDate: &endDate, DailyCapacity: 2}}, false)
+	list := func(query string) (int, []*datamodel.Availability) {
+		rr := do(t, api, "GET", fmt.Sprintf("/classes/%s/availability%s", long.ID, query))
+		var resp []*datamodel.Availability
+		if rr.Code == http.StatusOK {
+			assert.NoError(t, DecodeBody(rr.Body, &resp))
+		}
+		return rr.Code, resp
+	}
+
+	code, days = list("")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, days, 31)
+	assert.Equal(t, day(1), days[0].Date.UTC())
+	code, days = list("?from=2024-01-01")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, days, 31)
+	code, days = list("?from=2023-10-01&to=2024-09-30")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, days, 366)
+	code, _ = list("?from=2023-10-01&to=2024-10-01")
+	assert.Equal(t, http.StatusBadRequest, code)
+	code, _ = list("?to=2025-01-01")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
+
+func TestGraphQL(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+
+	au, err := auth.New(&auth.Config{JWTSecret: "secret"})
+	assert.NoError(t, err)
+	api := api.New(ctx, srv, api.WithAuthenticator(au))
+	admin := signToken(t, "admin-1", "admin", "")
+
+	rr := sendAs(t, api, admin, "POST", "/users", &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{
+		Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789",
+	}})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	query := map[string]string{"query": "{ users { name email bookings { id } } }"}
+
+	// The graphql route is authenticated like the others
+	rr = sendWithHeader(t, api, "POST", "/graphql", "", "", query)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	// The result is the graphql result, not the envelope of the other routes
+	rr = sendAs(t, api, admin, "POST", "/graphql", query)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.JSONEq(t, `{"data":{"users":[{"name":"John","email":"john.doe@example.com","bookings":[]}]}}`, rr.Body.String())
+
+	// The errors of the service are reported with their code
+	rr = sendAs(t, api, signToken(t, "member-1", "member", ""), "POST", "/graphql", query)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var res struct {
+		Data   map[string]interface{} `json:"data"`
+		Errors []struct {
+			Message    string                 `json:"message"`
+			Extensions map[string]interface{} `json:"extensions"`
+		} `json:"errors"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&res))
+	assert.Len(t, res.Errors, 1)
+	assert.Equal(t, "FORBIDDEN", res.Errors[0].Extensions["code"])
+
+	rr = sendAs(t, api, admin, "POST", "/graphql", "not a query")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestOpenAPI(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+
+	au, err := auth.New(&auth.Config{JWTSecret: "secret"})
+	assert.NoError(t, err)
+	api := api.New(ctx, srv, api.WithAuthenticator(au))
+
+	// The specification is public
+	rr := do(t, api, "GET", "/openapi.json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	body := rr.Body.String()
+
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]json.RawMessage `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.NoError(t, json.Unmarshal([]byte(body), &spec))
+	assert.True(t, strings.HasPrefix(spec.OpenAPI, "3."))
+	assert.Contains(t, spec.Components.Schemas, "Response")
+	assert.Contains(t, spec.Components.Schemas, "ErrorResponse")
+
+	// Every route is described, a route added without its specification fails here
+	routes := api.Routes()
+	assert.NotEmpty(t, routes)
+	for _, route := range routes {
+		method, path, _ := strings.Cut(route, " ")
+		assert.Contains(t, spec.Paths[path], strings.ToLower(method), "route %s is not in the specification", route)
+	}
+
+	// And the specification doesn't describe routes that don't exist
+	for path, operations := range spec.Paths {
+		for method := range operations {
+			assert.Contains(t, routes, strings.ToUpper(method)+" "+path)
+		}
+	}
+
+	// The references point to the components of the specification
+	for _, name := range regexp.MustCompile(`#/components/schemas/(\w+)`).FindAllStringSubmatch(body, -1) {
+		assert.Contains(t, spec.Components.Schemas, name[1])
+	}
+}
+
+func TestStrictDecoding(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+	api := api.New(ctx, srv, api.WithMaxBodyBytes(256))
+
+	errorMessage := func(rr *httptest.ResponseRecorder) string {
+		var msg string
+		assert.NoError(t, DecodeBody(rr.Body, &msg))
+		return msg
+	}
+
+	// A typo in a field is rejected with the name of the field and its position
+	rr := sendBody(t, api, "POST", "/classes", "application/json", `{"studio":"Studio 1","classname":"Yoga"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "validation error : unknown field : field 'classname' at offset 21", errorMessage(rr))
+
+	// So is a value of the wrong type
+	rr = sendBody(t, api, "POST", "/classes", "application/json", `{"studio":"Studio 1","capacity":"ten"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "validation error : expected int but got string : field 'capacity' at offset 37", errorMessage(rr))
+
+	rr = sendBody(t, api, "POST", "/users", "application/json", `{"name":"John",}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, errorMessage(rr), "at offset 16")
+
+	rr = sendBody(t, api, "POST", "/users", "application/json", `{"name":"John"`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, errorMessage(rr), "unexpected end of the json")
+
+	rr = sendBody(t, api, "POST", "/users", "application/json", `{"name":"John"} {"name":"Jane"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, errorMessage(rr), "unexpected data after the json value")
+
+	rr = sendBody(t, api, "POST", "/users", "application/json", "")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Equal(t, "validation error : empty body", errorMessage(rr))
+
+	// The body must be sent as json
+	assert.Equal(t, http.StatusUnsupportedMediaType, sendBody(t, api, "POST", "/users", "", `{"name":"John"}`).Code)
+	assert.Equal(t, http.StatusUnsupportedMediaType, sendBody(t, api, "POST", "/users", "text/plain", `{"name":"John"}`).Code)
+
+	// The parameters of the media type are accepted
+	user := `{"name":"John","email":"john.doe@example.com","phone":"+34123456789"}`
+	assert.Equal(t, http.StatusCreated, sendBody(t, api, "POST", "/users", "application/json; charset=utf-8", user).Code)
+
+	// The bodies larger than the limit are rejected, also when they are read for an idempotency key
+	large := `{"name":"` + strings.Repeat("a", 512) + `"}`
+	assert.Equal(t, http.StatusRequestEntityTooLarge, sendBody(t, api, "PATCH", "/users/unknown", "application/json", large).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, sendWithHeader(t, api, "POST", "/users", "Idempotency-Key", "key-1", map[string]string{"name": strings.Repeat("a", 512)}).Code)
+
+	// The imports too, whatever the row the limit is reached on
+	rows := "name,surname,email,phone\n" + strings.Repeat("Jane,Doe,jane.doe@example.com,+34111111111\n", 10)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, sendBody(t, api, "POST", "/users:import", "text/csv", rows).Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, sendBody(t, api, "POST", "/users:import", "text/csv", "name,"+strings.Repeat("a", 512)+"\n").Code)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, sendBody(t, api, "POST", "/classes:import", "application/x-ndjson", strings.Repeat(`{"studio":"Studio 1"}`+"\n", 20)).Code)
+	assert.Len(t, listUsers(t, api, &datamodel.ListRequest{}), 1)
+}
+
+func TestClassWithoutDates(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(context.Background(), cliparams.New())
+	srv := service.New(ctx, db)
+	api := api.New(ctx, srv)
+
+	// The missing dates are a validation error, not a panic of the handler
+	for _, body := range []string{
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":"2023-10-06T18:30:00Z","capacity":10}`,
+		`{"studio":"Studio 1","class_name":"Yoga","end_date":"2023-10-15T00:00:00Z","capacity":10}`,
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":null,"end_date":null,"capacity":10}`,
+	} {
+		rr := sendBody(t, api, "POST", "/classes", "application/json", body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+		rr = sendBody(t, api, "POST", "/classes:import", "application/x-ndjson", body+"\n")
+		assert.Equal(t, http.StatusOK, rr.Code)
+		assert.Contains(t, rr.Body.String(), `"invalid":1`)
+	}
+}
@@ -0,0 +1,123 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+const (
+	MediaTypeEventStream = "text/event-stream"
+
+	// sseEventAvailability is the name of the server-sent events carrying an Availability
+	sseEventAvailability = "availability"
+	// sseHeartbeat is the interval of the comments keeping the stream open through the proxies and detecting the
+	// clients gone without closing the connection
+	sseHeartbeat = 15 * time.Second
+)
+
+// GetAvailability returns the Availability of each session of the class of the path as json or csv in the data field,
+// it accepts from and to as query params to select the sessions
+func (a *Api) GetAvailability(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	q := r.URL.Query()
+
+	from, err := parseDate(q.Get("from"))
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), http.StatusBadRequest)
+		return
+	}
+
+	to, err := parseDate(q.Get("to"))
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := a.srv.GetAvailability(ctx, mux.Vars(r)["id"], from, to)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// StreamAvailability streams the Availability of the sessions of the class of the path as server-sent events each time
+// it changes, it accepts a date as query param to follow a single session and starts with its current availability
+func (a *Api) StreamAvailability(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+	log := logging.Logger(ctx)
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		err := fmt.Errorf("streaming not supported")
+		http.Error(w, NewErrorResponse(ctx, err).String(), http.StatusInternalServerError)
+		return
+	}
+
+	date, err := parseDate(r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), http.StatusBadRequest)
+		return
+	}
+
+	updates, err := a.srv.WatchAvailability(ctx, mux.Vars(r)["id"], date)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", MediaTypeEventStream)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Prevents the reverse proxies from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(sseHeartbeat)
+	defer heartbeat.Stop()
+
+	id := 0
+	for {
+		select {
+		case <-ctx.Done():
+			log.Debugf("availability stream closed by the client")
+			return
+
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(w, ": ping\n\n")
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+
+		case av, ok := <-updates:
+			if !ok {
+				return
+			}
+
+			data, err := json.Marshal(av)
+			if err != nil {
+				log.Errorf("error encoding availability : %v", err)
+				continue
+			}
+
+			id++
+			_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", id, sseEventAvailability, data)
+			if err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
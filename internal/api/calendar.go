@@ -0,0 +1,150 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/lib/ical"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+const (
+	calendarProdID    = "-//ABCFitness//Bookings//EN"
+	calendarUIDDomain = "@abcfitness"
+)
+
+// ListAttendees returns the Attendees of the class of the path as json or csv in the data field, it accepts a date as query param to select a session
+func (a *Api) ListAttendees(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	date, err := parseDate(r.URL.Query().Get("date"))
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), http.StatusBadRequest)
+		return
+	}
+
+	resp, err := a.srv.ListAttendees(ctx, mux.Vars(r)["id"], date)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// parseDate parses a date query param as RFC 3339 or as a day, it returns nil for an empty param
+func parseDate(v string) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, v)
+	if err != nil {
+		t, err = time.Parse(time.DateOnly, v)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// GetUserCalendar returns the booked sessions of the user of the path as an iCalendar feed
+func (a *Api) GetUserCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	a.writeUserCalendar(ctx, w, mux.Vars(r)["id"])
+}
+
+// GetMyCalendar returns the booked sessions of the authenticated principal as an iCalendar feed
+func (a *Api) GetMyCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	p, err := a.principal(ctx)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeUserCalendar(ctx, w, p.ID)
+}
+
+// GetClassCalendar returns the sessions of the class of the path as an iCalendar feed, the sessions are a daily recurring event
+func (a *Api) GetClassCalendar(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	class, err := a.srv.GetClass(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	until := class.SessionStart(*class.EndDate)
+	event := classEvent(class, *class.StartDate, time.Now())
+	event.UID = class.ID + calendarUIDDomain
+	event.RepeatDailyUntil = &until
+
+	a.writeCalendar(ctx, w, &ical.Calendar{
+		ProdID: calendarProdID,
+		Name:   class.Name,
+		Events: []*ical.Event{event},
+	})
+}
+
+func (a *Api) writeUserCalendar(ctx context.Context, w http.ResponseWriter, userID string) {
+	sessions, err := a.srv.ListUserSessions(ctx, userID)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	now := time.Now()
+	cal := &ical.Calendar{
+		ProdID: calendarProdID,
+		Name:   "ABCFitness bookings",
+		Events: make([]*ical.Event, 0, len(sessions)),
+	}
+
+	for _, s := range sessions {
+		event := classEvent(s.Class, s.Date, now)
+		event.UID = s.ID + calendarUIDDomain
+		cal.Events = append(cal.Events, event)
+	}
+
+	a.writeCalendar(ctx, w, cal)
+}
+
+// classEvent returns the event of the session of the class of the given day
+func classEvent(class *datamodel.Class, day time.Time, now time.Time) *ical.Event {
+	location := class.Studio
+	if class.Room != "" {
+		location += ", " + class.Room
+	}
+
+	return &ical.Event{
+		Stamp:    now,
+		Start:    class.SessionStart(day),
+		End:      class.SessionEnd(day),
+		Summary:  class.Name,
+		Location: location,
+		Status:   ical.StatusConfirmed,
+	}
+}
+
+func (a *Api) writeCalendar(ctx context.Context, w http.ResponseWriter, cal *ical.Calendar) {
+	w.Header().Set("Content-Type", ical.ContentType)
+	w.Header().Set("Content-Disposition", `inline; filename="calendar.ics"`)
+
+	err := cal.Write(w)
+	if err != nil {
+		logging.Logger(ctx).Errorf("error encoding calendar : %v", err)
+	}
+}
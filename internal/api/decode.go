@@ -0,0 +1,135 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+
+	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+// decodeRequest decodes the json body of the request into the given interface, used for POST requests. The body must
+// be sent as application/json, be smaller than the limit of the api and only have the fields of the interface, the
+// error written to the client names the field and the offset of the body where the decoding failed
+func (a *Api) decodeRequest(ctx context.Context, w http.ResponseWriter, r *http.Request, v interface{}) error {
+	log := logging.Logger(ctx)
+
+	err := a.decodeJSON(w, r, v)
+	if err != nil {
+		log.Errorf("error decoding request : %v", err)
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return err
+	}
+
+	return nil
+}
+
+func (a *Api) decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != MediaTypeJSON {
+		return ierrors.ErrorUnsupportedMediaType()
+	}
+
+	a.limitBody(w, r)
+
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return decodeError(err, nil, 0)
+	}
+
+	return decodeStrict(data, v)
+}
+
+// decodeStrict decodes a single json value, an unknown field or anything after the value is rejected. It decodes the
+// json bodies and the rows of the ndjson imports.
+func decodeStrict(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(v)
+	if err != nil {
+		return decodeError(err, data, dec.InputOffset())
+	}
+
+	// The data is a single json value, anything after it is a mistake of the client
+	_, err = dec.Token()
+	if !errors.Is(err, io.EOF) {
+		if err != nil {
+			return decodeError(err, data, dec.InputOffset())
+		}
+		return ierrors.ErrorDecode("", dec.InputOffset(), "unexpected data after the json value")
+	}
+
+	return nil
+}
+
+// limitBody makes the reads of the body fail once more than the maximum size of the api has been read
+func (a *Api) limitBody(w http.ResponseWriter, r *http.Request) {
+	if a.maxBodyBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, a.maxBodyBytes)
+	}
+}
+
+// decodeError returns the error of the client for an error of the json decoder of the body, offset is the position of
+// the decoder when it failed, used when the error doesn't have its own
+func decodeError(err error, body []byte, offset int64) error {
+	var (
+		syntaxErr   *json.SyntaxError
+		typeErr     *json.UnmarshalTypeError
+		maxBytesErr *http.MaxBytesError
+	)
+
+	switch {
+	case errors.As(err, &maxBytesErr):
+		return ierrors.ErrorRequestTooLarge()
+	case errors.Is(err, io.EOF):
+		return ierrors.ErrorDecode("", 0, "empty body")
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return ierrors.ErrorDecode("", offset, "unexpected end of the json")
+	case errors.As(err, &syntaxErr):
+		return ierrors.ErrorDecode("", syntaxErr.Offset, syntaxErr.Error())
+	case errors.As(err, &typeErr):
+		return ierrors.ErrorDecode(typeErr.Field, typeErr.Offset, "expected "+typeErr.Type.String()+" but got "+typeErr.Value)
+	}
+
+	// The decoder has no type for the unknown fields, their name is in the message and it only reports them once the
+	// whole value is decoded, so the position is the one of the key in the body
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		field = strings.Trim(field, `"`)
+		return ierrors.ErrorDecode(field, keyOffset(body, field, offset), "unknown field")
+	}
+
+	// The errors of the UnmarshalJSON methods, like the dates that are not RFC 3339
+	return ierrors.ErrorDecode("", offset, err.Error())
+}
+
+// keyOffset returns the offset of the first key of the body with the given name, or the default offset if there is none
+func keyOffset(body []byte, key string, def int64) int64 {
+	quoted, err := json.Marshal(key)
+	if err != nil {
+		return def
+	}
+
+	for i := 0; i < len(body); {
+		n := bytes.Index(body[i:], quoted)
+		if n < 0 {
+			break
+		}
+		start := i + n
+		i = start + len(quoted)
+
+		rest := bytes.TrimLeft(body[i:], " \t\r\n")
+		if len(rest) > 0 && rest[0] == ':' {
+			return int64(start)
+		}
+	}
+
+	return def
+}
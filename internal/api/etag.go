@@ -0,0 +1,70 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+)
+
+const (
+	HeaderETag        = "ETag"
+	HeaderIfMatch     = "If-Match"
+	HeaderIfNoneMatch = "If-None-Match"
+)
+
+// setETag returns the version of the entity of the response as its ETag
+func (a *Api) setETag(w http.ResponseWriter, version int) {
+	w.Header().Set(HeaderETag, strconv.Quote(strconv.Itoa(version)))
+}
+
+// notModified sets the ETag of the entity and answers 304 if it matches the If-None-Match header of the request,
+// the caller must not write the response when it returns true
+func (a *Api) notModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	a.setETag(w, version)
+
+	header := r.Header.Get(HeaderIfNoneMatch)
+	if header == "" {
+		return false
+	}
+
+	etag := w.Header().Get(HeaderETag)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		// If-None-Match uses the weak comparison
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return true
+		}
+	}
+
+	return false
+}
+
+// preconditions requires the entity changed by the request to have one of the versions of the If-Match header, the
+// weak and malformed ETags never match, a * matches any version
+func (a *Api) preconditions(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get(HeaderIfMatch)
+		if header == "" || strings.TrimSpace(header) == "*" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		versions := []int{}
+		for _, tag := range strings.Split(header, ",") {
+			unquoted, err := strconv.Unquote(strings.TrimSpace(tag))
+			if err != nil {
+				continue
+			}
+			v, err := strconv.Atoi(unquoted)
+			if err != nil {
+				continue
+			}
+			versions = append(versions, v)
+		}
+
+		next.ServeHTTP(w, r.WithContext(datamodel.ContextWithIfMatch(r.Context(), versions)))
+	})
+}
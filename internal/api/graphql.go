@@ -0,0 +1,30 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/think-free/ABCFitness-challenge/internal/graphqlapi"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// GraphQL accepts a graphql query as json in the body and returns the graphql result as is, without the envelope of
+// the other responses, so the graphql clients can read it. The errors of the query are reported in the result
+func (a *Api) GraphQL(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var req graphqlapi.Request
+	err := a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	res := a.graphql.Execute(ctx, &req)
+
+	w.Header().Set("Content-Type", MediaTypeJSON)
+	err = json.NewEncoder(w).Encode(res)
+	if err != nil {
+		logging.Logger(ctx).Errorf("error encoding graphql result : %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package api
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/idempotency"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+
+	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+const (
+	HeaderIdempotencyKey      = "Idempotency-Key"
+	HeaderIdempotentReplayed  = "Idempotent-Replayed"
+	maxIdempotencyKeyLength   = 255
+	idempotencyAnonymousScope = "-"
+)
+
+// idempotent replays the response of the first request sent with the same Idempotency-Key header instead of running
+// the handler again. The keys are scoped by principal and the key can't be reused for another request. The server errors
+// and the panics are not stored so the request can be retried
+func (a *Api) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(HeaderIdempotencyKey)
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		ctx := logging.ContextWithLogger(r.Context())
+		log := logging.Logger(ctx)
+
+		log.SetTag("api.idempotency_key", key)
+
+		if len(key) > maxIdempotencyKeyLength {
+			log.Errorf("idempotency key too long : %d bytes", len(key))
+			err := ierrors.ErrorValidationError()
+			http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+			return
+		}
+
+		a.limitBody(w, r)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			log.Errorf("error reading request : %v", err)
+			err = decodeError(err, nil, 0)
+			http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		scope := idempotencyAnonymousScope
+		if p := auth.PrincipalFromContext(ctx); p != nil {
+			scope = p.ID
+		}
+		key = scope + " " + key
+
+		sum := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+		fingerprint := hex.EncodeToString(sum[:])
+
+		stored, err := a.idempotency.Begin(ctx, key, fingerprint)
+		if err != nil {
+			log.Errorf("error reserving idempotency key : %v", err)
+			http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+			return
+		}
+
+		if stored != nil {
+			log.Debugf("replaying response of idempotency key")
+			for k, v := range stored.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set(HeaderIdempotentReplayed, "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		// A panicking handler doesn't complete the key, it is released so the request can be retried and the panic goes on
+		defer func() {
+			if p := recover(); p != nil {
+				err := a.idempotency.Release(ctx, key)
+				if err != nil {
+					log.Errorf("error releasing idempotency key : %v", err)
+				}
+				panic(p)
+			}
+		}()
+
+		rec := newResponseRecorder()
+		next(rec, r)
+
+		for k, v := range rec.header {
+			w.Header()[k] = v
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+
+		if rec.status >= http.StatusInternalServerError {
+			err = a.idempotency.Release(ctx, key)
+		} else {
+			err = a.idempotency.Complete(ctx, key, &idempotency.Response{
+				Status: rec.status,
+				Header: rec.header.Clone(),
+				Body:   rec.body.Bytes(),
+			})
+		}
+		if err != nil {
+			log.Errorf("error storing response of idempotency key : %v", err)
+		}
+	}
+}
+
+// responseRecorder buffers the response of a handler so it can be stored before being sent
+type responseRecorder struct {
+	header      http.Header
+	body        bytes.Buffer
+	status      int
+	wroteHeader bool
+}
+
+func newResponseRecorder() *responseRecorder {
+	return &responseRecorder{
+		header: make(http.Header),
+		status: http.StatusOK,
+	}
+}
+
+func (rr *responseRecorder) Header() http.Header {
+	return rr.header
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.wroteHeader {
+		return
+	}
+	rr.status = status
+	rr.wroteHeader = true
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	rr.wroteHeader = true
+	return rr.body.Write(b)
+}
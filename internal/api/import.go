@@ -0,0 +1,304 @@
+package api
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+
+	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+const (
+	MediaTypeCSV    = "text/csv"
+	MediaTypeNDJSON = "application/x-ndjson"
+
+	// maxImportRows is the maximum number of rows of an import, bigger files must be split
+	maxImportRows = 10000
+)
+
+// userColumns are the columns accepted in the csv of users, the memberships are set by the staff once imported
+var userColumns = []string{"name", "surname", "email", "phone", "studio"}
+
+// classColumns are the columns accepted in the csv of classes, the rules can only be imported with ndjson
+var classColumns = []string{"studio", "room", "class_name", "start_date", "end_date", "duration", "capacity"}
+
+// ImportUsers accept users as csv or ndjson in the body and returns an ImportReport as json in the data field, it accepts dry_run as query param
+func (a *Api) ImportUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var rows []*datamodel.UserImportRow
+	add := func(line int, req *datamodel.CreateUserRequest, err error) {
+		row := &datamodel.UserImportRow{Line: line, Request: req}
+		if err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+
+	err := a.readImport(w, r,
+		func(line int, values map[string]string) {
+			req, err := parseUserRecord(values)
+			add(line, req, err)
+		},
+		func(line int, data []byte) {
+			// A row with a membership is invalid instead of creating the user with the unlimited plan
+			var req datamodel.CreateUserRequest
+			err := decodeStrict(data, &req)
+			add(line, &req, err)
+		},
+		userColumns,
+	)
+	if err != nil {
+		logging.Logger(ctx).Errorf("error reading import : %v", err)
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	resp, err := a.srv.ImportUsers(ctx, rows, dryRun)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// ImportClasses accept classes as csv or ndjson in the body and returns an ImportReport as json in the data field, it accepts dry_run as query param
+func (a *Api) ImportClasses(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var rows []*datamodel.ClassImportRow
+	add := func(line int, req *datamodel.CreateClassRequest, err error) {
+		row := &datamodel.ClassImportRow{Line: line, Request: req}
+		if err != nil {
+			row.Error = err.Error()
+		}
+		rows = append(rows, row)
+	}
+
+	err := a.readImport(w, r,
+		func(line int, values map[string]string) {
+			req, err := parseClassRecord(values)
+			add(line, req, err)
+		},
+		func(line int, data []byte) {
+			var req datamodel.CreateClassRequest
+			err := decodeStrict(data, &req)
+			add(line, &req, err)
+		},
+		classColumns,
+	)
+	if err != nil {
+		logging.Logger(ctx).Errorf("error reading import : %v", err)
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	dryRun, _ := strconv.ParseBool(r.URL.Query().Get("dry_run"))
+
+	resp, err := a.srv.ImportClasses(ctx, rows, dryRun)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// readImport reads the body of the request as csv or ndjson according to its content type and calls the function of
+// the format for each row. It only fails if the whole file can't be read, the errors of a row are left to the functions
+func (a *Api) readImport(w http.ResponseWriter, r *http.Request, csvRow func(line int, values map[string]string), ndjsonRow func(line int, data []byte), columns []string) error {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ierrors.ErrorUnsupportedMediaType()
+	}
+
+	a.limitBody(w, r)
+
+	switch mediaType {
+	case MediaTypeCSV:
+		err = readCSV(r.Body, columns, csvRow)
+	case MediaTypeNDJSON, "application/ndjson", "application/jsonl":
+		err = readNDJSON(r.Body, ndjsonRow)
+	default:
+		return ierrors.ErrorUnsupportedMediaType()
+	}
+
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return ierrors.ErrorRequestTooLarge()
+	}
+
+	return err
+}
+
+// readCSV reads a csv whose first line names the columns, only the given columns are accepted and at most maxImportRows. The rows that can't
+// be parsed are passed without values so they are reported as invalid
+func readCSV(body io.Reader, columns []string, fn func(line int, values map[string]string)) error {
+	cr := csv.NewReader(body)
+	cr.TrimLeadingSpace = true
+
+	header, err := cr.Read()
+	if err != nil {
+		var pe *csv.ParseError
+		if errors.As(err, &pe) || errors.Is(err, io.EOF) {
+			return ierrors.ErrorValidationError()
+		}
+		return err
+	}
+
+	for i, h := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(h))
+		if !contains(columns, header[i]) {
+			return ierrors.ErrorValidationError()
+		}
+	}
+
+	count := 0
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		count++
+		if count > maxImportRows {
+			return ierrors.ErrorValidationError()
+		}
+
+		line, _ := cr.FieldPos(0)
+		if err != nil {
+			// Only the rows that are not valid csv are reported, the body that can't be read fails the whole import
+			var pe *csv.ParseError
+			if !errors.As(err, &pe) {
+				return err
+			}
+			fn(pe.StartLine, nil)
+			continue
+		}
+
+		values := make(map[string]string, len(header))
+		for i, h := range header {
+			values[h] = strings.TrimSpace(record[i])
+		}
+		fn(line, values)
+	}
+}
+
+// readNDJSON reads a json object per line, at most maxImportRows, the empty lines are skipped
+func readNDJSON(body io.Reader, fn func(line int, data []byte)) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	line, count := 0, 0
+	for scanner.Scan() {
+		line++
+		data := scanner.Bytes()
+		if len(strings.TrimSpace(string(data))) == 0 {
+			continue
+		}
+
+		count++
+		if count > maxImportRows {
+			return ierrors.ErrorValidationError()
+		}
+
+		fn(line, data)
+	}
+
+	return scanner.Err()
+}
+
+// parseUserRecord returns the user of a csv record, a nil record is a line that couldn't be read
+func parseUserRecord(values map[string]string) (*datamodel.CreateUserRequest, error) {
+	if values == nil {
+		return nil, ierrors.ErrorValidationError()
+	}
+
+	req := &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{
+			Name:    values["name"],
+			Surname: values["surname"],
+			Email:   values["email"],
+			Phone:   values["phone"],
+		},
+		Studio: values["studio"],
+	}
+
+	return req, nil
+}
+
+// parseClassRecord returns the class of a csv record, a nil record is a line that couldn't be read
+func parseClassRecord(values map[string]string) (*datamodel.CreateClassRequest, error) {
+	if values == nil {
+		return nil, ierrors.ErrorValidationError()
+	}
+
+	req := &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Studio: values["studio"],
+			Room:   values["room"],
+			Name:   values["class_name"],
+		},
+	}
+
+	for column, date := range map[string]**time.Time{"start_date": &req.StartDate, "end_date": &req.EndDate} {
+		if values[column] == "" {
+			continue
+		}
+		d, err := time.Parse(time.RFC3339, values[column])
+		if err != nil {
+			return nil, fmt.Errorf("%s : invalid %s", ierrors.ValidationError, column)
+		}
+		*date = &d
+	}
+
+	var err error
+	req.Duration, err = parseOptionalInt(values, "duration")
+	if err != nil {
+		return nil, err
+	}
+	req.DailyCapacity, err = parseOptionalInt(values, "capacity")
+	if err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
+// parseOptionalInt returns the integer of the column, 0 if the column is empty or missing
+func parseOptionalInt(values map[string]string, column string) (int, error) {
+	if values[column] == "" {
+		return 0, nil
+	}
+
+	v, err := strconv.Atoi(values[column])
+	if err != nil {
+		return 0, fmt.Errorf("%s : invalid %s", ierrors.ValidationError, column)
+	}
+
+	return v, nil
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
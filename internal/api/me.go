@@ -0,0 +1,126 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+
+	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+// GetMe returns the User of the authenticated principal as json in the data field
+func (a *Api) GetMe(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	p, err := a.principal(ctx)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	resp, err := a.srv.GetUser(ctx, p.ID)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	if a.notModified(w, r, resp.Version) {
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// ListMyBookings returns the Bookings of the authenticated principal as json in the data field
+func (a *Api) ListMyBookings(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	p, err := a.principal(ctx)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	resp, err := a.srv.ListUserBookings(ctx, p.ID)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// CreateMyBooking accept a CreateOwnBookingRequest as json in the body and returns a Booking of the authenticated principal as json in the data field
+func (a *Api) CreateMyBooking(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	p, err := a.principal(ctx)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	var req datamodel.CreateOwnBookingRequest
+	err = a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	resp, err := a.srv.CreateBooking(ctx, &datamodel.CreateBookingRequest{
+		BaseBooking: datamodel.BaseBooking{
+			ClassID: req.ClassID,
+			UserID:  p.ID,
+			Date:    req.Date,
+		},
+	})
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+
+	w.WriteHeader(http.StatusCreated)
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// CancelMyBooking cancels the Booking with the id of the path if it belongs to the authenticated principal and returns it as json in the data field
+func (a *Api) CancelMyBooking(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	p, err := a.principal(ctx)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	resp, err := a.srv.CancelUserBooking(ctx, p.ID, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// principal returns the authenticated principal of the request, the /me routes can't be resolved without it
+func (a *Api) principal(ctx context.Context) (*auth.Principal, error) {
+	p := auth.PrincipalFromContext(ctx)
+	if p == nil {
+		logging.Logger(ctx).Errorf("no authenticated principal to resolve the current user")
+		return nil, ierrors.ErrorUnauthorized()
+	}
+
+	return p, nil
+}
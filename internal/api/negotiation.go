@@ -0,0 +1,172 @@
+package api
+
+import (
+	"context"
+	"encoding/csv"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+)
+
+const (
+	MediaTypeJSON = "application/json"
+
+	HeaderAccept = "Accept"
+)
+
+type mediaTypeKey struct{}
+
+// negotiate stores in the context of the request the format of the response preferred by its Accept header
+func (a *Api) negotiate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mediaType := negotiateMediaType(r.Header.Get(HeaderAccept))
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), mediaTypeKey{}, mediaType)))
+	})
+}
+
+// negotiateMediaType returns the supported media type with the highest quality in the Accept header, json by default
+func negotiateMediaType(accept string) string {
+	type mediaRange struct {
+		mediaType string
+		q         float64
+	}
+
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+		}
+
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType: mediaType, q: q})
+		}
+	}
+
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, mr := range ranges {
+		switch mr.mediaType {
+		case MediaTypeCSV:
+			return MediaTypeCSV
+		case MediaTypeJSON, "application/*", "*/*":
+			return MediaTypeJSON
+		}
+	}
+
+	return MediaTypeJSON
+}
+
+// mediaTypeFromContext returns the format of the response negotiated for the request
+func mediaTypeFromContext(ctx context.Context) string {
+	mediaType, ok := ctx.Value(mediaTypeKey{}).(string)
+	if !ok {
+		return MediaTypeJSON
+	}
+	return mediaType
+}
+
+// writeCSV writes the value as a csv table if its type has a table representation, it returns false otherwise
+func writeCSV(w http.ResponseWriter, v interface{}) (bool, error) {
+	header, rows, ok := csvTable(v)
+	if !ok {
+		return false, nil
+	}
+
+	w.Header().Set("Content-Type", MediaTypeCSV+"; charset=utf-8")
+
+	cw := csv.NewWriter(w)
+	err := cw.Write(header)
+	if err != nil {
+		return true, err
+	}
+
+	for _, row := range rows {
+		for i := range row {
+			row[i] = escapeCSVCell(row[i])
+		}
+		err = cw.Write(row)
+		if err != nil {
+			return true, err
+		}
+	}
+
+	cw.Flush()
+	return true, cw.Error()
+}
+
+// csvTable returns the columns and the rows of the lists that can be exported as csv
+func csvTable(v interface{}) ([]string, [][]string, bool) {
+	switch list := v.(type) {
+	case []*datamodel.Booking:
+		rows := make([][]string, 0, len(list))
+		for _, b := range list {
+			rows = append(rows, []string{b.ID, b.UserID, b.ClassID, formatCSVTime(&b.Date), string(b.Status), formatCSVTime(b.CheckedInAt), formatCSVTime(b.CancelledAt), strconv.Itoa(b.Version)})
+		}
+		return []string{"id", "user", "class", "date", "status", "checked_in_at", "cancelled_at", "version"}, rows, true
+
+	case []*datamodel.Class:
+		rows := make([][]string, 0, len(list))
+		for _, c := range list {
+			rows = append(rows, []string{c.ID, c.Studio, c.Room, c.Name, formatCSVTime(c.StartDate), formatCSVTime(c.EndDate), strconv.Itoa(c.Duration), strconv.Itoa(c.DailyCapacity), strconv.Itoa(c.Version)})
+		}
+		return []string{"id", "studio", "room", "class_name", "start_date", "end_date", "duration", "capacity", "version"}, rows, true
+
+	case []*datamodel.Attendee:
+		rows := make([][]string, 0, len(list))
+		for _, at := range list {
+			rows = append(rows, []string{at.BookingID, formatCSVTime(&at.Date), string(at.Status), formatCSVTime(at.CheckedInAt), at.UserID, at.Name, at.Surname, at.Email, at.Phone})
+		}
+		return []string{"booking", "date", "status", "checked_in_at", "user", "name", "surname", "email", "phone"}, rows, true
+
+	case []*datamodel.Availability:
+		rows := make([][]string, 0, len(list))
+		for _, av := range list {
+			rows = append(rows, []string{av.ClassID, av.Date.Format(time.DateOnly), strconv.Itoa(av.Capacity), strconv.Itoa(av.Booked), strconv.Itoa(av.Remaining)})
+		}
+		return []string{"class", "date", "capacity", "booked", "remaining"}, rows, true
+
+	default:
+		return nil, nil, false
+	}
+}
+
+func formatCSVTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// escapeCSVCell prevents the spreadsheets from running a cell as a formula, the signed numbers like the phones are kept
+func escapeCSVCell(cell string) string {
+	if cell == "" {
+		return cell
+	}
+
+	switch cell[0] {
+	case '=', '@', '\t', '\r':
+		return "'" + cell
+	case '+', '-':
+		if strings.Trim(cell[1:], "0123456789 ") != "" {
+			return "'" + cell
+		}
+	}
+
+	return cell
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// openAPIPath is the route of the specification, it is public so the clients can read it before authenticating
+const openAPIPath = "/openapi.json"
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// OpenAPI returns the OpenAPI 3 specification of the api as is, without the envelope of the other responses
+func (a *Api) OpenAPI(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	w.Header().Set("Content-Type", MediaTypeJSON)
+	_, err := w.Write(openAPISpec)
+	if err != nil {
+		logging.Logger(ctx).Errorf("error writing openapi specification : %v", err)
+	}
+}
+
+// Routes returns the routes of the api as "METHOD path", the specification must describe all of them
+func (a *Api) Routes() []string {
+	var routes []string
+
+	_ = a.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, m := range methods {
+			routes = append(routes, strings.ToUpper(m)+" "+path)
+		}
+		return nil
+	})
+
+	return routes
+}
@@ -19,6 +19,9 @@ type Response struct {
 	Status   string          `json:"status"`
 	Data     json.RawMessage `json:"data,omitempty"`
 	Metadata Metadata        `json:"metadata"`
+
+	// value is the data before its encoding, used to encode it in another format than json
+	value interface{}
 }
 
 type Metadata struct {
@@ -33,6 +36,7 @@ func NewResponse(ctx context.Context, data interface{}) *Response {
 	r := &Response{
 		Status: StatusOK,
 		Data:   dt,
+		value:  data,
 		Metadata: Metadata{
 			CreatedAt: time.Now().Format(time.RFC3339),
 		},
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// CreateWebhook accept a CreateWebhookRequest as json in the body and returns the Webhook with its secret as json in the data field
+func (a *Api) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var req datamodel.CreateWebhookRequest
+	err := a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	resp, err := a.srv.CreateWebhook(ctx, &req)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+
+	w.WriteHeader(http.StatusCreated)
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// ListWebhooks returns a list of Webhooks as json in the data field, it accepts offset and count as query params
+func (a *Api) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	req := a.getListRequestParams(ctx, r)
+
+	resp, err := a.srv.ListWebhooks(ctx, req)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// GetWebhook returns the Webhook with the id of the path as json in the data field, it honors If-None-Match
+func (a *Api) GetWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.GetWebhook(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	if a.notModified(w, r, resp.Version) {
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// UpdateWebhook accept an UpdateWebhookRequest as json in the body and returns the updated Webhook as json in the data field, it honors If-Match
+func (a *Api) UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	var req datamodel.UpdateWebhookRequest
+	err := a.decodeRequest(ctx, w, r, &req)
+	if err != nil {
+		return
+	}
+
+	resp, err := a.srv.UpdateWebhook(ctx, mux.Vars(r)["id"], &req)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.setETag(w, resp.Version)
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// DeleteWebhook removes the Webhook with the id of the path and returns it as json in the data field, it honors If-Match
+func (a *Api) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.DeleteWebhook(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+// ListWebhookDeliveries returns the log of the deliveries of the Webhook of the path as json in the data field, it
+// accepts status, offset and count as query params
+func (a *Api) ListWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	list := a.getListRequestParams(ctx, r)
+
+	a.listWebhookDeliveries(ctx, w, &datamodel.WebhookDeliveryFilter{
+		WebhookID: mux.Vars(r)["id"],
+		Status:    datamodel.WebhookDeliveryStatus(r.URL.Query().Get("status")),
+		Offset:    list.Offset,
+		Count:     list.Count,
+	})
+}
+
+// ListDeadLetters returns the deliveries that failed all their attempts as json in the data field, it accepts
+// webhook, offset and count as query params
+func (a *Api) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	list := a.getListRequestParams(ctx, r)
+
+	a.listWebhookDeliveries(ctx, w, &datamodel.WebhookDeliveryFilter{
+		WebhookID: r.URL.Query().Get("webhook"),
+		Status:    datamodel.WebhookDeliveryDead,
+		Offset:    list.Offset,
+		Count:     list.Count,
+	})
+}
+
+// RetryDeadLetter sends again the dead delivery of the path and returns it as json in the data field
+func (a *Api) RetryDeadLetter(w http.ResponseWriter, r *http.Request) {
+	ctx := logging.ContextWithLogger(r.Context())
+	a.tagRequest(ctx, r)
+
+	resp, err := a.srv.RetryWebhookDelivery(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
+
+func (a *Api) listWebhookDeliveries(ctx context.Context, w http.ResponseWriter, f *datamodel.WebhookDeliveryFilter) {
+	resp, err := a.srv.ListWebhookDeliveries(ctx, f)
+	if err != nil {
+		http.Error(w, NewErrorResponse(ctx, err).String(), a.getHttpStatusForError(ctx, err))
+		return
+	}
+
+	a.writeResponse(ctx, w, NewResponse(ctx, resp))
+}
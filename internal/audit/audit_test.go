@@ -0,0 +1,71 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/think-free/ABCFitness-challenge/internal/audit"
+	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+)
+
+func TestSinks(t *testing.T) {
+	for _, name := range []string{audit.SinkMemory, audit.SinkFile} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			cp := cliparams.New()
+			cp.AuditSink = name
+			cp.AuditFile = filepath.Join(t.TempDir(), "audit.log")
+
+			sink, err := audit.New(ctx, cp)
+			assert.NoError(t, err)
+
+			entries := []*datamodel.AuditEntry{
+				{ID: "1", Timestamp: time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), Actor: "admin", Action: datamodel.AuditActionCreate, Entity: datamodel.AuditEntityUser, EntityID: "u1", After: json.RawMessage(`{"id":"u1"}`)},
+				{ID: "2", Timestamp: time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC), Actor: "admin", Action: datamodel.AuditActionCreate, Entity: datamodel.AuditEntityClass, EntityID: "c1"},
+				{ID: "3", Timestamp: time.Date(2023, 10, 3, 0, 0, 0, 0, time.UTC), Actor: "system", Action: datamodel.AuditActionUpdate, Entity: datamodel.AuditEntityUser, EntityID: "u1", RequestID: "r1"},
+			}
+			for _, e := range entries {
+				assert.NoError(t, sink.Append(ctx, e))
+			}
+
+			all, err := sink.List(ctx, &datamodel.AuditFilter{})
+			assert.NoError(t, err)
+			assert.Len(t, all, 3)
+			assert.Equal(t, entries[0].ID, all[0].ID)
+			assert.JSONEq(t, string(entries[0].After), string(all[0].After))
+			assert.Equal(t, "r1", all[2].RequestID)
+
+			user, err := sink.List(ctx, &datamodel.AuditFilter{Entity: datamodel.AuditEntityUser, EntityID: "u1"})
+			assert.NoError(t, err)
+			assert.Len(t, user, 2)
+
+			system, err := sink.List(ctx, &datamodel.AuditFilter{Actor: "system"})
+			assert.NoError(t, err)
+			assert.Len(t, system, 1)
+			assert.Equal(t, "3", system[0].ID)
+
+			page, err := sink.List(ctx, &datamodel.AuditFilter{Offset: 1, Count: 1})
+			assert.NoError(t, err)
+			assert.Len(t, page, 1)
+			assert.Equal(t, "2", page[0].ID)
+
+			page, err = sink.List(ctx, &datamodel.AuditFilter{Offset: 5})
+			assert.NoError(t, err)
+			assert.Empty(t, page)
+		})
+	}
+}
+
+func TestUnknownSink(t *testing.T) {
+	cp := cliparams.New()
+	cp.AuditSink = "unknown"
+
+	_, err := audit.New(context.Background(), cp)
+	assert.Error(t, err)
+}
@@ -0,0 +1,34 @@
+package audit
+
+import "context"
+
+type t string
+
+var (
+	requestIDKey       t = "request_id"
+	clientRequestIDKey t = "client_request_id"
+)
+
+// ContextWithRequestID returns a copy of the context holding the id of the request, recorded in the audit entries
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the id of the request of the context, or an empty string outside of a request
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// ContextWithClientRequestID returns a copy of the context holding the id the client sent for the request, recorded
+// next to the id generated by the server to correlate the calls across services
+func ContextWithClientRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, clientRequestIDKey, id)
+}
+
+// ClientRequestIDFromContext returns the id the client sent for the request of the context, or an empty string if it
+// sent none
+func ClientRequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(clientRequestIDKey).(string)
+	return id
+}
@@ -0,0 +1,90 @@
+package file
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+)
+
+// File implements the audit Sink interface with a file of json lines only opened in append mode
+type File struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+func New(ctx context.Context, path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		path: path,
+		f:    f,
+	}, nil
+}
+
+// Append writes the entry as a json line and syncs the file so the entry survives a crash
+func (fl *File) Append(ctx context.Context, e *datamodel.AuditEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	_, err = fl.f.Write(append(line, '\n'))
+	if err != nil {
+		return err
+	}
+
+	return fl.f.Sync()
+}
+
+// List reads the whole file and returns the entries matching the filter
+func (fl *File) List(ctx context.Context, f *datamodel.AuditFilter) ([]*datamodel.AuditEntry, error) {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	rf, err := os.Open(fl.path)
+	if err != nil {
+		return nil, err
+	}
+	defer rf.Close()
+
+	var entries []*datamodel.AuditEntry
+
+	scanner := bufio.NewScanner(rf)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var e datamodel.AuditEntry
+		err = json.Unmarshal(scanner.Bytes(), &e)
+		if err != nil {
+			return nil, err
+		}
+
+		if f.Matches(&e) {
+			entries = append(entries, &e)
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return f.Page(entries), nil
+}
+
+// Close closes the file, the sink can't be used anymore
+func (fl *File) Close() error {
+	fl.mu.Lock()
+	defer fl.mu.Unlock()
+
+	return fl.f.Close()
+}
@@ -0,0 +1,42 @@
+package audit
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/think-free/ABCFitness-challenge/internal/audit/file"
+	"github.com/think-free/ABCFitness-challenge/internal/audit/memory"
+	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+const (
+	SinkMemory = "memory"
+	SinkFile   = "file"
+)
+
+// Sink is an append-only store of audit entries
+type Sink interface {
+	Append(ctx context.Context, e *datamodel.AuditEntry) error
+	List(ctx context.Context, f *datamodel.AuditFilter) ([]*datamodel.AuditEntry, error)
+}
+
+func New(ctx context.Context, cp *cliparams.ClientParameters) (Sink, error) {
+	log := logging.Logger(ctx)
+
+	log.Infof("initializing audit sink '%s'", cp.AuditSink)
+
+	switch cp.AuditSink {
+	case SinkMemory:
+		return memory.New(ctx), nil
+	case SinkFile:
+		f, err := file.New(ctx, cp.AuditFile)
+		if err != nil {
+			return nil, err
+		}
+		return f, nil
+	default:
+		return nil, fmt.Errorf("unknown audit sink '%s'", cp.AuditSink)
+	}
+}
@@ -0,0 +1,40 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+)
+
+// Memory implements the audit Sink interface with a memory list that is not persistent
+type Memory struct {
+	mu      sync.RWMutex
+	entries []*datamodel.AuditEntry
+}
+
+func New(ctx context.Context) *Memory {
+	return &Memory{}
+}
+
+func (m *Memory) Append(ctx context.Context, e *datamodel.AuditEntry) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.entries = append(m.entries, e)
+	return nil
+}
+
+func (m *Memory) List(ctx context.Context, f *datamodel.AuditFilter) ([]*datamodel.AuditEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var entries []*datamodel.AuditEntry
+	for _, e := range m.entries {
+		if f.Matches(e) {
+			entries = append(entries, e)
+		}
+	}
+
+	return f.Page(entries), nil
+}
@@ -0,0 +1,143 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+const (
+	HeaderAPIKey        = "X-API-Key"
+	HeaderAuthorization = "Authorization"
+)
+
+// Config of the authenticator, an empty config disables the authentication
+type Config struct {
+	// APIKeys is a comma separated list of key:subject:role[:studio]
+	APIKeys string
+	// JWTSecret is the shared secret of the HS256 tokens
+	JWTSecret string
+	// JWTPublicKey is the path of the PEM encoded RSA public key of the RS256 tokens
+	JWTPublicKey string
+}
+
+// Authenticator authenticates the requests with static API keys or JWT bearer tokens
+type Authenticator struct {
+	apiKeys   map[string]*Principal
+	jwtSecret []byte
+	jwtKey    *rsa.PublicKey
+	now       func() time.Time
+}
+
+func New(cfg *Config) (*Authenticator, error) {
+	a := &Authenticator{
+		apiKeys: make(map[string]*Principal),
+		now:     time.Now,
+	}
+
+	for _, entry := range strings.Split(cfg.APIKeys, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		fields := strings.SplitN(entry, ":", 4)
+		if len(fields) < 3 || fields[0] == "" || fields[1] == "" {
+			return nil, fmt.Errorf("invalid api key entry, expected key:subject:role[:studio]")
+		}
+
+		p := &Principal{
+			ID:     fields[1],
+			Role:   fields[2],
+			Method: MethodAPIKey,
+		}
+		if len(fields) == 4 {
+			p.Studio = fields[3]
+		}
+		a.apiKeys[fields[0]] = p
+	}
+
+	if cfg.JWTSecret != "" {
+		a.jwtSecret = []byte(cfg.JWTSecret)
+	}
+
+	if cfg.JWTPublicKey != "" {
+		key, err := loadRSAPublicKey(cfg.JWTPublicKey)
+		if err != nil {
+			return nil, err
+		}
+		a.jwtKey = key
+	}
+
+	return a, nil
+}
+
+// Enabled returns true if at least one authentication method is configured
+func (a *Authenticator) Enabled() bool {
+	return a != nil && (len(a.apiKeys) > 0 || a.jwtSecret != nil || a.jwtKey != nil)
+}
+
+// Authenticate returns the principal of the request from its api key header or its bearer token
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	return a.AuthenticateCredentials(r.Header.Get(HeaderAPIKey), r.Header.Get(HeaderAuthorization))
+}
+
+// AuthenticateCredentials returns the principal of an api key or of a bearer authorization, the api key is used if
+// both are set. It is used by the transports that don't carry an http request
+func (a *Authenticator) AuthenticateCredentials(apiKey, authorization string) (*Principal, error) {
+	if apiKey != "" {
+		p, ok := a.apiKeys[apiKey]
+		if !ok {
+			return nil, errors.ErrorUnauthorized()
+		}
+		return p, nil
+	}
+
+	scheme, token, found := strings.Cut(authorization, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return nil, errors.ErrorUnauthorized()
+	}
+
+	p, err := a.verifyJWT(strings.TrimSpace(token))
+	if err != nil {
+		return nil, errors.ErrorUnauthorized()
+	}
+
+	return p, nil
+}
+
+func loadRSAPublicKey(path string) (*rsa.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no pem block found in '%s'", path)
+	}
+
+	switch block.Type {
+	case "RSA PUBLIC KEY":
+		return x509.ParsePKCS1PublicKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return nil, fmt.Errorf("public key of '%s' is not a rsa key", path)
+		}
+		return rsaKey, nil
+	default:
+		return nil, fmt.Errorf("unsupported pem block '%s' in '%s'", block.Type, path)
+	}
+}
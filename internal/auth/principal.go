@@ -0,0 +1,31 @@
+package auth
+
+import "context"
+
+type t string
+
+var principalKey t = "principal"
+
+const (
+	MethodAPIKey = "api_key"
+	MethodJWT    = "jwt"
+)
+
+// Principal is the authenticated caller of a request
+type Principal struct {
+	ID     string `json:"id"`
+	Role   string `json:"role,omitempty"`
+	Studio string `json:"studio,omitempty"`
+	Method string `json:"method"`
+}
+
+// ContextWithPrincipal returns a copy of the context holding the principal
+func ContextWithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
+
+// PrincipalFromContext returns the principal of the context, or nil if the request was not authenticated
+func PrincipalFromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey).(*Principal)
+	return p
+}
@@ -1,12 +1,97 @@
 package cliparams
 
 import (
+	"errors"
+	"fmt"
+	"time"
+
 	"github.com/kelseyhightower/envconfig"
 )
 
 type ClientParameters struct {
-	DatabaseType string `envconfig:"dbtype" required:"false" default:"memory"`
-	LogLevel     string `envconfig:"loglevel" required:"false" default:"debug"`
+	DatabaseType   string        `envconfig:"dbtype" required:"false" default:"memory"`
+	LogLevel       string        `envconfig:"loglevel" required:"false" default:"debug"`
+	LogPII         string        `envconfig:"logpii" required:"false" default:"redact"`
+	LogPIISalt     string        `envconfig:"logpiisalt" required:"false"`
+	NoShowInterval time.Duration `envconfig:"noshowinterval" required:"false" default:"1m"`
+
+	// No-show policy, a user with NoShowLimit no-shows within NoShowWindow is suspended for SuspensionPeriod, disabled if NoShowLimit is 0
+	NoShowLimit      int           `envconfig:"noshowlimit" required:"false" default:"0"`
+	NoShowWindow     time.Duration `envconfig:"noshowwindow" required:"false" default:"720h"`
+	SuspensionPeriod time.Duration `envconfig:"suspensionperiod" required:"false" default:"168h"`
+
+	// Audit trail of the mutations, AuditFile is used by the file sink
+	AuditSink string `envconfig:"auditsink" required:"false" default:"memory"`
+	AuditFile string `envconfig:"auditfile" required:"false" default:"audit.log"`
+
+	// Responses of the POST requests with an Idempotency-Key are replayed during IdempotencyTTL
+	IdempotencyTTL time.Duration `envconfig:"idempotencyttl" required:"false" default:"24h"`
+
+	// The domain events saved in the outbox are published as soon as possible, the failed ones are retried every EventRelayInterval
+	EventRelayInterval time.Duration `envconfig:"eventrelayinterval" required:"false" default:"10s"`
+
+	// The webhook deliveries are sent as soon as possible, the retries are checked every WebhookInterval. A failed
+	// delivery is retried WebhookMaxAttempts times waiting from WebhookBackoff doubled after each attempt up to WebhookMaxBackoff
+	WebhookInterval    time.Duration `envconfig:"webhookinterval" required:"false" default:"5s"`
+	WebhookMaxAttempts int           `envconfig:"webhookmaxattempts" required:"false" default:"10"`
+	WebhookBackoff     time.Duration `envconfig:"webhookbackoff" required:"false" default:"30s"`
+	WebhookMaxBackoff  time.Duration `envconfig:"webhookmaxbackoff" required:"false" default:"6h"`
+
+	// The webhooks must be on public addresses unless WebhookAllowPrivate is set for the partners of local development
+	WebhookAllowPrivate bool `envconfig:"webhookallowprivate" required:"false" default:"false"`
+
+	// The json bodies of the rest api larger than MaxBodyBytes are rejected
+	MaxBodyBytes int64 `envconfig:"maxbodybytes" required:"false" default:"1048576"`
+
+	// The grpc api is served on GRPCPort next to the rest api on 8080
+	GRPCPort int `envconfig:"grpcport" required:"false" default:"9090"`
+
+	// Authentication, at least one of them is required unless AuthDisabled is set to make the api public for local development
+	APIKeys      string `envconfig:"apikeys" required:"false"`
+	JWTSecret    string `envconfig:"jwtsecret" required:"false"`
+	JWTPublicKey string `envconfig:"jwtpublickey" required:"false"`
+	AuthDisabled bool   `envconfig:"authdisabled" required:"false" default:"false"`
+}
+
+// Validate returns an error for the configurations the server must not start with
+func (cp *ClientParameters) Validate() error {
+	if cp.APIKeys == "" && cp.JWTSecret == "" && cp.JWTPublicKey == "" && !cp.AuthDisabled {
+		return errors.New("no authentication configured, set APIKEYS, JWTSECRET or JWTPUBLICKEY, or AUTHDISABLED=true to run a public api for local development")
+	}
+
+	// The intervals are the periods of the tickers of the background jobs, a ticker can't have a period of 0
+	if cp.NoShowInterval <= 0 {
+		return fmt.Errorf("NOSHOWINTERVAL must be positive, got %s", cp.NoShowInterval)
+	}
+	if cp.EventRelayInterval <= 0 {
+		return fmt.Errorf("EVENTRELAYINTERVAL must be positive, got %s", cp.EventRelayInterval)
+	}
+	if cp.WebhookInterval <= 0 {
+		return fmt.Errorf("WEBHOOKINTERVAL must be positive, got %s", cp.WebhookInterval)
+	}
+
+	// A delivery is attempted at least once and waits a positive backoff growing up to the maximum between attempts
+	if cp.WebhookMaxAttempts <= 0 {
+		return fmt.Errorf("WEBHOOKMAXATTEMPTS must be positive, got %d", cp.WebhookMaxAttempts)
+	}
+	if cp.WebhookBackoff <= 0 {
+		return fmt.Errorf("WEBHOOKBACKOFF must be positive, got %s", cp.WebhookBackoff)
+	}
+	if cp.WebhookMaxBackoff < cp.WebhookBackoff {
+		return fmt.Errorf("WEBHOOKMAXBACKOFF must not be below WEBHOOKBACKOFF %s, got %s", cp.WebhookBackoff, cp.WebhookMaxBackoff)
+	}
+
+	// A key kept for no time would let every retry run the request again
+	if cp.IdempotencyTTL <= 0 {
+		return fmt.Errorf("IDEMPOTENCYTTL must be positive, got %s", cp.IdempotencyTTL)
+	}
+
+	// A limit of 0 or below would reject every body, even the empty json object
+	if cp.MaxBodyBytes <= 0 {
+		return fmt.Errorf("MAXBODYBYTES must be positive, got %d", cp.MaxBodyBytes)
+	}
+
+	return nil
 }
 
 func New() *ClientParameters {
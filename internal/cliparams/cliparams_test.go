@@ -3,6 +3,7 @@ package cliparams_test
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
@@ -16,3 +17,75 @@ func TestXxx(t *testing.T) {
 	require.Equal(t, "test_dbtype", cp.DatabaseType)
 	require.Equal(t, "test_loglevel", cp.LogLevel)
 }
+
+func TestValidate(t *testing.T) {
+	valid := func() *cliparams.ClientParameters {
+		return &cliparams.ClientParameters{
+			JWTSecret:          "secret",
+			NoShowInterval:     time.Minute,
+			EventRelayInterval: time.Minute,
+			WebhookInterval:    time.Minute,
+			WebhookMaxAttempts: 10,
+			WebhookBackoff:     time.Second,
+			WebhookMaxBackoff:  time.Hour,
+			IdempotencyTTL:     time.Hour,
+			MaxBodyBytes:       1024,
+		}
+	}
+	require.NoError(t, valid().Validate())
+
+	// The server doesn't start without authentication unless it is disabled explicitly
+	cp := valid()
+	cp.JWTSecret = ""
+	require.Error(t, cp.Validate())
+
+	cp.AuthDisabled = true
+	require.NoError(t, cp.Validate())
+
+	// Nor with the intervals of the background jobs that are not positive
+	for _, interval := range []time.Duration{0, -time.Second} {
+		cp = valid()
+		cp.NoShowInterval = interval
+		require.Error(t, cp.Validate())
+
+		cp = valid()
+		cp.EventRelayInterval = interval
+		require.Error(t, cp.Validate())
+
+		cp = valid()
+		cp.WebhookInterval = interval
+		require.Error(t, cp.Validate())
+	}
+
+	// Nor with webhook retries that can't be scheduled
+	for _, attempts := range []int{0, -1} {
+		cp = valid()
+		cp.WebhookMaxAttempts = attempts
+		require.Error(t, cp.Validate())
+	}
+	for _, backoff := range []time.Duration{0, -time.Second} {
+		cp = valid()
+		cp.WebhookBackoff = backoff
+		require.Error(t, cp.Validate())
+	}
+
+	cp = valid()
+	cp.WebhookMaxBackoff = cp.WebhookBackoff
+	require.NoError(t, cp.Validate())
+	cp.WebhookMaxBackoff = cp.WebhookBackoff - time.Millisecond
+	require.Error(t, cp.Validate())
+
+	// Nor with idempotency keys that expire at once
+	for _, ttl := range []time.Duration{0, -time.Second} {
+		cp = valid()
+		cp.IdempotencyTTL = ttl
+		require.Error(t, cp.Validate())
+	}
+
+	// Nor with a body limit that rejects every request
+	for _, limit := range []int64{0, -1} {
+		cp = valid()
+		cp.MaxBodyBytes = limit
+		require.Error(t, cp.Validate())
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
 	"github.com/think-free/ABCFitness-challenge/internal/database"
 	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
 )
 
 // Testing the implementation
@@ -130,6 +131,80 @@ func TestListUsers(t *testing.T) {
 	users, err := db.ListUsers(ctx, 0, 0)
 	assert.NoError(t, err)
 	assert.ElementsMatch(t, []*datamodel.User{user1, user2}, users)
+
+	// The users are paged in the order they were saved
+	users, err = db.ListUsers(ctx, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*datamodel.User{user2}, users)
+
+	users, err = db.ListUsers(ctx, 0, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, []*datamodel.User{user1}, users)
+
+	users, err = db.ListUsers(ctx, 2, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, users)
+}
+
+func TestListWebhooks(t *testing.T) {
+	ctx := context.Background()
+	db := getDatabase(ctx)
+
+	var webhooks []*datamodel.Webhook
+	for _, id := range []string{"1", "2", "3"} {
+		w := &datamodel.Webhook{ID: id, URL: "https://partner.example.com/" + id}
+		webhooks = append(webhooks, w)
+
+		err := db.SaveWebhook(ctx, w)
+		assert.NoError(t, err)
+	}
+
+	// Listing without paging returns all the webhooks
+	all, err := db.ListWebhooks(ctx, 0, 0)
+	assert.NoError(t, err)
+	assert.Equal(t, webhooks, all)
+
+	page, err := db.ListWebhooks(ctx, 1, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, webhooks[1:2], page)
+
+	page, err = db.ListWebhooks(ctx, 1, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, webhooks[1:], page)
+
+	page, err = db.ListWebhooks(ctx, 3, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, page)
+}
+
+func TestOutboxEvents(t *testing.T) {
+	ctx := context.Background()
+	db := getDatabase(ctx)
+
+	user := &datamodel.User{ID: "1", Version: 1, BaseUser: datamodel.BaseUser{Name: "Elon", Surname: "Musk", Email: "elon.musk@example.com", Phone: "+341234567890"}}
+	assert.NoError(t, db.SaveUser(ctx, user, &datamodel.Event{ID: "created", Entity: user}))
+
+	// A change that fails doesn't save its events
+	stale := *user
+	stale.Version = 0
+	err := db.UpdateUser(ctx, &stale, &datamodel.Event{ID: "stale", Entity: &stale})
+	assert.True(t, errors.IsConflict(err))
+
+	// The events are saved with the entity after the change
+	updated := *user
+	updated.Name = "Leah"
+	assert.NoError(t, db.UpdateUser(ctx, &updated, &datamodel.Event{ID: "updated", Entity: &updated}))
+
+	events, err := db.ListOutboxEvents(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, "created", events[0].ID)
+	assert.Equal(t, "updated", events[1].ID)
+
+	var saved datamodel.User
+	assert.NoError(t, events[1].Decode(&saved))
+	assert.Equal(t, "Leah", saved.Name)
+	assert.Equal(t, 2, saved.Version)
 }
 
 func TestSaveClass(t *testing.T) {
@@ -158,6 +233,148 @@ func TestSaveClass(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestListClassesByRoom(t *testing.T) {
+	ctx := context.Background()
+	db := getDatabase(ctx)
+
+	start := time.Now().AddDate(0, 0, -20)
+	end := time.Now().AddDate(0, 0, -10)
+
+	class1 := &datamodel.Class{
+		ID: "1",
+		BaseClass: datamodel.BaseClass{
+			Studio:        "Yoga Studio",
+			Room:          "Room 1",
+			Name:          "Yoga Class",
+			StartDate:     &start,
+			EndDate:       &end,
+			DailyCapacity: 20,
+		},
+	}
+
+	class2 := &datamodel.Class{
+		ID: "2",
+		BaseClass: datamodel.BaseClass{
+			Studio:        "Yoga Studio",
+			Room:          "Room 2",
+			Name:          "Pilates Class",
+			StartDate:     &start,
+			EndDate:       &end,
+			DailyCapacity: 20,
+		},
+	}
+
+	assert.NoError(t, db.SaveClass(ctx, class1))
+	assert.NoError(t, db.SaveClass(ctx, class2))
+
+	// Only the classes of the requested room should be returned
+	classes, err := db.ListClassesByRoom(ctx, "Yoga Studio", "Room 1")
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []*datamodel.Class{class1}, classes)
+
+	// A room with the same name in another studio is another room
+	classes, err = db.ListClassesByRoom(ctx, "Other Studio", "Room 1")
+	assert.NoError(t, err)
+	assert.Empty(t, classes)
+}
+
+func TestUpdateVersion(t *testing.T) {
+	ctx := context.Background()
+	db := getDatabase(ctx)
+
+	user := &datamodel.User{ID: "1", Version: 1, BaseUser: datamodel.BaseUser{Email: "elon.musk@example.com"}}
+	assert.NoError(t, db.SaveUser(ctx, user))
+
+	// Two updates read from the same version, the second one is rejected
+	first := *user
+	first.Phone = "+341234567890"
+	second := *user
+	second.Phone = "+340987654321"
+
+	assert.NoError(t, db.UpdateUser(ctx, &first))
+	assert.Equal(t, 2, first.Version)
+	assert.True(t, errors.IsConflict(db.UpdateUser(ctx, &second)))
+
+	stored, err := db.GetUserByID(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, "+341234567890", stored.Phone)
+	assert.Equal(t, 2, stored.Version)
+}
+
+func TestCountBookings(t *testing.T) {
+	ctx := context.Background()
+	db := getDatabase(ctx)
+
+	day := func(d, h int) time.Time { return time.Date(2023, 10, d, h, 0, 0, 0, time.UTC) }
+	bookings := []*datamodel.Booking{
+		{ID: "1", Version: 1, Status: datamodel.BookingStatusBooked, BaseBooking: datamodel.BaseBooking{UserID: "u1", ClassID: "c1", Date: day(10, 0)}},
+		{ID: "2", Version: 1, Status: datamodel.BookingStatusBooked, BaseBooking: datamodel.BaseBooking{UserID: "u2", ClassID: "c1", Date: day(10, 18)}},
+		{ID: "3", Version: 1, Status: datamodel.BookingStatusBooked, BaseBooking: datamodel.BaseBooking{UserID: "u1", ClassID: "c1", Date: day(12, 0)}},
+		{ID: "4", Version: 1, Status: datamodel.BookingStatusBooked, BaseBooking: datamodel.BaseBooking{UserID: "u1", ClassID: "c2", Date: day(10, 0)}},
+	}
+	for _, b := range bookings {
+		assert.NoError(t, db.SaveBooking(ctx, b))
+	}
+
+	count, err := db.CountBookingsByClassAndDate(ctx, "c1", day(10, 12))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	counts, err := db.CountBookingsByClassAndDays(ctx, "c1", day(9, 0), day(11, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, map[time.Time]int{day(10, 0): 2}, counts)
+
+	// The cancelled and deleted bookings leave the counts
+	cancelled := *bookings[0]
+	cancelled.Status = datamodel.BookingStatusCancelled
+	assert.NoError(t, db.UpdateBooking(ctx, &cancelled))
+	assert.NoError(t, db.DeleteBooking(ctx, "3"))
+
+	counts, err = db.CountBookingsByClassAndDays(ctx, "c1", day(1, 0), day(31, 0))
+	assert.NoError(t, err)
+	assert.Equal(t, map[time.Time]int{day(10, 0): 1}, counts)
+}
+
+func TestBatchGetters(t *testing.T) {
+	ctx := context.Background()
+	db := getDatabase(ctx)
+
+	for _, u := range []*datamodel.User{
+		{ID: "u1", BaseUser: datamodel.BaseUser{Name: "Elon", Surname: "Musk", Email: "elon.musk@example.com", Phone: "+341234567890"}},
+		{ID: "u2", BaseUser: datamodel.BaseUser{Name: "Jeff", Surname: "Bezos", Email: "jeff.bezos@example.com", Phone: "+341234567891"}},
+		{ID: "u3", BaseUser: datamodel.BaseUser{Name: "Bill", Surname: "Gates", Email: "bill.gates@example.com", Phone: "+341234567892"}},
+	} {
+		assert.NoError(t, db.SaveUser(ctx, u))
+	}
+
+	date := time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)
+	for _, b := range []*datamodel.Booking{
+		{ID: "1", Version: 1, Status: datamodel.BookingStatusBooked, BaseBooking: datamodel.BaseBooking{UserID: "u1", ClassID: "c1", Date: date}},
+		{ID: "2", Version: 1, Status: datamodel.BookingStatusBooked, BaseBooking: datamodel.BaseBooking{UserID: "u2", ClassID: "c2", Date: date}},
+		{ID: "3", Version: 1, Status: datamodel.BookingStatusBooked, BaseBooking: datamodel.BaseBooking{UserID: "u3", ClassID: "c1", Date: date}},
+	} {
+		assert.NoError(t, db.SaveBooking(ctx, b))
+	}
+
+	// The unknown ids are skipped
+	users, err := db.GetUsersByIDs(ctx, []string{"u1", "u3", "unknown"})
+	assert.NoError(t, err)
+	assert.Len(t, users, 2)
+	assert.ElementsMatch(t, []string{"u1", "u3"}, []string{users[0].ID, users[1].ID})
+
+	bookings, err := db.ListBookingsByUsers(ctx, []string{"u1", "u2"})
+	assert.NoError(t, err)
+	assert.Len(t, bookings, 2)
+
+	bookings, err = db.ListBookingsByClasses(ctx, []string{"c1"})
+	assert.NoError(t, err)
+	assert.Len(t, bookings, 2)
+
+	classes, err := db.GetClassesByIDs(ctx, []string{"c1"})
+	assert.NoError(t, err)
+	assert.Empty(t, classes)
+}
+
 func getDatabase(ctx context.Context) database.Database {
 	return database.New(ctx, cliparams.New())
 }
@@ -2,6 +2,7 @@ package database
 
 import (
 	"context"
+	"time"
 
 	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
 	"github.com/think-free/ABCFitness-challenge/internal/database/memory"
@@ -13,21 +14,73 @@ const (
 	DatabaseMemory = "memory"
 )
 
+// Database stores the entities, the Update methods only replace an entity if the version of the given entity is the
+// stored one, otherwise they return a conflict error, and they increment the version of the given entity. The methods
+// changing an entity save the given events in the outbox in the same operation, none of them is saved if it fails.
 type Database interface {
-	SaveUser(ctx context.Context, u *datamodel.User) error
+	SaveUser(ctx context.Context, u *datamodel.User, events ...*datamodel.Event) error
 	GetUserByID(ctx context.Context, id string) (*datamodel.User, error)
 	GetUserID(ctx context.Context, u *datamodel.User) (string, error)
+	UpdateUser(ctx context.Context, u *datamodel.User, events ...*datamodel.Event) error
 	ListUsers(ctx context.Context, offset, count int) ([]*datamodel.User, error)
+	// The batch getters return the entities found for the ids in a single lookup, the unknown ids are skipped
+	GetUsersByIDs(ctx context.Context, ids []string) ([]*datamodel.User, error)
 
-	SaveClass(ctx context.Context, cl *datamodel.Class) error
+	SaveClass(ctx context.Context, cl *datamodel.Class, events ...*datamodel.Event) error
 	GetClassByID(ctx context.Context, id string) (*datamodel.Class, error)
 	GetClassID(ctx context.Context, cl *datamodel.Class) (string, error)
+	UpdateClass(ctx context.Context, cl *datamodel.Class, events ...*datamodel.Event) error
 	ListClasses(ctx context.Context, offset, count int) ([]*datamodel.Class, error)
+	ListClassesByRoom(ctx context.Context, studio, room string) ([]*datamodel.Class, error)
+	GetClassesByIDs(ctx context.Context, ids []string) ([]*datamodel.Class, error)
 
-	SaveBooking(ctx context.Context, b *datamodel.Booking) error
+	SaveBooking(ctx context.Context, b *datamodel.Booking, events ...*datamodel.Event) error
 	GetBookingID(ctx context.Context, b *datamodel.Booking) (string, error)
 	GetBookingByID(ctx context.Context, id string) (*datamodel.Booking, error)
+	UpdateBooking(ctx context.Context, b *datamodel.Booking, events ...*datamodel.Event) error
+	DeleteBooking(ctx context.Context, id string, events ...*datamodel.Event) error
 	ListBookings(ctx context.Context, offset, count int) ([]*datamodel.Booking, error)
+	ListBookingsByUser(ctx context.Context, userID string) ([]*datamodel.Booking, error)
+	ListBookingsByClass(ctx context.Context, classID string) ([]*datamodel.Booking, error)
+	ListBookingsByUsers(ctx context.Context, userIDs []string) ([]*datamodel.Booking, error)
+	ListBookingsByClasses(ctx context.Context, classIDs []string) ([]*datamodel.Booking, error)
+	ListBookingsByStatus(ctx context.Context, status datamodel.BookingStatus) ([]*datamodel.Booking, error)
+	// The active bookings are counted by class and day from an index, without reading the bookings
+	CountBookingsByClassAndDate(ctx context.Context, classID string, date time.Time) (int, error)
+	CountBookingsByClassAndDays(ctx context.Context, classID string, from, to time.Time) (map[time.Time]int, error)
+
+	SaveSuspension(ctx context.Context, s *datamodel.Suspension, events ...*datamodel.Event) error
+	UpdateSuspension(ctx context.Context, s *datamodel.Suspension, events ...*datamodel.Event) error
+	GetSuspensionByID(ctx context.Context, id string) (*datamodel.Suspension, error)
+	ListSuspensions(ctx context.Context, offset, count int) ([]*datamodel.Suspension, error)
+	ListSuspensionsByUser(ctx context.Context, userID string) ([]*datamodel.Suspension, error)
+
+	SaveStudioRules(ctx context.Context, sr *datamodel.StudioRules) error
+	GetStudioRules(ctx context.Context, studio string) (*datamodel.StudioRules, error)
+
+	// The outbox keeps the events of the changes until they are published, in the order they were saved. The events
+	// failing all their publications are moved to the dead-letter list.
+	SaveOutboxEvent(ctx context.Context, e *datamodel.Event) error
+	ListOutboxEvents(ctx context.Context, count int) ([]*datamodel.Event, error)
+	UpdateOutboxEvent(ctx context.Context, e *datamodel.Event) error
+	DeleteOutboxEvent(ctx context.Context, id string) error
+	DeadLetterOutboxEvent(ctx context.Context, e *datamodel.Event) error
+	ListDeadOutboxEvents(ctx context.Context) ([]*datamodel.Event, error)
+	UpdateDeadOutboxEvent(ctx context.Context, e *datamodel.Event) error
+
+	SaveWebhook(ctx context.Context, w *datamodel.Webhook) error
+	GetWebhookByID(ctx context.Context, id string) (*datamodel.Webhook, error)
+	UpdateWebhook(ctx context.Context, w *datamodel.Webhook) error
+	DeleteWebhook(ctx context.Context, id string) error
+	ListWebhooks(ctx context.Context, offset, count int) ([]*datamodel.Webhook, error)
+
+	// The deliveries of the events to the webhooks are kept as their log, the due ones are the pending deliveries
+	// whose next attempt is not after the given time
+	SaveWebhookDelivery(ctx context.Context, d *datamodel.WebhookDelivery) error
+	GetWebhookDeliveryByID(ctx context.Context, id string) (*datamodel.WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, d *datamodel.WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, f *datamodel.WebhookDeliveryFilter) ([]*datamodel.WebhookDelivery, error)
+	ListDueWebhookDeliveries(ctx context.Context, at time.Time, count int) ([]*datamodel.WebhookDelivery, error)
 }
 
 func New(ctx context.Context, cp *cliparams.ClientParameters) Database {
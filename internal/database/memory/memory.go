@@ -2,6 +2,8 @@ package memory
 
 import (
 	"context"
+	"sync"
+	"time"
 
 	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
 	"github.com/think-free/ABCFitness-challenge/internal/errors"
@@ -9,27 +11,56 @@ import (
 
 // Memory implements the Database interface with a memory data collection that is not persistent
 type Memory struct {
+	mu sync.RWMutex
+
 	users    []*datamodel.User
 	classes  []*datamodel.Class
 	bookings []*datamodel.Booking
+	rules    map[string]*datamodel.StudioRules
+
+	// booked indexes the number of active bookings by class and day
+	booked map[string]map[time.Time]int
+
+	suspensions []*datamodel.Suspension
+
+	// outbox holds the events not published yet in the order they were saved, dead the ones that failed all their attempts
+	outbox []*datamodel.Event
+	dead   []*datamodel.Event
+
+	webhooks   []*datamodel.Webhook
+	deliveries []*datamodel.WebhookDelivery
 }
 
 func New(ctx context.Context) *Memory {
-	return &Memory{}
+	return &Memory{
+		rules:  make(map[string]*datamodel.StudioRules),
+		booked: make(map[string]map[time.Time]int),
+	}
 }
 
-func (m *Memory) SaveUser(ctx context.Context, u *datamodel.User) error {
+func (m *Memory) SaveUser(ctx context.Context, u *datamodel.User, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for _, user := range m.users {
 		if user.Name == u.Name && user.Surname == u.Surname && user.Email == u.Email && user.Phone == u.Phone {
 			return errors.ErrorAlreadyExists()
 		}
 	}
 
+	err := m.saveEvents(events)
+	if err != nil {
+		return err
+	}
+
 	m.users = append(m.users, u)
 	return nil
 }
 
 func (m *Memory) GetUserByID(ctx context.Context, id string) (*datamodel.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, user := range m.users {
 		if user.ID == id {
 			return user, nil
@@ -40,6 +71,9 @@ func (m *Memory) GetUserByID(ctx context.Context, id string) (*datamodel.User, e
 }
 
 func (m *Memory) GetUserID(ctx context.Context, u *datamodel.User) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, user := range m.users {
 		if user.Name == u.Name && user.Surname == u.Surname && user.Email == u.Email && user.Phone == u.Phone {
 			return user.ID, nil
@@ -49,22 +83,75 @@ func (m *Memory) GetUserID(ctx context.Context, u *datamodel.User) (string, erro
 	return "", errors.ErrorNotFound()
 }
 
+func (m *Memory) UpdateUser(ctx context.Context, u *datamodel.User, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, user := range m.users {
+		if user.ID == u.ID {
+			if user.Version != u.Version {
+				return errors.ErrorConflict(u.ID)
+			}
+			u.Version++
+			err := m.saveEvents(events)
+			if err != nil {
+				u.Version--
+				return err
+			}
+			m.users[i] = u
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
 func (m *Memory) ListUsers(ctx context.Context, offset, count int) ([]*datamodel.User, error) {
-	return m.users, nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return page(m.users, offset, count), nil
 }
 
-func (m *Memory) SaveClass(ctx context.Context, cl *datamodel.Class) error {
+func (m *Memory) GetUsersByIDs(ctx context.Context, ids []string) ([]*datamodel.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := idSet(ids)
+
+	var users []*datamodel.User
+	for _, user := range m.users {
+		if wanted[user.ID] {
+			users = append(users, user)
+		}
+	}
+
+	return users, nil
+}
+
+func (m *Memory) SaveClass(ctx context.Context, cl *datamodel.Class, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for _, class := range m.classes {
 		if class.Studio == cl.Studio && class.Name == cl.Name && class.StartDate.Unix() == cl.StartDate.Unix() {
 			return errors.ErrorAlreadyExists()
 		}
 	}
 
+	err := m.saveEvents(events)
+	if err != nil {
+		return err
+	}
+
 	m.classes = append(m.classes, cl)
 	return nil
 }
 
 func (m *Memory) GetClassByID(ctx context.Context, id string) (*datamodel.Class, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, class := range m.classes {
 		if class.ID == id {
 			return class, nil
@@ -74,7 +161,26 @@ func (m *Memory) GetClassByID(ctx context.Context, id string) (*datamodel.Class,
 	return nil, errors.ErrorNotFound()
 }
 
+func (m *Memory) GetClassesByIDs(ctx context.Context, ids []string) ([]*datamodel.Class, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := idSet(ids)
+
+	var classes []*datamodel.Class
+	for _, class := range m.classes {
+		if wanted[class.ID] {
+			classes = append(classes, class)
+		}
+	}
+
+	return classes, nil
+}
+
 func (m *Memory) GetClassID(ctx context.Context, cl *datamodel.Class) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, class := range m.classes {
 		if class.Studio == cl.Studio && class.Name == cl.Name && class.StartDate.Unix() == cl.StartDate.Unix() {
 			return class.ID, nil
@@ -84,26 +190,78 @@ func (m *Memory) GetClassID(ctx context.Context, cl *datamodel.Class) (string, e
 	return "", errors.ErrorNotFound()
 }
 
+func (m *Memory) UpdateClass(ctx context.Context, cl *datamodel.Class, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, class := range m.classes {
+		if class.ID == cl.ID {
+			if class.Version != cl.Version {
+				return errors.ErrorConflict(cl.ID)
+			}
+			cl.Version++
+			err := m.saveEvents(events)
+			if err != nil {
+				cl.Version--
+				return err
+			}
+			m.classes[i] = cl
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
 func (m *Memory) ListClasses(ctx context.Context, offset, count int) ([]*datamodel.Class, error) {
-	return m.classes, nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return page(m.classes, offset, count), nil
 }
 
-func (m *Memory) SaveBooking(ctx context.Context, b *datamodel.Booking) error {
+func (m *Memory) ListClassesByRoom(ctx context.Context, studio, room string) ([]*datamodel.Class, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var classes []*datamodel.Class
+	for _, class := range m.classes {
+		if class.Studio == studio && class.Room == room {
+			classes = append(classes, class)
+		}
+	}
+
+	return classes, nil
+}
+
+func (m *Memory) SaveBooking(ctx context.Context, b *datamodel.Booking, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	for _, booking := range m.bookings {
-		if booking.UserID == b.UserID && booking.ClassID == b.ClassID && booking.Date == b.Date {
+		if booking.IsActive() && booking.UserID == b.UserID && booking.ClassID == b.ClassID && booking.Date == b.Date {
 			return errors.ErrorAlreadyExists()
 		}
 	}
 
-	// TODO : due to the lack of time, the booking is not checked if it is in the class date range nor if the class is full
+	// TODO : due to the lack of time, the booking is not checked if it is in the class date range, the capacity is checked by the service
+
+	err := m.saveEvents(events)
+	if err != nil {
+		return err
+	}
 
 	m.bookings = append(m.bookings, b)
+	m.indexBooking(b, 1)
 	return nil
 }
 
 func (m *Memory) GetBookingID(ctx context.Context, b *datamodel.Booking) (string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, booking := range m.bookings {
-		if booking.UserID == b.UserID && booking.ClassID == b.ClassID && booking.Date == b.Date {
+		if booking.IsActive() && booking.UserID == b.UserID && booking.ClassID == b.ClassID && booking.Date == b.Date {
 			return booking.ID, nil
 		}
 	}
@@ -112,6 +270,9 @@ func (m *Memory) GetBookingID(ctx context.Context, b *datamodel.Booking) (string
 }
 
 func (m *Memory) GetBookingByID(ctx context.Context, id string) (*datamodel.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	for _, booking := range m.bookings {
 		if booking.ID == id {
 			return booking, nil
@@ -121,6 +282,531 @@ func (m *Memory) GetBookingByID(ctx context.Context, id string) (*datamodel.Book
 	return nil, errors.ErrorNotFound()
 }
 
+func (m *Memory) UpdateBooking(ctx context.Context, b *datamodel.Booking, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, booking := range m.bookings {
+		if booking.ID == b.ID {
+			if booking.Version != b.Version {
+				return errors.ErrorConflict(b.ID)
+			}
+			b.Version++
+			err := m.saveEvents(events)
+			if err != nil {
+				b.Version--
+				return err
+			}
+			m.bookings[i] = b
+			m.indexBooking(booking, -1)
+			m.indexBooking(b, 1)
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) DeleteBooking(ctx context.Context, id string, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, booking := range m.bookings {
+		if booking.ID == id {
+			err := m.saveEvents(events)
+			if err != nil {
+				return err
+			}
+			m.bookings = append(m.bookings[:i], m.bookings[i+1:]...)
+			m.indexBooking(booking, -1)
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
 func (m *Memory) ListBookings(ctx context.Context, offset, count int) ([]*datamodel.Booking, error) {
-	return m.bookings, nil
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return page(m.bookings, offset, count), nil
+}
+
+func (m *Memory) ListBookingsByUser(ctx context.Context, userID string) ([]*datamodel.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var bookings []*datamodel.Booking
+	for _, booking := range m.bookings {
+		if booking.UserID == userID {
+			bookings = append(bookings, booking)
+		}
+	}
+
+	return bookings, nil
+}
+
+func (m *Memory) ListBookingsByClass(ctx context.Context, classID string) ([]*datamodel.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var bookings []*datamodel.Booking
+	for _, booking := range m.bookings {
+		if booking.ClassID == classID {
+			bookings = append(bookings, booking)
+		}
+	}
+
+	return bookings, nil
+}
+
+func (m *Memory) ListBookingsByUsers(ctx context.Context, userIDs []string) ([]*datamodel.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := idSet(userIDs)
+
+	var bookings []*datamodel.Booking
+	for _, booking := range m.bookings {
+		if wanted[booking.UserID] {
+			bookings = append(bookings, booking)
+		}
+	}
+
+	return bookings, nil
+}
+
+func (m *Memory) ListBookingsByClasses(ctx context.Context, classIDs []string) ([]*datamodel.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	wanted := idSet(classIDs)
+
+	var bookings []*datamodel.Booking
+	for _, booking := range m.bookings {
+		if wanted[booking.ClassID] {
+			bookings = append(bookings, booking)
+		}
+	}
+
+	return bookings, nil
+}
+
+func (m *Memory) ListBookingsByStatus(ctx context.Context, status datamodel.BookingStatus) ([]*datamodel.Booking, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var bookings []*datamodel.Booking
+	for _, booking := range m.bookings {
+		if booking.Status == status {
+			bookings = append(bookings, booking)
+		}
+	}
+
+	return bookings, nil
+}
+
+// CountBookingsByClassAndDate returns the number of active bookings of the session of the class of the day of date
+func (m *Memory) CountBookingsByClassAndDate(ctx context.Context, classID string, date time.Time) (int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.booked[classID][datamodel.Day(date)], nil
+}
+
+func (m *Memory) CountBookingsByClassAndDays(ctx context.Context, classID string, from, to time.Time) (map[time.Time]int, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	from, to = datamodel.Day(from), datamodel.Day(to)
+
+	counts := make(map[time.Time]int)
+	for day, count := range m.booked[classID] {
+		if !day.Before(from) && !day.After(to) {
+			counts[day] = count
+		}
+	}
+
+	return counts, nil
+}
+
+// indexBooking adds delta to the count of the class and day of the booking if it is active, must be called with the lock held
+func (m *Memory) indexBooking(b *datamodel.Booking, delta int) {
+	if !b.IsActive() {
+		return
+	}
+
+	day := datamodel.Day(b.Date)
+	days := m.booked[b.ClassID]
+	if days == nil {
+		days = make(map[time.Time]int)
+		m.booked[b.ClassID] = days
+	}
+
+	days[day] += delta
+	if days[day] <= 0 {
+		delete(days, day)
+		if len(days) == 0 {
+			delete(m.booked, b.ClassID)
+		}
+	}
+}
+
+func (m *Memory) SaveSuspension(ctx context.Context, s *datamodel.Suspension, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, suspension := range m.suspensions {
+		if suspension.ID == s.ID {
+			return errors.ErrorAlreadyExists()
+		}
+	}
+
+	err := m.saveEvents(events)
+	if err != nil {
+		return err
+	}
+
+	m.suspensions = append(m.suspensions, s)
+	return nil
+}
+
+func (m *Memory) UpdateSuspension(ctx context.Context, s *datamodel.Suspension, events ...*datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, suspension := range m.suspensions {
+		if suspension.ID == s.ID {
+			err := m.saveEvents(events)
+			if err != nil {
+				return err
+			}
+			m.suspensions[i] = s
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) GetSuspensionByID(ctx context.Context, id string) (*datamodel.Suspension, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, suspension := range m.suspensions {
+		if suspension.ID == id {
+			return suspension, nil
+		}
+	}
+
+	return nil, errors.ErrorNotFound()
+}
+
+func (m *Memory) ListSuspensions(ctx context.Context, offset, count int) ([]*datamodel.Suspension, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return page(m.suspensions, offset, count), nil
+}
+
+func (m *Memory) ListSuspensionsByUser(ctx context.Context, userID string) ([]*datamodel.Suspension, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var suspensions []*datamodel.Suspension
+	for _, suspension := range m.suspensions {
+		if suspension.UserID == userID {
+			suspensions = append(suspensions, suspension)
+		}
+	}
+
+	return suspensions, nil
+}
+
+// SaveStudioRules creates or replaces the rules of the studio
+func (m *Memory) SaveStudioRules(ctx context.Context, sr *datamodel.StudioRules) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.rules[sr.Studio] = sr
+	return nil
+}
+
+func (m *Memory) GetStudioRules(ctx context.Context, studio string) (*datamodel.StudioRules, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	sr, ok := m.rules[studio]
+	if !ok {
+		return nil, errors.ErrorNotFound()
+	}
+
+	return sr, nil
+}
+
+func (m *Memory) SaveOutboxEvent(ctx context.Context, e *datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, event := range m.outbox {
+		if event.ID == e.ID {
+			return errors.ErrorAlreadyExists()
+		}
+	}
+
+	m.outbox = append(m.outbox, e)
+	return nil
+}
+
+// saveEvents adds the events of a change to the outbox, they are sealed once the version of the entity is set, must be
+// called with the lock held before the change is stored
+func (m *Memory) saveEvents(events []*datamodel.Event) error {
+	for _, e := range events {
+		err := e.Seal()
+		if err != nil {
+			return err
+		}
+	}
+
+	m.outbox = append(m.outbox, events...)
+	return nil
+}
+
+func (m *Memory) ListOutboxEvents(ctx context.Context, count int) ([]*datamodel.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := m.outbox
+	if count > 0 && count < len(events) {
+		events = events[:count]
+	}
+
+	return append([]*datamodel.Event(nil), events...), nil
+}
+
+func (m *Memory) UpdateOutboxEvent(ctx context.Context, e *datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, event := range m.outbox {
+		if event.ID == e.ID {
+			m.outbox[i] = e
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) DeleteOutboxEvent(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, event := range m.outbox {
+		if event.ID == id {
+			m.outbox = append(m.outbox[:i:i], m.outbox[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) DeadLetterOutboxEvent(ctx context.Context, e *datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, event := range m.outbox {
+		if event.ID == e.ID {
+			m.outbox = append(m.outbox[:i:i], m.outbox[i+1:]...)
+			m.dead = append(m.dead, e)
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) ListDeadOutboxEvents(ctx context.Context) ([]*datamodel.Event, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]*datamodel.Event(nil), m.dead...), nil
+}
+
+func (m *Memory) UpdateDeadOutboxEvent(ctx context.Context, e *datamodel.Event) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, event := range m.dead {
+		if event.ID == e.ID {
+			m.dead[i] = e
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) SaveWebhook(ctx context.Context, w *datamodel.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, webhook := range m.webhooks {
+		if webhook.ID == w.ID {
+			return errors.ErrorAlreadyExists()
+		}
+	}
+
+	m.webhooks = append(m.webhooks, w)
+	return nil
+}
+
+func (m *Memory) GetWebhookByID(ctx context.Context, id string) (*datamodel.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, webhook := range m.webhooks {
+		if webhook.ID == id {
+			return webhook, nil
+		}
+	}
+
+	return nil, errors.ErrorNotFound()
+}
+
+func (m *Memory) UpdateWebhook(ctx context.Context, w *datamodel.Webhook) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, webhook := range m.webhooks {
+		if webhook.ID == w.ID {
+			if webhook.Version != w.Version {
+				return errors.ErrorConflict(w.ID)
+			}
+			w.Version++
+			m.webhooks[i] = w
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) DeleteWebhook(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, webhook := range m.webhooks {
+		if webhook.ID == id {
+			m.webhooks = append(m.webhooks[:i:i], m.webhooks[i+1:]...)
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) ListWebhooks(ctx context.Context, offset, count int) ([]*datamodel.Webhook, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return page(m.webhooks, offset, count), nil
+}
+
+func (m *Memory) SaveWebhookDelivery(ctx context.Context, d *datamodel.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, delivery := range m.deliveries {
+		if delivery.ID == d.ID {
+			return errors.ErrorAlreadyExists()
+		}
+	}
+
+	m.deliveries = append(m.deliveries, d)
+	return nil
+}
+
+func (m *Memory) GetWebhookDeliveryByID(ctx context.Context, id string) (*datamodel.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, delivery := range m.deliveries {
+		if delivery.ID == id {
+			return delivery, nil
+		}
+	}
+
+	return nil, errors.ErrorNotFound()
+}
+
+func (m *Memory) UpdateWebhookDelivery(ctx context.Context, d *datamodel.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, delivery := range m.deliveries {
+		if delivery.ID == d.ID {
+			m.deliveries[i] = d
+			return nil
+		}
+	}
+
+	return errors.ErrorNotFound()
+}
+
+func (m *Memory) ListWebhookDeliveries(ctx context.Context, f *datamodel.WebhookDeliveryFilter) ([]*datamodel.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deliveries []*datamodel.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if f.Matches(delivery) {
+			deliveries = append(deliveries, delivery)
+		}
+	}
+
+	return f.Page(deliveries), nil
+}
+
+func (m *Memory) ListDueWebhookDeliveries(ctx context.Context, at time.Time, count int) ([]*datamodel.WebhookDelivery, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var deliveries []*datamodel.WebhookDelivery
+	for _, delivery := range m.deliveries {
+		if delivery.IsDue(at) {
+			deliveries = append(deliveries, delivery)
+			if count > 0 && len(deliveries) == count {
+				break
+			}
+		}
+	}
+
+	return deliveries, nil
+}
+
+func idSet(ids []string) map[string]bool {
+	set := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		set[id] = true
+	}
+	return set
+}
+
+// page returns a copy of the page of the list selected by the offset and count, ignored when not positive
+func page[T any](list []T, offset, count int) []T {
+	if offset > 0 {
+		if offset >= len(list) {
+			return nil
+		}
+		list = list[offset:]
+	}
+
+	if count > 0 && count < len(list) {
+		list = list[:count]
+	}
+
+	return append([]T(nil), list...)
 }
@@ -0,0 +1,78 @@
+package datamodel
+
+import (
+	"encoding/json"
+	"time"
+)
+
+const (
+	AuditActionCreate = "create"
+	AuditActionUpdate = "update"
+	AuditActionDelete = "delete"
+	AuditActionExport = "export"
+	AuditActionErase  = "erase"
+)
+
+// AuditEntry records a change done to an entity, Before and After are the json snapshots of the entity
+type AuditEntry struct {
+	ID        string          `json:"id"`
+	Timestamp time.Time       `json:"timestamp"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Entity    string          `json:"entity"`
+	EntityID  string          `json:"entity_id"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+
+	// ClientRequestID is the id sent by the client in the X-Request-ID header, RequestID is always generated by the
+	// server so a client can't make its changes look like the ones of another request
+	ClientRequestID string `json:"client_request_id,omitempty"`
+}
+
+// AuditFilter selects audit entries, empty fields match everything
+type AuditFilter struct {
+	Actor    string `json:"actor"`
+	Action   string `json:"action"`
+	Entity   string `json:"entity"`
+	EntityID string `json:"entity_id"`
+	Offset   int    `json:"offset"`
+	Count    int    `json:"count"`
+}
+
+// Matches returns true if the entry is selected by the filter
+func (f *AuditFilter) Matches(e *AuditEntry) bool {
+	return (f.Actor == "" || f.Actor == e.Actor) &&
+		(f.Action == "" || f.Action == e.Action) &&
+		(f.Entity == "" || f.Entity == e.Entity) &&
+		(f.EntityID == "" || f.EntityID == e.EntityID)
+}
+
+// Page returns the entries of the page selected by the offset and count of the filter, ignored when not positive
+func (f *AuditFilter) Page(entries []*AuditEntry) []*AuditEntry {
+	if f.Offset > 0 {
+		if f.Offset >= len(entries) {
+			return nil
+		}
+		entries = entries[f.Offset:]
+	}
+
+	if f.Count > 0 && f.Count < len(entries) {
+		entries = entries[:f.Count]
+	}
+
+	return entries
+}
+
+const (
+	AuditEntityUser        = "user"
+	AuditEntityClass       = "class"
+	AuditEntityBooking     = "booking"
+	AuditEntitySuspension  = "suspension"
+	AuditEntityStudioRules = "studio_rules"
+	AuditEntityWebhook     = "webhook"
+	AuditEntityDelivery    = "webhook_delivery"
+)
+
+// AuditActorSystem is the actor of the changes done without principal, by the internal jobs or when the authentication is disabled
+const AuditActorSystem = "system"
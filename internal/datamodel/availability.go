@@ -0,0 +1,28 @@
+package datamodel
+
+import "time"
+
+// Availability is the number of spots left in the session of a class on a day
+type Availability struct {
+	ClassID   string    `json:"class"`
+	Date      time.Time `json:"date"`
+	Capacity  int       `json:"capacity"`
+	Booked    int       `json:"booked"`
+	Remaining int       `json:"remaining"`
+}
+
+// NewAvailability returns the availability of the session of the class on the day with the given active bookings
+func NewAvailability(class *Class, day time.Time, booked int) *Availability {
+	remaining := class.DailyCapacity - booked
+	if remaining < 0 {
+		remaining = 0
+	}
+
+	return &Availability{
+		ClassID:   class.ID,
+		Date:      Day(day),
+		Capacity:  class.DailyCapacity,
+		Booked:    booked,
+		Remaining: remaining,
+	}
+}
@@ -0,0 +1,44 @@
+package datamodel
+
+type BatchMode string
+
+const (
+	// BatchModeAtomic creates all the bookings of the batch or none of them
+	BatchModeAtomic BatchMode = "atomic"
+	// BatchModeBestEffort creates the bookings of the batch that can be created
+	BatchModeBestEffort BatchMode = "best_effort"
+)
+
+// MaxBatchBookings is the maximum number of bookings of a batch
+const MaxBatchBookings = 100
+
+type BatchItemStatus string
+
+const (
+	BatchItemCreated BatchItemStatus = "created"
+	BatchItemFailed  BatchItemStatus = "failed"
+	// BatchItemAborted is a valid booking not created because another booking of an atomic batch failed
+	BatchItemAborted BatchItemStatus = "aborted"
+)
+
+// CreateBatchBookingRequest books many sessions at once, the mode defaults to atomic
+type CreateBatchBookingRequest struct {
+	Mode     BatchMode               `json:"mode"`
+	Bookings []*CreateBookingRequest `json:"bookings"`
+}
+
+// BatchItemResult is the outcome of the booking at Index in the batch
+type BatchItemResult struct {
+	Index   int             `json:"index"`
+	Status  BatchItemStatus `json:"status"`
+	Booking *Booking        `json:"booking,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// BatchBookingResponse is the outcome of a batch booking item by item, in the order of the request
+type BatchBookingResponse struct {
+	Mode    BatchMode          `json:"mode"`
+	Created int                `json:"created"`
+	Failed  int                `json:"failed"`
+	Results []*BatchItemResult `json:"results"`
+}
@@ -8,6 +8,18 @@ import (
 	"github.com/think-free/ABCFitness-challenge/internal/errors"
 )
 
+type BookingStatus string
+
+const (
+	BookingStatusBooked    BookingStatus = "booked"
+	BookingStatusCheckedIn BookingStatus = "checked-in"
+	BookingStatusNoShow    BookingStatus = "no-show"
+	BookingStatusCancelled BookingStatus = "cancelled"
+)
+
+// CheckInOpening is how long before the start of the session the check-in is open
+const CheckInOpening = 30 * time.Minute
+
 type BaseBooking struct {
 	ClassID string    `json:"class"`
 	UserID  string    `json:"user"`
@@ -18,9 +30,44 @@ type CreateBookingRequest struct {
 	BaseBooking
 }
 
+// CreateOwnBookingRequest is a booking request of the authenticated user, the user is never taken from the request
+type CreateOwnBookingRequest struct {
+	ClassID string    `json:"class"`
+	Date    time.Time `json:"date"`
+}
+
 type Booking struct {
-	ID string `json:"id"`
+	ID      string `json:"id"`
+	Version int    `json:"version"`
 	BaseBooking
+	Status      BookingStatus `json:"status"`
+	CheckedInAt *time.Time    `json:"checked_in_at,omitempty"`
+	CancelledAt *time.Time    `json:"cancelled_at,omitempty"`
+	// Consumed is the credit the booking consumed, refunded if it is cancelled, nil with the unlimited plan
+	Consumed *Consumption `json:"consumed,omitempty"`
+}
+
+// Attendance is the booking history of a user with the count of bookings per status
+type Attendance struct {
+	UserID    string     `json:"user"`
+	Booked    int        `json:"booked"`
+	CheckedIn int        `json:"checked_in"`
+	NoShows   int        `json:"no_shows"`
+	Cancelled int        `json:"cancelled"`
+	Bookings  []*Booking `json:"bookings"`
+}
+
+// Attendee is a booking of a class with the contact details of the user, used by the staff to prepare a session
+type Attendee struct {
+	BookingID   string        `json:"booking"`
+	Date        time.Time     `json:"date"`
+	Status      BookingStatus `json:"status"`
+	CheckedInAt *time.Time    `json:"checked_in_at,omitempty"`
+	UserID      string        `json:"user"`
+	Name        string        `json:"name"`
+	Surname     string        `json:"surname"`
+	Email       string        `json:"email"`
+	Phone       string        `json:"phone"`
 }
 
 type BookingFullInfo struct {
@@ -34,7 +81,9 @@ func NewBooking(ctx context.Context, req *CreateBookingRequest) (*Booking, error
 
 	b := &Booking{
 		ID:          id,
+		Version:     1,
 		BaseBooking: req.BaseBooking,
+		Status:      BookingStatusBooked,
 	}
 
 	if !b.isValid() {
@@ -56,3 +105,81 @@ func (b *Booking) isValid() bool {
 
 	return true
 }
+
+// IsActive returns true if the booking still holds a spot in the session
+func (b *Booking) IsActive() bool {
+	return b.Status != BookingStatusCancelled
+}
+
+// CheckIn returns a copy of the booking checked in at the given time, the check-in is open from CheckInOpening before the session until its end
+func (b *Booking) CheckIn(class *Class, at time.Time) (*Booking, error) {
+	if b.Status != BookingStatusBooked {
+		return nil, errors.ErrorInvalidState()
+	}
+
+	if at.Before(class.SessionStart(b.Date).Add(-CheckInOpening)) || !at.Before(class.SessionEnd(b.Date)) {
+		return nil, errors.ErrorInvalidState()
+	}
+
+	c := *b
+	c.Status = BookingStatusCheckedIn
+	c.CheckedInAt = &at
+	return &c, nil
+}
+
+// Cancel returns a copy of the booking cancelled at the given time, only a booking not yet attended can be cancelled
+// and only until cutOff before the start of its session
+func (b *Booking) Cancel(class *Class, cutOff time.Duration, at time.Time) (*Booking, error) {
+	if b.Status != BookingStatusBooked {
+		return nil, errors.ErrorInvalidState()
+	}
+
+	if at.After(class.SessionStart(b.Date).Add(-cutOff)) {
+		return nil, errors.ErrorInvalidState()
+	}
+
+	return b.Revoke(at), nil
+}
+
+// Revoke returns a copy of the booking cancelled at the given time whatever its session, it describes a booking rolled
+// back by the service and is never saved
+func (b *Booking) Revoke(at time.Time) *Booking {
+	c := *b
+	c.Status = BookingStatusCancelled
+	c.CancelledAt = &at
+	return &c
+}
+
+// MarkNoShow returns a copy of the booking marked as no-show if its session ended at the given time without check-in
+func (b *Booking) MarkNoShow(class *Class, at time.Time) (*Booking, bool) {
+	if b.Status != BookingStatusBooked || at.Before(class.SessionEnd(b.Date)) {
+		return nil, false
+	}
+
+	c := *b
+	c.Status = BookingStatusNoShow
+	return &c, true
+}
+
+// NewAttendance returns the attendance of the user for the given bookings
+func NewAttendance(userID string, bookings []*Booking) *Attendance {
+	a := &Attendance{
+		UserID:   userID,
+		Bookings: bookings,
+	}
+
+	for _, b := range bookings {
+		switch b.Status {
+		case BookingStatusBooked:
+			a.Booked++
+		case BookingStatusCheckedIn:
+			a.CheckedIn++
+		case BookingStatusNoShow:
+			a.NoShows++
+		case BookingStatusCancelled:
+			a.Cancelled++
+		}
+	}
+
+	return a
+}
@@ -8,19 +8,40 @@ import (
 	"github.com/think-free/ABCFitness-challenge/internal/errors"
 )
 
+// DefaultClassDuration is the duration in minutes of a class session when none is provided
+const DefaultClassDuration = 60
+
+// MaxClassYears is the longest a class can run, a class has a session every day so its range bounds the sessions listed
+const MaxClassYears = 5
+
+// BaseClass describes a class that takes place every day between StartDate and EndDate,
+// each session starts at the time of the day of StartDate and lasts Duration minutes
 type BaseClass struct {
-	Studio        string     `json:"studio"`
-	Name          string     `json:"class_name"`
-	StartDate     *time.Time `json:"start_date"`
-	EndDate       *time.Time `json:"end_date"`
-	DailyCapacity int        `json:"capacity"`
+	Studio        string        `json:"studio"`
+	Room          string        `json:"room,omitempty"`
+	Name          string        `json:"class_name"`
+	StartDate     *time.Time    `json:"start_date"`
+	EndDate       *time.Time    `json:"end_date"`
+	Duration      int           `json:"duration,omitempty"`
+	DailyCapacity int           `json:"capacity"`
+	Rules         *BookingRules `json:"rules,omitempty"`
 }
 
 type Class struct {
-	ID string `json:"id"`
+	ID      string `json:"id"`
+	Version int    `json:"version"`
 	BaseClass
 }
 
+// UpdateClassRequest changes a class, the fields not set are kept. The schedule of a class can't be changed once
+// created since it would move the sessions already booked
+type UpdateClassRequest struct {
+	Name          *string       `json:"class_name"`
+	Room          *string       `json:"room"`
+	DailyCapacity *int          `json:"capacity"`
+	Rules         *BookingRules `json:"rules"`
+}
+
 type CreateClassRequest struct {
 	BaseClass
 }
@@ -30,9 +51,14 @@ func NewClass(ctx context.Context, req *CreateClassRequest) (*Class, error) {
 
 	c := &Class{
 		ID:        id,
+		Version:   1,
 		BaseClass: req.BaseClass,
 	}
 
+	if c.Duration == 0 {
+		c.Duration = DefaultClassDuration
+	}
+
 	if !c.isValid() {
 		return nil, errors.ErrorValidationError()
 	}
@@ -40,13 +66,42 @@ func NewClass(ctx context.Context, req *CreateClassRequest) (*Class, error) {
 	return c, nil
 }
 
+// SessionStart returns the start time of the session of the class for the given day
+func (c *Class) SessionStart(day time.Time) time.Time {
+	d := Day(day)
+	st := c.StartDate.UTC()
+	return time.Date(d.Year(), d.Month(), d.Day(), st.Hour(), st.Minute(), st.Second(), 0, time.UTC)
+}
+
+// HasSessionOn returns true if the class has a session on the day of the given time
+func (c *Class) HasSessionOn(day time.Time) bool {
+	d := Day(day)
+	return !d.Before(Day(*c.StartDate)) && !d.After(Day(*c.EndDate))
+}
+
+// SessionEnd returns the end time of the session of the class for the given day
+func (c *Class) SessionEnd(day time.Time) time.Time {
+	return c.SessionStart(day).Add(time.Duration(c.Duration) * time.Minute)
+}
+
+// Overlaps returns true if both classes have sessions on a same day and those sessions intersect
+func (c *Class) Overlaps(o *Class) bool {
+	if Day(*c.StartDate).After(Day(*o.EndDate)) || Day(*o.StartDate).After(Day(*c.EndDate)) {
+		return false
+	}
+
+	// Sessions never cross midnight, so comparing them on any common day is enough
+	day := Day(*c.StartDate)
+	return c.SessionStart(day).Before(o.SessionEnd(day)) && o.SessionStart(day).Before(c.SessionEnd(day))
+}
+
 func (c *Class) isValid() bool {
 	// TODO: add true validation
 	if c.Studio == "" || c.Name == "" {
 		return false
 	}
 
-	if c.StartDate.After(*c.EndDate) {
+	if c.StartDate == nil || c.EndDate == nil || c.StartDate.After(*c.EndDate) || c.EndDate.After(c.StartDate.AddDate(MaxClassYears, 0, 0)) {
 		return false
 	}
 
@@ -54,5 +109,43 @@ func (c *Class) isValid() bool {
 		return false
 	}
 
+	if c.Rules != nil && !c.Rules.isValid() {
+		return false
+	}
+
+	// A session lasts at most a day, the bound also keeps the end of the session from overflowing
+	if c.Duration <= 0 || c.Duration > 24*60 || c.SessionEnd(*c.StartDate).After(Day(*c.StartDate).AddDate(0, 0, 1)) {
+		return false
+	}
+
 	return true
 }
+
+// Day returns the given time truncated to the start of its day in UTC
+func Day(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Update returns a copy of the class with the fields set in the request
+func (c *Class) Update(req *UpdateClassRequest) (*Class, error) {
+	u := *c
+	if req.Name != nil {
+		u.Name = *req.Name
+	}
+	if req.Room != nil {
+		u.Room = *req.Room
+	}
+	if req.DailyCapacity != nil {
+		u.DailyCapacity = *req.DailyCapacity
+	}
+	if req.Rules != nil {
+		u.Rules = req.Rules
+	}
+
+	if !u.isValid() {
+		return nil, errors.ErrorValidationError()
+	}
+
+	return &u, nil
+}
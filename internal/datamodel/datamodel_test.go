@@ -7,6 +7,7 @@ import (
 
 	"github.com/stretchr/testify/require"
 	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
 )
 
 func TestUser(t *testing.T) {
@@ -61,6 +62,14 @@ func TestClass(t *testing.T) {
 	require.Equal(t, startDate.Unix(), class.StartDate.Unix())
 	require.Equal(t, endDate.Unix(), class.EndDate.Unix())
 	require.Equal(t, dailyCapacity, class.DailyCapacity)
+
+	// A class runs at most MaxClassYears
+	endDate = startDate.AddDate(datamodel.MaxClassYears, 0, 0)
+	_, err = datamodel.NewClass(ctx, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: name, Studio: studio, StartDate: &startDate, EndDate: &endDate, DailyCapacity: dailyCapacity}})
+	require.NoError(t, err)
+	endDate = endDate.AddDate(0, 0, 1)
+	_, err = datamodel.NewClass(ctx, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{Name: name, Studio: studio, StartDate: &startDate, EndDate: &endDate, DailyCapacity: dailyCapacity}})
+	require.True(t, errors.IsValidationError(err))
 }
 
 func TestBooking(t *testing.T) {
@@ -85,3 +94,208 @@ func TestBooking(t *testing.T) {
 	require.Equal(t, uID, booking.UserID)
 	require.Equal(t, date.Unix(), booking.Date.Unix())
 }
+
+func TestClassOverlaps(t *testing.T) {
+	ctx := context.Background()
+
+	newClass := func(start, end time.Time, duration int) *datamodel.Class {
+		class, err := datamodel.NewClass(ctx, &datamodel.CreateClassRequest{
+			BaseClass: datamodel.BaseClass{
+				Name:          "Yoga",
+				Studio:        "Yoga Studio",
+				Room:          "Room 1",
+				StartDate:     &start,
+				EndDate:       &end,
+				Duration:      duration,
+				DailyCapacity: 10,
+			},
+		})
+		require.NoError(t, err)
+		return class
+	}
+
+	morning := newClass(time.Date(2023, 10, 1, 9, 0, 0, 0, time.UTC), time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC), 60)
+	require.Equal(t, time.Date(2023, 10, 5, 10, 0, 0, 0, time.UTC), morning.SessionEnd(time.Date(2023, 10, 5, 0, 0, 0, 0, time.UTC)))
+
+	// Same days, session starting while the morning one is running
+	require.True(t, morning.Overlaps(newClass(time.Date(2023, 10, 10, 9, 30, 0, 0, time.UTC), time.Date(2023, 10, 20, 0, 0, 0, 0, time.UTC), 60)))
+
+	// Same days, session starting when the morning one ends
+	require.False(t, morning.Overlaps(newClass(time.Date(2023, 10, 1, 10, 0, 0, 0, time.UTC), time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC), 30)))
+
+	// Same time of the day, but on other days
+	require.False(t, morning.Overlaps(newClass(time.Date(2023, 10, 16, 9, 0, 0, 0, time.UTC), time.Date(2023, 10, 20, 0, 0, 0, 0, time.UTC), 60)))
+
+	// Default duration is applied and sessions can't cross midnight
+	require.Equal(t, datamodel.DefaultClassDuration, newClass(time.Date(2023, 10, 1, 9, 0, 0, 0, time.UTC), time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC), 0).Duration)
+
+	start := time.Date(2023, 10, 1, 23, 30, 0, 0, time.UTC)
+	end := time.Date(2023, 10, 2, 0, 0, 0, 0, time.UTC)
+	_, err := datamodel.NewClass(ctx, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Name:          "Yoga",
+			Studio:        "Yoga Studio",
+			StartDate:     &start,
+			EndDate:       &end,
+			Duration:      60,
+			DailyCapacity: 10,
+		},
+	})
+	require.Error(t, err)
+}
+
+func TestMembership(t *testing.T) {
+	october := time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC)
+	november := time.Date(2023, 11, 10, 0, 0, 0, 0, time.UTC)
+
+	// A nil membership is unlimited, nothing is consumed
+	var unlimited *datamodel.Membership
+	consumed, err := unlimited.Consume(october)
+	require.NoError(t, err)
+	require.Nil(t, consumed)
+	require.Equal(t, datamodel.Unlimited, unlimited.Remaining(october))
+	require.False(t, unlimited.Refund(consumed))
+
+	// The monthly plan is consumed per calendar month
+	monthly, err := datamodel.NewMembership(&datamodel.Membership{Plan: datamodel.PlanMonthly, MonthlyClasses: 1})
+	require.NoError(t, err)
+	consumed, err = monthly.Consume(october)
+	require.NoError(t, err)
+	require.Equal(t, &datamodel.Consumption{MembershipID: monthly.ID, Plan: datamodel.PlanMonthly, Period: "2023-10"}, consumed)
+	_, err = monthly.Consume(october)
+	require.Error(t, err)
+	require.Equal(t, 0, monthly.Remaining(october))
+	require.Equal(t, 1, monthly.Remaining(november))
+	require.True(t, monthly.Refund(consumed))
+	require.Equal(t, 1, monthly.Remaining(october))
+
+	// The pack is consumed until there is no credit left
+	pack, err := datamodel.NewMembership(&datamodel.Membership{Plan: datamodel.PlanPack, Credits: 1})
+	require.NoError(t, err)
+	cp := pack.Copy()
+	consumed, err = pack.Consume(october)
+	require.NoError(t, err)
+	_, err = pack.Consume(november)
+	require.Error(t, err)
+	require.Equal(t, 1, cp.Remaining(october))
+
+	// The credit is only refunded to the membership it was consumed from, not to a plan set since
+	other, err := datamodel.NewMembership(&datamodel.Membership{Plan: datamodel.PlanPack, Credits: 1})
+	require.NoError(t, err)
+	require.NotEqual(t, pack.ID, other.ID)
+	require.False(t, other.Refund(consumed))
+	require.Equal(t, 1, other.Remaining(october))
+	require.False(t, monthly.Refund(consumed))
+	require.True(t, pack.Refund(consumed))
+	require.Equal(t, 1, pack.Remaining(october))
+
+	// A usage over the limit of a reduced monthly plan doesn't allow more bookings
+	monthly.MonthlyClasses = 1
+	monthly.Usage = map[string]int{"2023-10": 3}
+	require.Equal(t, -2, monthly.Remaining(october))
+	_, err = monthly.Consume(october)
+	require.Error(t, err)
+	require.Equal(t, -2, monthly.Remaining(october))
+
+	// Invalid plans are rejected
+	_, err = datamodel.NewMembership(&datamodel.Membership{Plan: datamodel.PlanMonthly})
+	require.Error(t, err)
+	_, err = datamodel.NewMembership(&datamodel.Membership{Plan: "gold"})
+	require.Error(t, err)
+}
+
+func TestBookingStatus(t *testing.T) {
+	ctx := context.Background()
+
+	start := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 10, 15, 0, 0, 0, 0, time.UTC)
+	class := &datamodel.Class{
+		ID: "class-id",
+		BaseClass: datamodel.BaseClass{
+			StartDate: &start,
+			EndDate:   &end,
+			Duration:  60,
+		},
+	}
+
+	booking, err := datamodel.NewBooking(ctx, &datamodel.CreateBookingRequest{
+		BaseBooking: datamodel.BaseBooking{
+			ClassID: class.ID,
+			UserID:  "user-id",
+			Date:    time.Date(2023, 10, 10, 0, 0, 0, 0, time.UTC),
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, datamodel.BookingStatusBooked, booking.Status)
+
+	// The check-in opens before the session and closes when it ends
+	_, err = booking.CheckIn(class, time.Date(2023, 10, 10, 17, 0, 0, 0, time.UTC))
+	require.Error(t, err)
+	_, err = booking.CheckIn(class, time.Date(2023, 10, 10, 19, 0, 0, 0, time.UTC))
+	require.Error(t, err)
+
+	checkedIn, err := booking.CheckIn(class, time.Date(2023, 10, 10, 17, 45, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.Equal(t, datamodel.BookingStatusCheckedIn, checkedIn.Status)
+	require.Equal(t, datamodel.BookingStatusBooked, booking.Status)
+
+	// An attended booking can't be cancelled nor marked as no-show
+	_, err = checkedIn.Cancel(class, 0, time.Date(2023, 10, 10, 17, 45, 0, 0, time.UTC))
+	require.Error(t, err)
+	_, ok := checkedIn.MarkNoShow(class, time.Date(2023, 10, 11, 0, 0, 0, 0, time.UTC))
+	require.False(t, ok)
+
+	// A booking is a no-show only once its session ended
+	_, ok = booking.MarkNoShow(class, time.Date(2023, 10, 10, 18, 30, 0, 0, time.UTC))
+	require.False(t, ok)
+	noShow, ok := booking.MarkNoShow(class, time.Date(2023, 10, 10, 19, 0, 0, 0, time.UTC))
+	require.True(t, ok)
+	require.Equal(t, datamodel.BookingStatusNoShow, noShow.Status)
+
+	// A booking can be cancelled until its session starts, or until the cut-off before it
+	_, err = booking.Cancel(class, 0, time.Date(2023, 10, 10, 18, 0, 1, 0, time.UTC))
+	require.True(t, errors.IsInvalidState(err))
+	_, err = booking.Cancel(class, 0, time.Date(2023, 10, 10, 19, 30, 0, 0, time.UTC))
+	require.True(t, errors.IsInvalidState(err))
+	_, err = booking.Cancel(class, time.Hour, time.Date(2023, 10, 10, 17, 30, 0, 0, time.UTC))
+	require.True(t, errors.IsInvalidState(err))
+
+	cancelled, err := booking.Cancel(class, time.Hour, time.Date(2023, 10, 10, 17, 0, 0, 0, time.UTC))
+	require.NoError(t, err)
+	require.False(t, cancelled.IsActive())
+	require.Equal(t, time.Date(2023, 10, 10, 17, 0, 0, 0, time.UTC), *cancelled.CancelledAt)
+}
+
+func TestNoShowPolicy(t *testing.T) {
+	ctx := context.Background()
+	policy := &datamodel.NoShowPolicy{Limit: 2, Window: 10 * 24 * time.Hour, Period: 7 * 24 * time.Hour}
+	now := time.Date(2023, 10, 20, 12, 0, 0, 0, time.UTC)
+
+	noShowOn := func(day int) *datamodel.Booking {
+		return &datamodel.Booking{
+			BaseBooking: datamodel.BaseBooking{Date: time.Date(2023, 10, day, 0, 0, 0, 0, time.UTC)},
+			Status:      datamodel.BookingStatusNoShow,
+		}
+	}
+
+	// Only the no-shows of the window are counted
+	require.Nil(t, policy.Evaluate(ctx, "user-id", now, []*datamodel.Booking{noShowOn(1), noShowOn(15)}, nil))
+
+	suspension := policy.Evaluate(ctx, "user-id", now, []*datamodel.Booking{noShowOn(12), noShowOn(15)}, nil)
+	require.NotNil(t, suspension)
+	require.Equal(t, 2, suspension.NoShows)
+	require.Equal(t, now.Add(policy.Period), suspension.Until)
+	require.True(t, suspension.IsActive(now))
+
+	// The no-shows already counted by the last suspension are not counted again
+	require.Nil(t, policy.Evaluate(ctx, "user-id", now.AddDate(0, 0, 8), []*datamodel.Booking{noShowOn(12), noShowOn(15), noShowOn(27)}, suspension))
+
+	lifted, err := suspension.Lift(now)
+	require.NoError(t, err)
+	require.False(t, lifted.IsActive(now))
+	_, err = lifted.Lift(now)
+	require.Error(t, err)
+
+	// A disabled policy never suspends
+	require.Nil(t, (&datamodel.NoShowPolicy{}).Evaluate(ctx, "user-id", now, []*datamodel.Booking{noShowOn(12), noShowOn(15)}, nil))
+}
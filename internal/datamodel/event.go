@@ -0,0 +1,97 @@
+package datamodel
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type EventType string
+
+const (
+	EventUserCreated       EventType = "user.created"
+	EventUserUpdated       EventType = "user.updated"
+	EventUserErased        EventType = "user.erased"
+	EventMembershipChanged EventType = "user.membership_changed"
+	EventUserSuspended     EventType = "user.suspended"
+	EventSuspensionLifted  EventType = "user.suspension_lifted"
+	EventClassCreated      EventType = "class.created"
+	EventClassUpdated      EventType = "class.updated"
+	EventBookingCreated    EventType = "booking.created"
+	EventBookingCancelled  EventType = "booking.cancelled"
+	EventBookingCheckedIn  EventType = "booking.checked_in"
+	EventBookingNoShow     EventType = "booking.no_show"
+)
+
+// Event is a domain event published after a successful change, Data is the json of the entity after the change
+type Event struct {
+	ID         string          `json:"id"`
+	Type       EventType       `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	EntityID   string          `json:"entity_id"`
+	Data       json.RawMessage `json:"data,omitempty"`
+	RequestID  string          `json:"request_id,omitempty"`
+
+	// ClientRequestID is the id sent by the client for the request of the change, see AuditEntry
+	ClientRequestID string `json:"client_request_id,omitempty"`
+
+	// Entity is the entity of the change, the database saving the event with the change sets Data to its json once the
+	// change is done so it has the version given by the database
+	Entity interface{} `json:"-"`
+
+	// Attempts is the number of failed publications of the event waiting in the outbox and Published the publishers
+	// of a fanout that already received it, by their position, they are not part of the published event
+	Attempts  int   `json:"-"`
+	Published []int `json:"-"`
+}
+
+// Seal sets the data of the event to the json of its entity, the events without entity keep their data
+func (e *Event) Seal() error {
+	if e.Entity == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(e.Entity)
+	if err != nil {
+		return err
+	}
+
+	e.Data = data
+	e.Entity = nil
+	return nil
+}
+
+// Decode decodes the entity of the event into v
+func (e *Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// HasUser returns true if the data of the event is a user, with its personal data unless it was erased
+func (e *Event) HasUser() bool {
+	switch e.Type {
+	case EventUserCreated, EventUserUpdated, EventUserErased, EventMembershipChanged:
+		return true
+	}
+	return false
+}
+
+// Redacted returns a copy of the event without the personal data of its user, the other events are returned as they are
+func (e *Event) Redacted() (*Event, error) {
+	if !e.HasUser() {
+		return e, nil
+	}
+
+	var user User
+	err := e.Decode(&user)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(user.Redacted())
+	if err != nil {
+		return nil, err
+	}
+
+	r := *e
+	r.Data = data
+	return &r, nil
+}
@@ -0,0 +1,124 @@
+package datamodel_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+// The fuzz tests decode arbitrary json as the api does and check the constructors never panic, the requests they
+// accept are valid and the others are rejected with a validation error
+
+func FuzzNewClass(f *testing.F) {
+	for _, seed := range []string{
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":"2023-10-06T18:30:00Z","end_date":"2023-10-15T00:00:00Z","capacity":10}`,
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":"2023-10-06T18:30:00Z","capacity":10}`,
+		`{"studio":"Studio 1","class_name":"Yoga","end_date":"2023-10-15T00:00:00Z","capacity":10}`,
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":null,"end_date":null,"capacity":10}`,
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":"2023-10-06T23:30:00Z","end_date":"2023-10-15T00:00:00Z","duration":9223372036854775807,"capacity":10}`,
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":"2023-10-06T18:30:00Z","end_date":"2023-10-15T00:00:00Z","capacity":10,"rules":{"max_advance_days":-1}}`,
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":"0001-01-01T00:00:00Z","end_date":"9999-12-31T23:59:59Z","capacity":1}`,
+		`{"studio":"Studio 1","class_name":"Yoga","start_date":"2023-10-06T18:30:00Z","end_date":"2028-10-06T18:30:00Z","capacity":1}`,
+		`{}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var req datamodel.CreateClassRequest
+		if json.Unmarshal(data, &req) != nil {
+			return
+		}
+
+		class, err := datamodel.NewClass(context.Background(), &req)
+		if err != nil {
+			if !errors.IsValidationError(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			return
+		}
+
+		if class.StartDate == nil || class.EndDate == nil || class.StartDate.After(*class.EndDate) {
+			t.Fatalf("invalid dates accepted : %v %v", class.StartDate, class.EndDate)
+		}
+		if class.EndDate.After(class.StartDate.AddDate(datamodel.MaxClassYears, 0, 0)) {
+			t.Fatalf("class running more than %d years accepted : %v %v", datamodel.MaxClassYears, class.StartDate, class.EndDate)
+		}
+		if class.DailyCapacity <= 0 || class.Duration <= 0 {
+			t.Fatalf("invalid capacity or duration accepted : %d %d", class.DailyCapacity, class.Duration)
+		}
+
+		// The sessions of a valid class can be computed
+		if !class.HasSessionOn(*class.StartDate) || class.SessionEnd(*class.StartDate).Before(class.SessionStart(*class.StartDate)) {
+			t.Fatalf("invalid session on %v", class.StartDate)
+		}
+		if !class.Overlaps(class) {
+			t.Fatal("a class doesn't overlap itself")
+		}
+	})
+}
+
+func FuzzNewUser(f *testing.F) {
+	for _, seed := range []string{
+		`{"name":"John","surname":"Doe","email":"john.doe@example.com","phone":"+34123456789"}`,
+		`{"email":"john.doe@example.com","phone":"+34123456789"}`,
+		`{"name":"John","surname":"Doe","email":"john.doe","phone":"+34123456789"}`,
+		`{"name":"John","surname":"Doe","email":"john.doe@example.com","phone":"123"}`,
+		`{}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var req datamodel.CreateUserRequest
+		if json.Unmarshal(data, &req) != nil {
+			return
+		}
+
+		user, err := datamodel.NewUser(context.Background(), &req)
+		if err != nil {
+			if !errors.IsValidationError(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			return
+		}
+
+		if user.ID == "" || user.Version != 1 || user.Membership != nil {
+			t.Fatalf("invalid user created : %+v", user)
+		}
+	})
+}
+
+func FuzzNewBooking(f *testing.F) {
+	for _, seed := range []string{
+		`{"class":"class-id","user":"user-id","date":"2023-10-10T00:00:00Z"}`,
+		`{"class":"class-id","user":"user-id"}`,
+		`{"class":"class-id","date":"2023-10-10T00:00:00Z"}`,
+		`{"class":"","user":"","date":"0001-01-01T00:00:00Z"}`,
+		`{}`,
+	} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var req datamodel.CreateBookingRequest
+		if json.Unmarshal(data, &req) != nil {
+			return
+		}
+
+		booking, err := datamodel.NewBooking(context.Background(), &req)
+		if err != nil {
+			if !errors.IsValidationError(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			return
+		}
+
+		if booking.ClassID == "" || booking.UserID == "" || booking.Date.IsZero() || booking.Status != datamodel.BookingStatusBooked {
+			t.Fatalf("invalid booking created : %+v", booking)
+		}
+	})
+}
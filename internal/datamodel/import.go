@@ -0,0 +1,54 @@
+package datamodel
+
+type ImportStatus string
+
+const (
+	ImportStatusCreated   ImportStatus = "created"
+	ImportStatusDuplicate ImportStatus = "duplicate"
+	ImportStatusInvalid   ImportStatus = "invalid"
+)
+
+// UserImportRow is a user to import read from the line Line of the imported file, Error is set if the line couldn't be read
+type UserImportRow struct {
+	Line    int
+	Request *CreateUserRequest
+	Error   string
+}
+
+// ClassImportRow is a class to import read from the line Line of the imported file, Error is set if the line couldn't be read
+type ClassImportRow struct {
+	Line    int
+	Request *CreateClassRequest
+	Error   string
+}
+
+// ImportResult is the outcome of the import of a row, ID is the id of the created entity or of the existing duplicate
+type ImportResult struct {
+	Line   int          `json:"line"`
+	Status ImportStatus `json:"status"`
+	ID     string       `json:"id,omitempty"`
+	Error  string       `json:"error,omitempty"`
+}
+
+// ImportReport is the outcome of an import row by row, nothing is saved in dry-run mode
+type ImportReport struct {
+	DryRun     bool            `json:"dry_run"`
+	Created    int             `json:"created"`
+	Duplicates int             `json:"duplicates"`
+	Invalid    int             `json:"invalid"`
+	Rows       []*ImportResult `json:"rows"`
+}
+
+// Add appends the result of a row to the report
+func (r *ImportReport) Add(res *ImportResult) {
+	switch res.Status {
+	case ImportStatusCreated:
+		r.Created++
+	case ImportStatusDuplicate:
+		r.Duplicates++
+	case ImportStatusInvalid:
+		r.Invalid++
+	}
+
+	r.Rows = append(r.Rows, res)
+}
@@ -0,0 +1,176 @@
+package datamodel
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+type Plan string
+
+const (
+	// PlanUnlimited allows to book any number of classes
+	PlanUnlimited Plan = "unlimited"
+	// PlanMonthly allows to book MonthlyClasses classes per calendar month
+	PlanMonthly Plan = "monthly"
+	// PlanPack allows to book as many classes as the Credits left in the pack
+	PlanPack Plan = "pack"
+)
+
+// Unlimited is the remaining credits reported for the unlimited plan
+const Unlimited = -1
+
+// Membership is the plan of a user and the state of its entitlement, a nil membership is an unlimited plan. Each plan
+// set has its own id so the credits consumed from a previous plan are never refunded to the current one
+type Membership struct {
+	ID             string         `json:"id,omitempty"`
+	Plan           Plan           `json:"plan"`
+	MonthlyClasses int            `json:"monthly_classes,omitempty"`
+	Credits        int            `json:"credits,omitempty"`
+	Usage          map[string]int `json:"usage,omitempty"` // classes booked per month with the monthly plan
+}
+
+// Consumption is the credit a booking consumed, from the membership of the id and for the month of Period with the
+// monthly plan
+type Consumption struct {
+	MembershipID string `json:"membership"`
+	Plan         Plan   `json:"plan"`
+	Period       string `json:"period,omitempty"`
+}
+
+// Credits is the entitlement of a user for the month of Period
+type Credits struct {
+	UserID    string `json:"user"`
+	Plan      Plan   `json:"plan"`
+	Period    string `json:"period"`
+	Remaining int    `json:"remaining"`
+}
+
+// NewMembership returns a copy of the requested membership with a fresh usage, or nil if the membership is invalid
+func NewMembership(req *Membership) (*Membership, error) {
+	if req == nil {
+		return nil, nil
+	}
+
+	m := &Membership{
+		ID:             uuid.New().String(),
+		Plan:           req.Plan,
+		MonthlyClasses: req.MonthlyClasses,
+		Credits:        req.Credits,
+	}
+
+	if !m.isValid() {
+		return nil, errors.ErrorValidationError()
+	}
+
+	return m, nil
+}
+
+// Copy returns a deep copy of the membership
+func (m *Membership) Copy() *Membership {
+	if m == nil {
+		return nil
+	}
+
+	c := *m
+	c.Usage = make(map[string]int, len(m.Usage))
+	for k, v := range m.Usage {
+		c.Usage[k] = v
+	}
+
+	return &c
+}
+
+// GetPlan returns the plan of the membership, unlimited for a nil membership
+func (m *Membership) GetPlan() Plan {
+	if m == nil {
+		return PlanUnlimited
+	}
+	return m.Plan
+}
+
+// Remaining returns the number of classes that can still be booked for the given date, Unlimited if there is no limit
+func (m *Membership) Remaining(date time.Time) int {
+	switch m.GetPlan() {
+	case PlanMonthly:
+		return m.MonthlyClasses - m.Usage[period(date)]
+	case PlanPack:
+		return m.Credits
+	default:
+		return Unlimited
+	}
+}
+
+// Consume uses one credit for a class on the given date and returns it, nil with the unlimited plan. It returns an error
+// if there is no credit left
+func (m *Membership) Consume(date time.Time) (*Consumption, error) {
+	// A pack or a monthly usage can be left below zero by a plan change, it must not allow more bookings
+	if remaining := m.Remaining(date); remaining != Unlimited && remaining <= 0 {
+		return nil, errors.ErrorNoCredits()
+	}
+
+	switch m.GetPlan() {
+	case PlanMonthly:
+		if m.Usage == nil {
+			m.Usage = make(map[string]int)
+		}
+		m.Usage[period(date)]++
+		return &Consumption{MembershipID: m.ID, Plan: PlanMonthly, Period: period(date)}, nil
+	case PlanPack:
+		m.Credits--
+		return &Consumption{MembershipID: m.ID, Plan: PlanPack}, nil
+	default:
+		return nil, nil
+	}
+}
+
+// Refund gives back the credit consumed by a booking and returns true, only if it was consumed from this membership.
+// A credit of a previous plan is lost with the plan, and nothing is refunded to the unlimited plan
+func (m *Membership) Refund(c *Consumption) bool {
+	if m == nil || c == nil || c.MembershipID != m.ID || c.Plan != m.Plan {
+		return false
+	}
+
+	switch m.Plan {
+	case PlanMonthly:
+		if m.Usage[c.Period] <= 0 {
+			return false
+		}
+		m.Usage[c.Period]--
+	case PlanPack:
+		m.Credits++
+	default:
+		return false
+	}
+
+	return true
+}
+
+// CreditsAt returns the entitlement of the user for the month of the given date
+func (u *User) CreditsAt(date time.Time) *Credits {
+	return &Credits{
+		UserID:    u.ID,
+		Plan:      u.Membership.GetPlan(),
+		Period:    period(date),
+		Remaining: u.Membership.Remaining(date),
+	}
+}
+
+func (m *Membership) isValid() bool {
+	switch m.Plan {
+	case PlanUnlimited:
+		return m.MonthlyClasses == 0 && m.Credits == 0
+	case PlanMonthly:
+		return m.MonthlyClasses > 0 && m.Credits == 0
+	case PlanPack:
+		return m.MonthlyClasses == 0 && m.Credits >= 0
+	default:
+		return false
+	}
+}
+
+// period returns the calendar month of the date, used as key of the monthly usage
+func period(date time.Time) string {
+	return date.UTC().Format("2006-01")
+}
@@ -0,0 +1,71 @@
+package datamodel
+
+import (
+	"context"
+
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+// RuleDisabled is the value of a rule of the class rules disabling the rule of the studio, a zero value keeps it
+const RuleDisabled = -1
+
+// BookingRules configures the rules evaluated before a booking is saved, a zero or RuleDisabled value disables the rule
+type BookingRules struct {
+	MaxAdvanceDays           int `json:"max_advance_days,omitempty"`
+	CutOffMinutes            int `json:"cutoff_minutes,omitempty"`
+	MaxPerUserPerClassPerDay int `json:"max_per_class_per_day,omitempty"`
+	MaxOpenBookings          int `json:"max_open_bookings,omitempty"`
+}
+
+// StudioRules are the booking rules applied to all the classes of a studio
+type StudioRules struct {
+	Studio string `json:"studio"`
+	BookingRules
+}
+
+func NewStudioRules(ctx context.Context, studio string, req *BookingRules) (*StudioRules, error) {
+	sr := &StudioRules{
+		Studio:       studio,
+		BookingRules: *req,
+	}
+
+	if sr.Studio == "" || !sr.BookingRules.isValid() {
+		return nil, errors.ErrorValidationError()
+	}
+
+	return sr, nil
+}
+
+// Merge returns the rules with the fields set in override replacing the ones of r, any of them can be nil. An override
+// can relax a rule with a larger value or disable it with RuleDisabled, the disabled rules are 0 in the merged rules
+func (r *BookingRules) Merge(override *BookingRules) *BookingRules {
+	merged := &BookingRules{}
+	if r != nil {
+		*merged = *r
+	}
+	if override == nil {
+		override = &BookingRules{}
+	}
+
+	merged.MaxAdvanceDays = mergeRule(merged.MaxAdvanceDays, override.MaxAdvanceDays)
+	merged.CutOffMinutes = mergeRule(merged.CutOffMinutes, override.CutOffMinutes)
+	merged.MaxPerUserPerClassPerDay = mergeRule(merged.MaxPerUserPerClassPerDay, override.MaxPerUserPerClassPerDay)
+	merged.MaxOpenBookings = mergeRule(merged.MaxOpenBookings, override.MaxOpenBookings)
+
+	return merged
+}
+
+// mergeRule returns the override of the rule if it is set, 0 if the result is disabled
+func mergeRule(rule, override int) int {
+	if override != 0 {
+		rule = override
+	}
+	if rule == RuleDisabled {
+		return 0
+	}
+	return rule
+}
+
+func (r *BookingRules) isValid() bool {
+	return r.MaxAdvanceDays >= RuleDisabled && r.CutOffMinutes >= RuleDisabled && r.MaxPerUserPerClassPerDay >= RuleDisabled && r.MaxOpenBookings >= RuleDisabled
+}
@@ -0,0 +1,79 @@
+package datamodel
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+// NoShowPolicy suspends the booking privileges of a user for Period after Limit no-shows within Window, a zero Limit disables it
+type NoShowPolicy struct {
+	Limit  int
+	Window time.Duration
+	Period time.Duration
+}
+
+// Suspension forbids a user to book classes between From and Until unless it is lifted
+type Suspension struct {
+	ID       string     `json:"id"`
+	UserID   string     `json:"user"`
+	From     time.Time  `json:"from"`
+	Until    time.Time  `json:"until"`
+	NoShows  int        `json:"no_shows"`
+	LiftedAt *time.Time `json:"lifted_at,omitempty"`
+}
+
+// Enabled returns true if the policy suspends users
+func (p *NoShowPolicy) Enabled() bool {
+	return p != nil && p.Limit > 0
+}
+
+// Evaluate returns a suspension starting at the given time if the no-shows of the user since the end of its last
+// suspension reach the limit within the window, each no-show is only counted for a single suspension
+func (p *NoShowPolicy) Evaluate(ctx context.Context, userID string, at time.Time, bookings []*Booking, last *Suspension) *Suspension {
+	if !p.Enabled() {
+		return nil
+	}
+
+	since := at.Add(-p.Window)
+	if last != nil && last.From.After(since) {
+		since = last.From
+	}
+
+	count := 0
+	for _, b := range bookings {
+		if b.Status == BookingStatusNoShow && b.Date.After(since) && !b.Date.After(at) {
+			count++
+		}
+	}
+
+	if count < p.Limit {
+		return nil
+	}
+
+	return &Suspension{
+		ID:      uuid.New().String(),
+		UserID:  userID,
+		From:    at,
+		Until:   at.Add(p.Period),
+		NoShows: count,
+	}
+}
+
+// IsActive returns true if the suspension forbids to book at the given time
+func (s *Suspension) IsActive(at time.Time) bool {
+	return s.LiftedAt == nil && !at.Before(s.From) && at.Before(s.Until)
+}
+
+// Lift returns a copy of the suspension lifted at the given time, only an active suspension can be lifted
+func (s *Suspension) Lift(at time.Time) (*Suspension, error) {
+	if !s.IsActive(at) {
+		return nil, errors.ErrorInvalidState()
+	}
+
+	c := *s
+	c.LiftedAt = &at
+	return &c, nil
+}
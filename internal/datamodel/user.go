@@ -3,6 +3,7 @@ package datamodel
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/think-free/ABCFitness-challenge/internal/errors"
@@ -15,13 +16,36 @@ type BaseUser struct {
 	Phone   string `json:"phone"`
 }
 
+// CreateUserRequest creates a user with the unlimited plan, its membership is only set by the staff with SetMembership.
+// The studio is the home studio of the member, the staff only manage the members of their studio
 type CreateUserRequest struct {
 	BaseUser
+	Studio string `json:"studio,omitempty"`
 }
 
 type User struct {
-	ID string `json:"id"`
+	ID      string `json:"id"`
+	Version int    `json:"version"`
 	BaseUser
+	Studio     string      `json:"studio,omitempty"`
+	Membership *Membership `json:"membership,omitempty"`
+	ErasedAt   *time.Time  `json:"erased_at,omitempty"`
+}
+
+// UpdateUserRequest changes the contact details of a user, the fields not set are kept
+type UpdateUserRequest struct {
+	Name    *string `json:"name"`
+	Surname *string `json:"surname"`
+	Email   *string `json:"email"`
+	Phone   *string `json:"phone"`
+}
+
+// UserExport is the archive of all the data kept about a user
+type UserExport struct {
+	ExportedAt  time.Time     `json:"exported_at"`
+	User        *User         `json:"user"`
+	Attendance  *Attendance   `json:"attendance"`
+	Suspensions []*Suspension `json:"suspensions"`
 }
 
 func NewUser(ctx context.Context, req *CreateUserRequest) (*User, error) {
@@ -29,7 +53,9 @@ func NewUser(ctx context.Context, req *CreateUserRequest) (*User, error) {
 
 	u := &User{
 		ID:       id,
+		Version:  1,
 		BaseUser: req.BaseUser,
+		Studio:   req.Studio,
 	}
 
 	if !u.isValid() {
@@ -45,3 +71,61 @@ func (u *User) isValid() bool {
 		strings.Contains(u.Email, ".") &&
 		strings.Contains(u.Phone, "+")
 }
+
+// Erase returns a copy of the user without its personal data, the id, the studio and the membership are kept so the
+// bookings of the user still count in the statistics
+func (u *User) Erase(at time.Time) (*User, error) {
+	if u.ErasedAt != nil {
+		return nil, errors.ErrorInvalidState()
+	}
+
+	return &User{
+		ID:         u.ID,
+		Version:    u.Version,
+		Studio:     u.Studio,
+		Membership: u.Membership,
+		ErasedAt:   &at,
+	}, nil
+}
+
+// Redacted returns a copy of the user without its personal data, the audit trail is append-only so it only keeps
+// these copies that an erasure doesn't need to change
+func (u *User) Redacted() *User {
+	if u == nil {
+		return nil
+	}
+
+	r := *u
+	r.Name = ""
+	r.Surname = ""
+	r.Email = ""
+	r.Phone = ""
+	return &r
+}
+
+// Update returns a copy of the user with the fields set in the request, an erased user can't be updated
+func (u *User) Update(req *UpdateUserRequest) (*User, error) {
+	if u.ErasedAt != nil {
+		return nil, errors.ErrorInvalidState()
+	}
+
+	c := *u
+	if req.Name != nil {
+		c.Name = *req.Name
+	}
+	if req.Surname != nil {
+		c.Surname = *req.Surname
+	}
+	if req.Email != nil {
+		c.Email = *req.Email
+	}
+	if req.Phone != nil {
+		c.Phone = *req.Phone
+	}
+
+	if !c.isValid() {
+		return nil, errors.ErrorValidationError()
+	}
+
+	return &c, nil
+}
@@ -0,0 +1,33 @@
+package datamodel
+
+import (
+	"context"
+
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+type t string
+
+var ifMatchKey t = "if_match"
+
+// ContextWithIfMatch returns a copy of the context requiring the entity changed by the request to have one of the versions
+func ContextWithIfMatch(ctx context.Context, versions []int) context.Context {
+	return context.WithValue(ctx, ifMatchKey, versions)
+}
+
+// CheckVersion returns a precondition failed error if the context requires another version than the current one of
+// the entity, the entities can always be changed when the context has no requirement
+func CheckVersion(ctx context.Context, current int) error {
+	versions, ok := ctx.Value(ifMatchKey).([]int)
+	if !ok {
+		return nil
+	}
+
+	for _, v := range versions {
+		if v == current {
+			return nil
+		}
+	}
+
+	return errors.ErrorPreconditionFailed()
+}
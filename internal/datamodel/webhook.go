@@ -0,0 +1,237 @@
+package datamodel
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+// EventTypes are the types of the domain events a webhook can subscribe to
+var EventTypes = []EventType{
+	EventUserCreated,
+	EventUserUpdated,
+	EventUserErased,
+	EventMembershipChanged,
+	EventUserSuspended,
+	EventSuspensionLifted,
+	EventClassCreated,
+	EventClassUpdated,
+	EventBookingCreated,
+	EventBookingCancelled,
+	EventBookingCheckedIn,
+	EventBookingNoShow,
+}
+
+// IsValid returns true if the type is a known domain event
+func (t EventType) IsValid() bool {
+	for _, et := range EventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+// webhookSecretLength is the number of random bytes of the generated secrets
+const webhookSecretLength = 32
+
+// Webhook is a subscription of a partner to the domain events, the events of the subscribed types are sent to the url
+// signed with the secret. The secret is only returned when the webhook is created or its secret replaced.
+type Webhook struct {
+	ID        string      `json:"id"`
+	URL       string      `json:"url"`
+	Events    []EventType `json:"events"`
+	Secret    string      `json:"secret,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	Version   int         `json:"version"`
+}
+
+type CreateWebhookRequest struct {
+	URL    string      `json:"url"`
+	Events []EventType `json:"events"`
+	// Secret signs the deliveries, a random one is generated if empty
+	Secret string `json:"secret"`
+}
+
+// UpdateWebhookRequest changes a webhook, the fields not set are kept
+type UpdateWebhookRequest struct {
+	URL    *string     `json:"url"`
+	Events []EventType `json:"events"`
+	Secret *string     `json:"secret"`
+}
+
+func NewWebhook(ctx context.Context, req *CreateWebhookRequest, now time.Time) (*Webhook, error) {
+	secret := req.Secret
+	if secret == "" {
+		var err error
+		secret, err = newWebhookSecret()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	w := &Webhook{
+		ID:        uuid.New().String(),
+		URL:       req.URL,
+		Events:    req.Events,
+		Secret:    secret,
+		CreatedAt: now,
+		Version:   1,
+	}
+
+	if !w.isValid() {
+		return nil, errors.ErrorValidationError()
+	}
+
+	return w, nil
+}
+
+// Update returns a copy of the webhook with the changes of the request
+func (w *Webhook) Update(req *UpdateWebhookRequest) (*Webhook, error) {
+	u := *w
+	if req.URL != nil {
+		u.URL = *req.URL
+	}
+	if req.Events != nil {
+		u.Events = req.Events
+	}
+	if req.Secret != nil {
+		u.Secret = *req.Secret
+	}
+
+	if !u.isValid() {
+		return nil, errors.ErrorValidationError()
+	}
+
+	return &u, nil
+}
+
+// Subscribes returns true if the webhook wants the events of the type
+func (w *Webhook) Subscribes(t EventType) bool {
+	for _, et := range w.Events {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+// Redacted returns a copy of the webhook without its secret
+func (w *Webhook) Redacted() *Webhook {
+	r := *w
+	r.Secret = ""
+	return &r
+}
+
+func (w *Webhook) isValid() bool {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+
+	if len(w.Events) == 0 || w.Secret == "" {
+		return false
+	}
+
+	for _, t := range w.Events {
+		if !t.IsValid() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newWebhookSecret() (string, error) {
+	b := make([]byte, webhookSecretLength)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookDeliveryPending is waiting for its next attempt
+	WebhookDeliveryPending WebhookDeliveryStatus = "pending"
+	// WebhookDeliveryDelivered was accepted by the partner
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookDeliveryDead failed all its attempts and is kept in the dead-letter list until retried
+	WebhookDeliveryDead WebhookDeliveryStatus = "dead"
+)
+
+// WebhookDelivery is the sending of an event to a webhook, it records the outcome of its last attempt
+type WebhookDelivery struct {
+	ID            string                `json:"id"`
+	WebhookID     string                `json:"webhook"`
+	URL           string                `json:"url"`
+	Event         *Event                `json:"event"`
+	Status        WebhookDeliveryStatus `json:"status"`
+	Attempts      int                   `json:"attempts"`
+	CreatedAt     time.Time             `json:"created_at"`
+	LastAttemptAt *time.Time            `json:"last_attempt_at,omitempty"`
+	NextAttemptAt *time.Time            `json:"next_attempt_at,omitempty"`
+	ResponseCode  int                   `json:"response_code,omitempty"`
+	Error         string                `json:"error,omitempty"`
+}
+
+// webhookDeliveryNamespace makes the id of a delivery depend only on its event and webhook
+var webhookDeliveryNamespace = uuid.MustParse("5a0f3d1e-8f0c-4a1c-9d51-4b7a8e2c6f10")
+
+// NewWebhookDelivery returns the pending delivery of the event to the webhook, an event published again gets the same id
+func NewWebhookDelivery(w *Webhook, e *Event, now time.Time) *WebhookDelivery {
+	return &WebhookDelivery{
+		ID:            uuid.NewSHA1(webhookDeliveryNamespace, []byte(e.ID+"/"+w.ID)).String(),
+		WebhookID:     w.ID,
+		URL:           w.URL,
+		Event:         e,
+		Status:        WebhookDeliveryPending,
+		CreatedAt:     now,
+		NextAttemptAt: &now,
+	}
+}
+
+// IsDue returns true if the delivery is pending and its next attempt is not after the given time
+func (d *WebhookDelivery) IsDue(at time.Time) bool {
+	return d.Status == WebhookDeliveryPending && (d.NextAttemptAt == nil || !d.NextAttemptAt.After(at))
+}
+
+// WebhookDeliveryFilter selects deliveries, empty fields match everything
+type WebhookDeliveryFilter struct {
+	WebhookID string                `json:"webhook"`
+	Status    WebhookDeliveryStatus `json:"status"`
+	EntityID  string                `json:"entity_id"`
+	Offset    int                   `json:"offset"`
+	Count     int                   `json:"count"`
+}
+
+// Matches returns true if the delivery is selected by the filter
+func (f *WebhookDeliveryFilter) Matches(d *WebhookDelivery) bool {
+	return (f.WebhookID == "" || f.WebhookID == d.WebhookID) &&
+		(f.Status == "" || f.Status == d.Status) &&
+		(f.EntityID == "" || (d.Event != nil && f.EntityID == d.Event.EntityID))
+}
+
+// Page returns the deliveries of the page selected by the offset and count of the filter, ignored when not positive
+func (f *WebhookDeliveryFilter) Page(deliveries []*WebhookDelivery) []*WebhookDelivery {
+	if f.Offset > 0 {
+		if f.Offset >= len(deliveries) {
+			return nil
+		}
+		deliveries = deliveries[f.Offset:]
+	}
+
+	if f.Count > 0 && f.Count < len(deliveries) {
+		deliveries = deliveries[:f.Count]
+	}
+
+	return deliveries
+}
@@ -1,13 +1,83 @@
 package errors
 
-import "errors"
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
 
 const (
 	ValidationError = "validation error"
 	AlreadyExists   = "already exists"
 	NotFound        = "not found"
+	Conflict        = "conflict"
+	NoCredits       = "no credits left"
+	RuleViolation   = "rule violation"
+	InvalidState    = "invalid state"
+	Suspended       = "booking privileges suspended"
+	Unauthorized    = "unauthorized"
+	Forbidden       = "forbidden"
+
+	PreconditionFailed   = "precondition failed"
+	UnsupportedMediaType = "unsupported media type"
+	RequestTooLarge      = "request too large"
+	ClassFull            = "class full"
+
+	IdempotencyKeyReused = "idempotency key reused with a different request"
+	RequestInProgress    = "request in progress"
 )
 
+// ConflictError is returned when an entity clashes with existing ones, it carries the ids of the clashing entities
+type ConflictError struct {
+	IDs []string
+}
+
+func (e *ConflictError) Error() string {
+	if len(e.IDs) == 0 {
+		return Conflict
+	}
+	return Conflict + " with : " + strings.Join(e.IDs, ", ")
+}
+
+// RuleViolationError is returned when a booking rule rejects a booking, it carries the name of the rule
+type RuleViolationError struct {
+	Rule   string
+	Reason string
+}
+
+func (e *RuleViolationError) Error() string {
+	return RuleViolation + " : " + e.Rule + " : " + e.Reason
+}
+
+// DecodeError is returned when the body of a request is not the json expected, it carries the field and the byte offset
+// of the body where the decoding failed when they are known
+type DecodeError struct {
+	Field  string
+	Offset int64
+	Reason string
+}
+
+func (e *DecodeError) Error() string {
+	msg := ValidationError + " : " + e.Reason
+	if e.Field != "" {
+		msg += " : field '" + e.Field + "'"
+	}
+	if e.Offset > 0 {
+		msg += " at offset " + strconv.FormatInt(e.Offset, 10)
+	}
+	return msg
+}
+
+// SuspendedError is returned when a suspended user tries to book a class
+type SuspendedError struct {
+	Until time.Time
+}
+
+func (e *SuspendedError) Error() string {
+	return Suspended + " until " + e.Until.Format(time.RFC3339)
+}
+
 func ErrorValidationError() error {
 	return errors.New(ValidationError)
 }
@@ -24,6 +94,62 @@ func ErrorNotFound() error {
 	return errors.New(NotFound)
 }
 
+func ErrorConflict(ids ...string) error {
+	return &ConflictError{IDs: ids}
+}
+
+func ErrorNoCredits() error {
+	return errors.New(NoCredits)
+}
+
+func ErrorInvalidState() error {
+	return errors.New(InvalidState)
+}
+
+func ErrorUnauthorized() error {
+	return errors.New(Unauthorized)
+}
+
+func ErrorForbidden() error {
+	return errors.New(Forbidden)
+}
+
+func ErrorPreconditionFailed() error {
+	return errors.New(PreconditionFailed)
+}
+
+func ErrorClassFull() error {
+	return errors.New(ClassFull)
+}
+
+func ErrorUnsupportedMediaType() error {
+	return errors.New(UnsupportedMediaType)
+}
+
+func ErrorRequestTooLarge() error {
+	return errors.New(RequestTooLarge)
+}
+
+func ErrorDecode(field string, offset int64, reason string) error {
+	return &DecodeError{Field: field, Offset: offset, Reason: reason}
+}
+
+func ErrorIdempotencyKeyReused() error {
+	return errors.New(IdempotencyKeyReused)
+}
+
+func ErrorRequestInProgress() error {
+	return errors.New(RequestInProgress)
+}
+
+func ErrorRuleViolation(rule, reason string) error {
+	return &RuleViolationError{Rule: rule, Reason: reason}
+}
+
+func ErrorSuspended(until time.Time) error {
+	return &SuspendedError{Until: until}
+}
+
 func IsAlreadyExists(err error) bool {
 	return err.Error() == AlreadyExists
 }
@@ -31,3 +157,63 @@ func IsAlreadyExists(err error) bool {
 func IsNotFound(err error) bool {
 	return err.Error() == NotFound
 }
+
+func IsNoCredits(err error) bool {
+	return err.Error() == NoCredits
+}
+
+func IsInvalidState(err error) bool {
+	return err.Error() == InvalidState
+}
+
+func IsUnauthorized(err error) bool {
+	return err.Error() == Unauthorized
+}
+
+func IsForbidden(err error) bool {
+	return err.Error() == Forbidden
+}
+
+func IsPreconditionFailed(err error) bool {
+	return err.Error() == PreconditionFailed
+}
+
+func IsClassFull(err error) bool {
+	return err.Error() == ClassFull
+}
+
+func IsUnsupportedMediaType(err error) bool {
+	return err.Error() == UnsupportedMediaType
+}
+
+func IsRequestTooLarge(err error) bool {
+	return err.Error() == RequestTooLarge
+}
+
+func IsIdempotencyKeyReused(err error) bool {
+	return err.Error() == IdempotencyKeyReused
+}
+
+func IsRequestInProgress(err error) bool {
+	return err.Error() == RequestInProgress
+}
+
+func IsConflict(err error) bool {
+	var ce *ConflictError
+	return errors.As(err, &ce)
+}
+
+func IsRuleViolation(err error) bool {
+	var re *RuleViolationError
+	return errors.As(err, &re)
+}
+
+func IsSuspended(err error) bool {
+	var se *SuspendedError
+	return errors.As(err, &se)
+}
+
+func IsDecodeError(err error) bool {
+	var de *DecodeError
+	return errors.As(err, &de)
+}
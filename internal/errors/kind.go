@@ -0,0 +1,63 @@
+package errors
+
+// Kind is the class of an error as seen by the clients, each transport maps a kind to its own status
+type Kind int
+
+const (
+	KindInternal Kind = iota
+	KindValidation
+	KindNotFound
+	KindAlreadyExists
+	// KindConflict is a change that clashes with other entities or with a concurrent request
+	KindConflict
+	// KindInvalidState is a change that is not allowed in the current state of the entity
+	KindInvalidState
+	KindClassFull
+	KindUnauthorized
+	// KindForbidden is a principal or a user that is not allowed to do the change
+	KindForbidden
+	KindNoCredits
+	KindPreconditionFailed
+	KindUnsupportedMediaType
+	KindRequestTooLarge
+	// KindRejected is a well formed request refused by a business rule
+	KindRejected
+)
+
+// KindOf returns the kind of the error, KindInternal for the unknown errors
+func KindOf(err error) Kind {
+	if err == nil {
+		return KindInternal
+	}
+
+	switch {
+	case IsValidationError(err), IsDecodeError(err):
+		return KindValidation
+	case IsNotFound(err):
+		return KindNotFound
+	case IsAlreadyExists(err):
+		return KindAlreadyExists
+	case IsConflict(err), IsRequestInProgress(err):
+		return KindConflict
+	case IsInvalidState(err):
+		return KindInvalidState
+	case IsClassFull(err):
+		return KindClassFull
+	case IsUnauthorized(err):
+		return KindUnauthorized
+	case IsForbidden(err), IsSuspended(err):
+		return KindForbidden
+	case IsNoCredits(err):
+		return KindNoCredits
+	case IsPreconditionFailed(err):
+		return KindPreconditionFailed
+	case IsUnsupportedMediaType(err):
+		return KindUnsupportedMediaType
+	case IsRequestTooLarge(err):
+		return KindRequestTooLarge
+	case IsRuleViolation(err), IsIdempotencyKeyReused(err):
+		return KindRejected
+	default:
+		return KindInternal
+	}
+}
@@ -0,0 +1,197 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+const (
+	// relayBatch is the number of events read from the outbox at once
+	relayBatch = 100
+	// relayMaxAttempts is the number of failed publications after which an event goes to the dead-letter list
+	relayMaxAttempts = 10
+)
+
+// Publisher delivers the domain events to the systems reacting to them
+type Publisher interface {
+	Publish(ctx context.Context, e *datamodel.Event) error
+}
+
+// Outbox stores the events until they are published, it is implemented by the database so the events are saved
+// with the changes producing them
+type Outbox interface {
+	SaveOutboxEvent(ctx context.Context, e *datamodel.Event) error
+	ListOutboxEvents(ctx context.Context, count int) ([]*datamodel.Event, error)
+	UpdateOutboxEvent(ctx context.Context, e *datamodel.Event) error
+	DeleteOutboxEvent(ctx context.Context, id string) error
+	// DeadLetterOutboxEvent moves the event out of the outbox to the dead-letter list with its last attempts
+	DeadLetterOutboxEvent(ctx context.Context, e *datamodel.Event) error
+}
+
+// Relay publishes the events of the outbox in order and removes them once published, so the events are delivered at
+// least once. An event that can't be published stays in the outbox and is retried on the next flushes without
+// blocking the ones after it, after relayMaxAttempts failures it goes to the dead-letter list.
+type Relay struct {
+	outbox    Outbox
+	publisher Publisher
+
+	// mu serializes the flushes to keep the order of the events
+	mu     sync.Mutex
+	notify chan struct{}
+}
+
+func NewRelay(outbox Outbox, publisher Publisher) *Relay {
+	return &Relay{
+		outbox:    outbox,
+		publisher: publisher,
+		notify:    make(chan struct{}, 1),
+	}
+}
+
+// Notify wakes up the running relay to publish the new events without waiting for the next interval
+func (r *Relay) Notify() {
+	select {
+	case r.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Exclusive runs fn between two flushes, so a flush can't save the copies of the events it read over the changes fn
+// makes to the outbox
+func (r *Relay) Exclusive(fn func() error) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return fn()
+}
+
+// Flush publishes the events of the outbox once, the failed ones are skipped until the next flush. It returns the
+// number of events published and an error if some of them failed.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	published := 0
+	var errs []error
+
+	// The failed events stay at the start of the outbox, they are read again with the next ones but not published
+	// again by this flush
+	failed := make(map[string]bool)
+	for {
+		events, err := r.outbox.ListOutboxEvents(ctx, len(failed)+relayBatch)
+		if err != nil {
+			return published, err
+		}
+
+		pending := 0
+		for _, e := range events {
+			if failed[e.ID] {
+				continue
+			}
+			pending++
+
+			// The publishers record their progress on a copy, the outbox is only changed through its methods
+			ev := *e
+			ev.Published = append([]int(nil), e.Published...)
+
+			failure := r.publisher.Publish(ctx, &ev)
+			if failure != nil {
+				failed[e.ID] = true
+				errs = append(errs, fmt.Errorf("event '%s' not published : %w", e.ID, failure))
+
+				err = r.fail(ctx, &ev, failure)
+				if err != nil {
+					return published, err
+				}
+				continue
+			}
+
+			err = r.outbox.DeleteOutboxEvent(ctx, e.ID)
+			if err != nil {
+				return published, err
+			}
+
+			published++
+		}
+
+		if pending == 0 {
+			return published, errors.Join(errs...)
+		}
+	}
+}
+
+// fail saves the failed attempt to publish the event, it goes to the dead-letter list after its last attempt
+func (r *Relay) fail(ctx context.Context, e *datamodel.Event, failure error) error {
+	log := logging.Logger(ctx)
+
+	e.Attempts++
+	if e.Attempts >= relayMaxAttempts {
+		log.Errorf("event '%s' of '%s' dead after %d attempts : %v", e.ID, e.EntityID, e.Attempts, failure)
+		return r.outbox.DeadLetterOutboxEvent(ctx, e)
+	}
+
+	log.Warnf("error publishing event '%s' of '%s', attempt %d : %v", e.ID, e.EntityID, e.Attempts, failure)
+	return r.outbox.UpdateOutboxEvent(ctx, e)
+}
+
+// Run flushes the outbox when notified and every interval until the context is done
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	log := logging.Logger(ctx)
+
+	log.Infof("event relay running every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("event relay stopped")
+			return
+		case <-ticker.C:
+		case <-r.notify:
+		}
+
+		n, err := r.Flush(ctx)
+		if err != nil {
+			log.Errorf("error publishing events, %d published : %v", n, err)
+		}
+	}
+}
+
+// PublisherFunc adapts a function to the Publisher interface
+type PublisherFunc func(ctx context.Context, e *datamodel.Event) error
+
+func (f PublisherFunc) Publish(ctx context.Context, e *datamodel.Event) error {
+	return f(ctx, e)
+}
+
+// Fanout returns a publisher publishing the events to all the publishers, it returns the errors of the ones that
+// failed after trying all of them. The publishers that received an event are recorded in it by their position so a
+// republished event only goes to the ones that failed.
+func Fanout(publishers ...Publisher) Publisher {
+	return PublisherFunc(func(ctx context.Context, e *datamodel.Event) error {
+		var errs []error
+		for i, p := range publishers {
+			if slices.Contains(e.Published, i) {
+				continue
+			}
+
+			err := p.Publish(ctx, e)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+
+			e.Published = append(e.Published, i)
+		}
+		return errors.Join(errs...)
+	})
+}
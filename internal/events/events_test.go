@@ -0,0 +1,180 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/think-free/ABCFitness-challenge/internal/database/memory"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/events"
+	"github.com/think-free/ABCFitness-challenge/internal/events/inprocess"
+)
+
+func TestBus(t *testing.T) {
+	ctx := context.Background()
+	bus := inprocess.New(ctx)
+
+	var all, bookings []string
+	bus.Subscribe(func(ctx context.Context, e *datamodel.Event) error {
+		all = append(all, e.ID)
+		return nil
+	})
+	unsubscribe := bus.Subscribe(func(ctx context.Context, e *datamodel.Event) error {
+		bookings = append(bookings, e.ID)
+		return nil
+	}, datamodel.EventBookingCreated, datamodel.EventBookingCancelled)
+
+	assert.NoError(t, bus.Publish(ctx, &datamodel.Event{ID: "1", Type: datamodel.EventUserCreated}))
+	assert.NoError(t, bus.Publish(ctx, &datamodel.Event{ID: "2", Type: datamodel.EventBookingCreated}))
+	assert.Equal(t, []string{"1", "2"}, all)
+	assert.Equal(t, []string{"2"}, bookings)
+
+	unsubscribe()
+	assert.NoError(t, bus.Publish(ctx, &datamodel.Event{ID: "3", Type: datamodel.EventBookingCancelled}))
+	assert.Equal(t, []string{"2"}, bookings)
+
+	// The failures of the handlers are returned once all of them were called
+	bus.Subscribe(func(ctx context.Context, e *datamodel.Event) error {
+		panic("boom")
+	})
+	bus.Subscribe(func(ctx context.Context, e *datamodel.Event) error {
+		return errors.New("unavailable")
+	})
+	err := bus.Publish(ctx, &datamodel.Event{ID: "4", Type: datamodel.EventUserCreated})
+	assert.ErrorContains(t, err, "panicked : boom")
+	assert.ErrorContains(t, err, "unavailable")
+	assert.Equal(t, []string{"1", "2", "3", "4"}, all)
+}
+
+// flaky is a publisher failing while down is set
+type flaky struct {
+	down      bool
+	published []string
+}
+
+func (f *flaky) Publish(ctx context.Context, e *datamodel.Event) error {
+	if f.down {
+		return errors.New("broker down")
+	}
+	f.published = append(f.published, e.ID)
+	return nil
+}
+
+func TestRelay(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New(ctx)
+	publisher := &flaky{down: true}
+	relay := events.NewRelay(db, publisher)
+
+	for i := 1; i <= 150; i++ {
+		assert.NoError(t, db.SaveOutboxEvent(ctx, &datamodel.Event{ID: fmt.Sprint(i), Type: datamodel.EventBookingCreated}))
+	}
+
+	// Nothing is lost while the publisher fails
+	n, err := relay.Flush(ctx)
+	assert.Error(t, err)
+	assert.Equal(t, 0, n)
+	pending, err := db.ListOutboxEvents(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 150)
+
+	// The events are published in order once it recovers
+	publisher.down = false
+	n, err = relay.Flush(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 150, n)
+	assert.Equal(t, "1", publisher.published[0])
+	assert.Equal(t, "150", publisher.published[149])
+
+	pending, err = db.ListOutboxEvents(ctx, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+}
+
+// poisoned is a publisher failing for some events only
+type poisoned struct {
+	poison    map[string]bool
+	published []string
+}
+
+func (p *poisoned) Publish(ctx context.Context, e *datamodel.Event) error {
+	if p.poison[e.ID] {
+		return errors.New("unprocessable")
+	}
+	p.published = append(p.published, e.ID)
+	return nil
+}
+
+func TestRelayPoisonEvent(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New(ctx)
+	publisher := &poisoned{poison: map[string]bool{"2": true}}
+	relay := events.NewRelay(db, publisher)
+
+	for i := 1; i <= 3; i++ {
+		assert.NoError(t, db.SaveOutboxEvent(ctx, &datamodel.Event{ID: fmt.Sprint(i), Type: datamodel.EventBookingCreated}))
+	}
+
+	// The event that can't be published doesn't block the ones after it
+	n, err := relay.Flush(ctx)
+	assert.ErrorContains(t, err, "event '2' not published")
+	assert.Equal(t, 2, n)
+	assert.Equal(t, []string{"1", "3"}, publisher.published)
+
+	pending, err := db.ListOutboxEvents(ctx, 0)
+	assert.NoError(t, err)
+	assert.Len(t, pending, 1)
+	assert.Equal(t, 1, pending[0].Attempts)
+
+	// It goes to the dead-letters after its last attempt
+	for i := 2; i <= 10; i++ {
+		_, err = relay.Flush(ctx)
+		assert.Error(t, err)
+	}
+
+	pending, err = db.ListOutboxEvents(ctx, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, pending)
+
+	dead, err := db.ListDeadOutboxEvents(ctx)
+	assert.NoError(t, err)
+	assert.Len(t, dead, 1)
+	assert.Equal(t, "2", dead[0].ID)
+	assert.Equal(t, 10, dead[0].Attempts)
+
+	n, err = relay.Flush(ctx)
+	assert.NoError(t, err)
+	assert.Zero(t, n)
+}
+
+func TestFanout(t *testing.T) {
+	ctx := context.Background()
+	db := memory.New(ctx)
+
+	var first []string
+	broker := &flaky{down: true}
+	relay := events.NewRelay(db, events.Fanout(
+		events.PublisherFunc(func(ctx context.Context, e *datamodel.Event) error {
+			first = append(first, e.ID)
+			return nil
+		}),
+		broker,
+	))
+
+	assert.NoError(t, db.SaveOutboxEvent(ctx, &datamodel.Event{ID: "1", Type: datamodel.EventBookingCreated}))
+
+	_, err := relay.Flush(ctx)
+	assert.ErrorContains(t, err, "broker down")
+
+	// The publishers that received the event don't get it again when it is retried
+	broker.down = false
+	n, err := relay.Flush(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, n)
+	assert.Equal(t, []string{"1"}, first)
+	assert.Equal(t, []string{"1"}, broker.published)
+}
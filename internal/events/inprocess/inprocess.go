@@ -0,0 +1,95 @@
+package inprocess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+)
+
+// Handler reacts to an event, it must not call the service back synchronously as the event can be published while the
+// service holds its locks
+type Handler func(ctx context.Context, e *datamodel.Event) error
+
+type subscription struct {
+	id      int
+	types   map[datamodel.EventType]bool
+	handler Handler
+}
+
+// Bus implements the Publisher interface by calling the handlers subscribed in the same process
+type Bus struct {
+	mu            sync.RWMutex
+	next          int
+	subscriptions []*subscription
+}
+
+func New(ctx context.Context) *Bus {
+	return &Bus{}
+}
+
+// Subscribe calls the handler for the events of the given types, all of them if none is given. It returns the function
+// removing the subscription.
+func (b *Bus) Subscribe(handler Handler, types ...datamodel.EventType) func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub := &subscription{id: b.next, handler: handler}
+	b.next++
+
+	if len(types) > 0 {
+		sub.types = make(map[datamodel.EventType]bool, len(types))
+		for _, t := range types {
+			sub.types[t] = true
+		}
+	}
+
+	b.subscriptions = append(b.subscriptions, sub)
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		for i, s := range b.subscriptions {
+			if s.id == sub.id {
+				b.subscriptions = append(b.subscriptions[:i:i], b.subscriptions[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish calls the handlers subscribed to the type of the event in the order they subscribed, it returns the errors
+// of the handlers that failed after calling all of them
+func (b *Bus) Publish(ctx context.Context, e *datamodel.Event) error {
+	b.mu.RLock()
+	subscriptions := append([]*subscription(nil), b.subscriptions...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, sub := range subscriptions {
+		if sub.types != nil && !sub.types[e.Type] {
+			continue
+		}
+
+		err := call(ctx, sub.handler, e)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// call runs the handler turning its panics into errors
+func call(ctx context.Context, handler Handler, e *datamodel.Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("handler of event '%s' panicked : %v", e.Type, r)
+		}
+	}()
+
+	return handler(ctx, e)
+}
@@ -0,0 +1,120 @@
+package graphqlapi
+
+import (
+	"context"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+
+	"github.com/think-free/ABCFitness-challenge/internal/service"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+
+	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+type t string
+
+var loadersKey t = "loaders"
+
+// Request is a graphql query as sent in the body of a POST request
+type Request struct {
+	Query         string                 `json:"query"`
+	OperationName string                 `json:"operationName,omitempty"`
+	Variables     map[string]interface{} `json:"variables,omitempty"`
+	// Extensions are sent by some clients, they are accepted and ignored
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+// Schema resolves the graphql queries of the users, the classes and the bookings with the service, the relationships
+// are read in batches by the loaders of each query
+type Schema struct {
+	srv    *service.Service
+	schema graphql.Schema
+}
+
+// New returns the schema of the service, it panics if the schema is invalid which can only be a programming error
+func New(srv *service.Service) *Schema {
+	schema, err := newSchema(srv)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Schema{
+		srv:    srv,
+		schema: schema,
+	}
+}
+
+// Execute runs the query with the principal of the context, the errors are reported in the result. The queries above
+// the depth or the complexity limits are rejected before running any resolver
+func (s *Schema) Execute(ctx context.Context, req *Request) *graphql.Result {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.graphql.operation", req.OperationName)
+
+	err := checkLimits(req)
+	if err != nil {
+		log.Warnf("graphql query rejected : %v", err)
+		qe := &queryError{err: err}
+		formatted := gqlerrors.NewFormattedError(qe.Error())
+		formatted.Extensions = qe.Extensions()
+		return &graphql.Result{Errors: []gqlerrors.FormattedError{formatted}}
+	}
+
+	res := graphql.Do(graphql.Params{
+		Schema:         s.schema,
+		RequestString:  req.Query,
+		OperationName:  req.OperationName,
+		VariableValues: req.Variables,
+		Context:        context.WithValue(ctx, loadersKey, newLoaders(s.srv)),
+	})
+
+	if res.HasErrors() {
+		log.Warnf("graphql query returned %d errors : %v", len(res.Errors), res.Errors)
+	}
+
+	return res
+}
+
+func loadersFromContext(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey).(*loaders)
+}
+
+// queryError is an error of the service with the kind of the error in the extensions of the graphql error, the
+// clients use it like the status code of the rest api
+type queryError struct {
+	err error
+}
+
+func resolverError(err error) error {
+	return &queryError{err: err}
+}
+
+func (e *queryError) Error() string {
+	return e.err.Error()
+}
+
+func (e *queryError) Unwrap() error {
+	return e.err
+}
+
+func (e *queryError) Extensions() map[string]interface{} {
+	return map[string]interface{}{"code": errorCodes[ierrors.KindOf(e.err)]}
+}
+
+var errorCodes = map[ierrors.Kind]string{
+	ierrors.KindInternal:             "INTERNAL",
+	ierrors.KindValidation:           "VALIDATION",
+	ierrors.KindNotFound:             "NOT_FOUND",
+	ierrors.KindAlreadyExists:        "ALREADY_EXISTS",
+	ierrors.KindConflict:             "CONFLICT",
+	ierrors.KindInvalidState:         "INVALID_STATE",
+	ierrors.KindClassFull:            "CLASS_FULL",
+	ierrors.KindUnauthorized:         "UNAUTHORIZED",
+	ierrors.KindForbidden:            "FORBIDDEN",
+	ierrors.KindNoCredits:            "NO_CREDITS",
+	ierrors.KindPreconditionFailed:   "PRECONDITION_FAILED",
+	ierrors.KindUnsupportedMediaType: "UNSUPPORTED_MEDIA_TYPE",
+	ierrors.KindRequestTooLarge:      "REQUEST_TOO_LARGE",
+	ierrors.KindRejected:             "REJECTED",
+}
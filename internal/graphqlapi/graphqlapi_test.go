@@ -0,0 +1,321 @@
+package graphqlapi_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
+	"github.com/think-free/ABCFitness-challenge/internal/database"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/graphqlapi"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/internal/service"
+)
+
+// countingDatabase counts the lookups of the users, the classes and the bookings
+type countingDatabase struct {
+	database.Database
+
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+func (db *countingDatabase) count(name string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.calls[name]++
+}
+
+func (db *countingDatabase) reset() map[string]int {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	calls := db.calls
+	db.calls = make(map[string]int)
+	return calls
+}
+
+func (db *countingDatabase) GetUserByID(ctx context.Context, id string) (*datamodel.User, error) {
+	db.count("GetUserByID")
+	return db.Database.GetUserByID(ctx, id)
+}
+
+func (db *countingDatabase) GetUsersByIDs(ctx context.Context, ids []string) ([]*datamodel.User, error) {
+	db.count("GetUsersByIDs")
+	return db.Database.GetUsersByIDs(ctx, ids)
+}
+
+func (db *countingDatabase) GetClassByID(ctx context.Context, id string) (*datamodel.Class, error) {
+	db.count("GetClassByID")
+	return db.Database.GetClassByID(ctx, id)
+}
+
+func (db *countingDatabase) GetClassesByIDs(ctx context.Context, ids []string) ([]*datamodel.Class, error) {
+	db.count("GetClassesByIDs")
+	return db.Database.GetClassesByIDs(ctx, ids)
+}
+
+func (db *countingDatabase) ListBookingsByUser(ctx context.Context, userID string) ([]*datamodel.Booking, error) {
+	db.count("ListBookingsByUser")
+	return db.Database.ListBookingsByUser(ctx, userID)
+}
+
+func (db *countingDatabase) ListBookingsByUsers(ctx context.Context, userIDs []string) ([]*datamodel.Booking, error) {
+	db.count("ListBookingsByUsers")
+	return db.Database.ListBookingsByUsers(ctx, userIDs)
+}
+
+func (db *countingDatabase) ListBookingsByClass(ctx context.Context, classID string) ([]*datamodel.Booking, error) {
+	db.count("ListBookingsByClass")
+	return db.Database.ListBookingsByClass(ctx, classID)
+}
+
+func (db *countingDatabase) ListBookingsByClasses(ctx context.Context, classIDs []string) ([]*datamodel.Booking, error) {
+	db.count("ListBookingsByClasses")
+	return db.Database.ListBookingsByClasses(ctx, classIDs)
+}
+
+type booking struct {
+	ID   string `json:"id"`
+	User *struct {
+		Name     string `json:"name"`
+		Bookings []struct {
+			ID    string `json:"id"`
+			Class struct {
+				Name string `json:"class_name"`
+			} `json:"class"`
+		} `json:"bookings"`
+	} `json:"user"`
+	Class *struct {
+		Name     string `json:"class_name"`
+		Bookings []struct {
+			ID string `json:"id"`
+		} `json:"bookings"`
+	} `json:"class"`
+}
+
+func TestBatchedRelationships(t *testing.T) {
+	ctx := context.Background()
+	db := &countingDatabase{Database: database.New(ctx, cliparams.New()), calls: make(map[string]int)}
+	srv := service.New(ctx, db)
+	schema := graphqlapi.New(srv)
+
+	start := time.Now().AddDate(0, 0, 1).Truncate(time.Hour)
+	end := start.AddDate(0, 0, 10)
+
+	var classes []*datamodel.Class
+	for _, name := range []string{"Yoga", "Pilates"} {
+		c, err := srv.CreateClass(ctx, &datamodel.CreateClassRequest{BaseClass: datamodel.BaseClass{
+			Studio: "Studio 1", Room: name, Name: name, StartDate: &start, EndDate: &end, DailyCapacity: 10,
+		}})
+		require.NoError(t, err)
+		classes = append(classes, c)
+	}
+
+	for i := 0; i < 3; i++ {
+		u, err := srv.CreateUser(ctx, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{
+			Name: fmt.Sprintf("User %d", i), Email: fmt.Sprintf("user%d@example.com", i), Phone: "+34123456789",
+		}})
+		require.NoError(t, err)
+
+		for _, c := range classes {
+			_, err = srv.CreateBooking(ctx, &datamodel.CreateBookingRequest{BaseBooking: datamodel.BaseBooking{
+				UserID: u.ID, ClassID: c.ID, Date: start,
+			}})
+			require.NoError(t, err)
+		}
+	}
+
+	db.reset()
+
+	res := schema.Execute(ctx, &graphqlapi.Request{Query: `{
+		bookings {
+			id
+			user { name bookings { id class { class_name } } }
+			class { class_name bookings { id } }
+		}
+	}`})
+	require.Empty(t, res.Errors)
+
+	var data struct {
+		Bookings []booking `json:"bookings"`
+	}
+	decode(t, res.Data, &data)
+	require.Len(t, data.Bookings, 6)
+	for _, b := range data.Bookings {
+		require.NotNil(t, b.User)
+		require.Len(t, b.User.Bookings, 2)
+		require.NotEmpty(t, b.User.Bookings[0].Class.Name)
+		require.NotNil(t, b.Class)
+		require.Len(t, b.Class.Bookings, 3)
+	}
+
+	// Each relationship is read once for all the bookings whatever their number
+	require.Equal(t, map[string]int{
+		"GetUsersByIDs":         1,
+		"GetClassesByIDs":       1,
+		"ListBookingsByUsers":   1,
+		"ListBookingsByClasses": 1,
+	}, db.reset())
+
+	// The entities read by the query are not looked up again by their relationships
+	res = schema.Execute(ctx, &graphqlapi.Request{
+		Query:     `query Class($id: ID!) { class(id: $id) { class_name bookings { class { class_name } } } }`,
+		Variables: map[string]interface{}{"id": classes[0].ID},
+	})
+	require.Empty(t, res.Errors)
+	require.Equal(t, map[string]int{"GetClassByID": 1, "ListBookingsByClasses": 1}, db.reset())
+}
+
+func TestQueryErrors(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(ctx, cliparams.New())
+	srv := service.New(ctx, db)
+	schema := graphqlapi.New(srv)
+
+	u, err := srv.CreateUser(ctx, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{
+		Name: "John", Email: "john.doe@example.com", Phone: "+34123456789",
+	}})
+	require.NoError(t, err)
+
+	res := schema.Execute(ctx, &graphqlapi.Request{Query: `{ user(id: "unknown") { name } }`})
+	require.Len(t, res.Errors, 1)
+	require.Equal(t, "NOT_FOUND", res.Errors[0].Extensions["code"])
+	require.Equal(t, map[string]interface{}{"user": nil}, res.Data)
+
+	// A member can only read its own user, the others are not found
+	member := auth.ContextWithPrincipal(ctx, &auth.Principal{ID: "someone-else", Role: policy.RoleMember})
+	res = schema.Execute(member, &graphqlapi.Request{Query: fmt.Sprintf(`{ user(id: "%s") { name } }`, u.ID)})
+	require.Len(t, res.Errors, 1)
+	require.Equal(t, "NOT_FOUND", res.Errors[0].Extensions["code"])
+
+	res = schema.Execute(ctx, &graphqlapi.Request{Query: `{ user { name } }`})
+	require.NotEmpty(t, res.Errors)
+}
+
+func decode(t *testing.T, data interface{}, v interface{}) {
+	raw, err := json.Marshal(data)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, v))
+}
+
+func TestQueryLimits(t *testing.T) {
+	ctx := context.Background()
+	db := &countingDatabase{Database: database.New(ctx, cliparams.New()), calls: make(map[string]int)}
+	srv := service.New(ctx, db)
+	schema := graphqlapi.New(srv)
+
+	u, err := srv.CreateUser(ctx, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{
+		Name: "John", Email: "john.doe@example.com", Phone: "+34123456789",
+	}})
+	require.NoError(t, err)
+
+	query := func(selection string) *graphqlapi.Request {
+		return &graphqlapi.Request{Query: fmt.Sprintf(`{ user(id: "%s") { %s } }`, u.ID, selection)}
+	}
+
+	// The relationships can be followed up to the maximum depth
+	res := schema.Execute(ctx, query(`bookings { user { bookings { user { bookings { user { bookings { user { id } } } } } } } }`))
+	require.Empty(t, res.Errors)
+
+	// A deeper query is rejected before any lookup, also when the depth comes from a fragment
+	db.reset()
+	res = schema.Execute(ctx, query(`bookings { user { bookings { user { bookings { user { bookings { user { bookings { id } } } } } } } } }`))
+	require.Len(t, res.Errors, 1)
+	require.Equal(t, "VALIDATION", res.Errors[0].Extensions["code"])
+	require.Contains(t, res.Errors[0].Message, "query depth 11")
+	require.Empty(t, db.reset())
+
+	res = schema.Execute(ctx, &graphqlapi.Request{Query: fmt.Sprintf(`
+		{ user(id: "%s") { ...Deep } }
+		fragment Deep on User { bookings { user { bookings { user { bookings { user { bookings { user { bookings { id } } } } } } } } } }
+	`, u.ID)})
+	require.Len(t, res.Errors, 1)
+	require.Equal(t, "VALIDATION", res.Errors[0].Extensions["code"])
+	require.Empty(t, db.reset())
+
+	// A query can't ask for too many fields, even when they are aliases of the same one
+	var fields strings.Builder
+	for i := 0; i < 5100; i++ {
+		fmt.Fprintf(&fields, "f%d: name ", i)
+	}
+	res = schema.Execute(ctx, query(fields.String()))
+	require.Len(t, res.Errors, 1)
+	require.Equal(t, "VALIDATION", res.Errors[0].Extensions["code"])
+	require.Contains(t, res.Errors[0].Message, "query complexity")
+	require.Empty(t, db.reset())
+
+	// Only the operation that runs is checked
+	res = schema.Execute(ctx, &graphqlapi.Request{
+		Query:         fmt.Sprintf(`query Small { user(id: "%s") { name } } query Big { user(id: "%s") { %s } }`, u.ID, u.ID, fields.String()),
+		OperationName: "Small",
+	})
+	require.Empty(t, res.Errors)
+
+	// The selection of a list counts once per element it can return, the page of the root lists or an estimate of the
+	// bookings of a user or a class
+	nested := `{ users%s { bookings { user { bookings { user { bookings { id } } } } } } }`
+	db.reset()
+	res = schema.Execute(ctx, &graphqlapi.Request{Query: fmt.Sprintf(nested, "")})
+	require.Len(t, res.Errors, 1)
+	require.Contains(t, res.Errors[0].Message, "query complexity")
+	require.Empty(t, db.reset())
+
+	res = schema.Execute(ctx, &graphqlapi.Request{Query: fmt.Sprintf(nested, "(count: 2)")})
+	require.Empty(t, res.Errors)
+
+	res = schema.Execute(ctx, &graphqlapi.Request{
+		Query:     fmt.Sprintf(nested, "(count: $count)"),
+		Variables: map[string]interface{}{"count": float64(50)},
+	})
+	require.Len(t, res.Errors, 1)
+	require.Contains(t, res.Errors[0].Message, "query complexity")
+
+	res = schema.Execute(ctx, &graphqlapi.Request{Query: fmt.Sprintf(`query Q($count: Int) %s`, fmt.Sprintf(nested, "(count: $count)")), Variables: map[string]interface{}{"count": float64(2)}})
+	require.Empty(t, res.Errors)
+}
+
+func TestLists(t *testing.T) {
+	ctx := context.Background()
+	srv := service.New(ctx, database.New(ctx, cliparams.New()))
+	schema := graphqlapi.New(srv)
+
+	for i := 0; i < 3; i++ {
+		_, err := srv.CreateUser(ctx, &datamodel.CreateUserRequest{BaseUser: datamodel.BaseUser{
+			Name: fmt.Sprintf("John %d", i), Email: fmt.Sprintf("john.doe.%d@example.com", i), Phone: "+34123456789",
+		}})
+		require.NoError(t, err)
+	}
+
+	var data struct {
+		Users []struct {
+			Name string `json:"name"`
+		} `json:"users"`
+	}
+
+	// The lists are paged by the database
+	res := schema.Execute(ctx, &graphqlapi.Request{Query: `{ users(offset: 1, count: 1) { name } }`})
+	require.Empty(t, res.Errors)
+	decode(t, res.Data, &data)
+	require.Len(t, data.Users, 1)
+	require.Equal(t, "John 1", data.Users[0].Name)
+
+	res = schema.Execute(ctx, &graphqlapi.Request{Query: `{ users { name } }`})
+	require.Empty(t, res.Errors)
+	decode(t, res.Data, &data)
+	require.Len(t, data.Users, 3)
+
+	// The pages are between 1 and 100 elements
+	for _, args := range []string{"(count: 0)", "(count: 101)", "(offset: -1)"} {
+		res = schema.Execute(ctx, &graphqlapi.Request{Query: `{ users` + args + ` { name } }`})
+		require.Len(t, res.Errors, 1)
+		require.Equal(t, "VALIDATION", res.Errors[0].Extensions["code"])
+	}
+}
@@ -0,0 +1,176 @@
+package graphqlapi
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/graphql-go/graphql/language/ast"
+	"github.com/graphql-go/graphql/language/parser"
+
+	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+const (
+	// maxQueryDepth is the maximum nesting of the fields of a query, the relationships can loop (a user, its bookings,
+	// their class, its bookings...) so a query could read the whole database
+	maxQueryDepth = 10
+	// maxQueryComplexity is the maximum number of values a query can resolve once its fragments are expanded, the
+	// selection of a list counts once per element the list can return
+	maxQueryComplexity = 5000
+	// maxListCount is the largest page of the lists of the query, and the page of the ones without count
+	maxListCount = 100
+	// nestedListSize is the number of elements estimated for the bookings of a user or a class, they are not paged
+	nestedListSize = 5
+)
+
+// listFields are the fields of the schema returning a list, paged by their count at the root of the query
+var listFields = map[string]bool{"users": true, "classes": true, "bookings": true}
+
+// queryCost is the depth and the complexity of a selection
+type queryCost struct {
+	depth      int
+	complexity int
+}
+
+// checkLimits returns a validation error if the operation of the request is deeper or more complex than the limits,
+// a query that can't be parsed is left to graphql that reports the syntax error
+func checkLimits(req *Request) error {
+	doc, err := parser.Parse(parser.ParseParams{Source: req.Query})
+	if err != nil {
+		return nil
+	}
+
+	m := &measurer{
+		variables: req.Variables,
+		fragments: make(map[string]*ast.FragmentDefinition),
+		costs:     make(map[string]queryCost),
+		visiting:  make(map[string]bool),
+	}
+	for _, def := range doc.Definitions {
+		if f, ok := def.(*ast.FragmentDefinition); ok && f.Name != nil {
+			m.fragments[f.Name.Value] = f
+		}
+	}
+
+	// Without operation name the only operation runs, or none if there are many, so they are all checked
+	for _, def := range doc.Definitions {
+		op, ok := def.(*ast.OperationDefinition)
+		if !ok || (req.OperationName != "" && (op.Name == nil || op.Name.Value != req.OperationName)) {
+			continue
+		}
+
+		cost := m.selectionSet(op.SelectionSet, true)
+		if cost.depth > maxQueryDepth {
+			return ierrors.ErrorDecode("", 0, fmt.Sprintf("query depth %d is above the maximum of %d", cost.depth, maxQueryDepth))
+		}
+		if cost.complexity > maxQueryComplexity {
+			return ierrors.ErrorDecode("", 0, fmt.Sprintf("query complexity is above the maximum of %d values", maxQueryComplexity))
+		}
+	}
+
+	return nil
+}
+
+// measurer computes the cost of the selections, the cost of each fragment is computed once so the fragments spread
+// many times can't make the check itself expensive
+type measurer struct {
+	variables map[string]interface{}
+	fragments map[string]*ast.FragmentDefinition
+	costs     map[string]queryCost
+	visiting  map[string]bool
+}
+
+// selectionSet returns the cost of the selections, root is true for the fields of the query type
+func (m *measurer) selectionSet(set *ast.SelectionSet, root bool) queryCost {
+	var cost queryCost
+	if set == nil {
+		return cost
+	}
+
+	for _, sel := range set.Selections {
+		var c queryCost
+		switch sel := sel.(type) {
+		case *ast.Field:
+			sub := m.selectionSet(sel.SelectionSet, false)
+			c = queryCost{depth: sub.depth + 1, complexity: m.size(sel, root)*sub.complexity + 1}
+		case *ast.InlineFragment:
+			c = m.selectionSet(sel.SelectionSet, root)
+		case *ast.FragmentSpread:
+			if sel.Name != nil {
+				c = m.fragment(sel.Name.Value)
+			}
+		}
+
+		cost.depth = max(cost.depth, c.depth)
+		// The complexity stops above the maximum so the spreads of spreads and the lists of lists can't overflow it
+		cost.complexity = min(cost.complexity+c.complexity, maxQueryComplexity+1)
+	}
+
+	return cost
+}
+
+// size returns the number of elements the field can return, the count of the lists of the root and nestedListSize for
+// the others
+func (m *measurer) size(f *ast.Field, root bool) int {
+	if f.Name == nil || !listFields[f.Name.Value] {
+		return 1
+	}
+	if !root {
+		return nestedListSize
+	}
+
+	for _, arg := range f.Arguments {
+		if arg.Name == nil || arg.Name.Value != "count" {
+			continue
+		}
+
+		// A count out of bounds is rejected by the list
+		if count, ok := m.intValue(arg.Value); ok && count > 0 && count < maxListCount {
+			return count
+		}
+	}
+
+	return maxListCount
+}
+
+// intValue returns the value of an int literal or of a variable set to an int
+func (m *measurer) intValue(v ast.Value) (int, bool) {
+	switch v := v.(type) {
+	case *ast.IntValue:
+		n, err := strconv.Atoi(v.Value)
+		return n, err == nil
+	case *ast.Variable:
+		if v.Name == nil {
+			return 0, false
+		}
+		// The variables are decoded from json as float64
+		switch n := m.variables[v.Name.Value].(type) {
+		case float64:
+			return int(n), true
+		case int:
+			return n, true
+		}
+	}
+
+	return 0, false
+}
+
+// fragment returns the cost of the fragment, the unknown fragments and the cycles cost nothing as graphql rejects them
+func (m *measurer) fragment(name string) queryCost {
+	if cost, ok := m.costs[name]; ok {
+		return cost
+	}
+
+	f, ok := m.fragments[name]
+	if !ok || m.visiting[name] {
+		return queryCost{}
+	}
+
+	m.visiting[name] = true
+	cost := m.selectionSet(f.SelectionSet, f.TypeCondition != nil && f.TypeCondition.Name != nil && f.TypeCondition.Name.Value == "Query")
+	delete(m.visiting, name)
+
+	m.costs[name] = cost
+
+	return cost
+}
@@ -0,0 +1,147 @@
+package graphqlapi
+
+import (
+	"context"
+	"sync"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/service"
+)
+
+// loader batches the lookups of a query : the keys requested while a level of the query is resolved are fetched
+// together the first time one of their values is needed, and every value is fetched once per query
+type loader[V any] struct {
+	fetch func(ctx context.Context, keys []string) (map[string]V, error)
+
+	mu      sync.Mutex
+	pending []string
+	queued  map[string]bool
+	values  map[string]V
+	errs    map[string]error
+}
+
+func newLoader[V any](fetch func(ctx context.Context, keys []string) (map[string]V, error)) *loader[V] {
+	return &loader[V]{
+		fetch:  fetch,
+		queued: make(map[string]bool),
+		values: make(map[string]V),
+		errs:   make(map[string]error),
+	}
+}
+
+// load queues the key and returns a thunk returning its value, the zero value if the key was not found
+func (l *loader[V]) load(ctx context.Context, key string) func() (V, error) {
+	l.mu.Lock()
+	if !l.queued[key] {
+		l.queued[key] = true
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		if len(l.pending) > 0 {
+			l.dispatch(ctx)
+		}
+
+		return l.values[key], l.errs[key]
+	}
+}
+
+// dispatch fetches the pending keys, it is called with the lock held
+func (l *loader[V]) dispatch(ctx context.Context) {
+	keys := l.pending
+	l.pending = nil
+
+	values, err := l.fetch(ctx, keys)
+	for _, k := range keys {
+		if err != nil {
+			l.errs[k] = err
+			continue
+		}
+		if v, ok := values[k]; ok {
+			l.values[k] = v
+		}
+	}
+}
+
+// loaders are the loaders of a query, they are created for each query so the principal of the query applies to all
+// their lookups and their values are never shared between queries
+type loaders struct {
+	users         *loader[*datamodel.User]
+	classes       *loader[*datamodel.Class]
+	userBookings  *loader[[]*datamodel.Booking]
+	classBookings *loader[[]*datamodel.Booking]
+}
+
+func newLoaders(srv *service.Service) *loaders {
+	return &loaders{
+		users: newLoader(func(ctx context.Context, ids []string) (map[string]*datamodel.User, error) {
+			users, err := srv.GetUsers(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[string]*datamodel.User, len(users))
+			for _, u := range users {
+				byID[u.ID] = u
+			}
+			return byID, nil
+		}),
+		classes: newLoader(func(ctx context.Context, ids []string) (map[string]*datamodel.Class, error) {
+			classes, err := srv.GetClasses(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			byID := make(map[string]*datamodel.Class, len(classes))
+			for _, c := range classes {
+				byID[c.ID] = c
+			}
+			return byID, nil
+		}),
+		userBookings: newLoader(func(ctx context.Context, ids []string) (map[string][]*datamodel.Booking, error) {
+			bookings, err := srv.ListBookingsByUsers(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			return groupBookings(bookings, func(b *datamodel.Booking) string { return b.UserID }), nil
+		}),
+		classBookings: newLoader(func(ctx context.Context, ids []string) (map[string][]*datamodel.Booking, error) {
+			bookings, err := srv.ListBookingsByClasses(ctx, ids)
+			if err != nil {
+				return nil, err
+			}
+			return groupBookings(bookings, func(b *datamodel.Booking) string { return b.ClassID }), nil
+		}),
+	}
+}
+
+// prime stores the entities already read by a query so their relationships don't look them up again
+func (l *loaders) prime(users []*datamodel.User, classes []*datamodel.Class) {
+	l.users.mu.Lock()
+	for _, u := range users {
+		if u != nil {
+			l.users.queued[u.ID] = true
+			l.users.values[u.ID] = u
+		}
+	}
+	l.users.mu.Unlock()
+
+	l.classes.mu.Lock()
+	for _, c := range classes {
+		if c != nil {
+			l.classes.queued[c.ID] = true
+			l.classes.values[c.ID] = c
+		}
+	}
+	l.classes.mu.Unlock()
+}
+
+func groupBookings(bookings []*datamodel.Booking, key func(*datamodel.Booking) string) map[string][]*datamodel.Booking {
+	grouped := make(map[string][]*datamodel.Booking)
+	for _, b := range bookings {
+		grouped[key(b)] = append(grouped[key(b)], b)
+	}
+	return grouped
+}
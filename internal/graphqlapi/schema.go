@@ -0,0 +1,278 @@
+package graphqlapi
+
+import (
+	"fmt"
+
+	"github.com/graphql-go/graphql"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/service"
+
+	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+// The fields are named like the json fields of the rest api, the ids of the relationships are replaced by the entities
+
+var membershipType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "Membership",
+	Fields: graphql.Fields{
+		"plan":            field(graphql.String, func(m *datamodel.Membership) interface{} { return string(m.Plan) }),
+		"monthly_classes": field(graphql.Int, func(m *datamodel.Membership) interface{} { return m.MonthlyClasses }),
+		"credits":         field(graphql.Int, func(m *datamodel.Membership) interface{} { return m.Credits }),
+	},
+})
+
+var rulesType = graphql.NewObject(graphql.ObjectConfig{
+	Name: "BookingRules",
+	Fields: graphql.Fields{
+		"max_advance_days":      field(graphql.Int, func(r *datamodel.BookingRules) interface{} { return r.MaxAdvanceDays }),
+		"cutoff_minutes":        field(graphql.Int, func(r *datamodel.BookingRules) interface{} { return r.CutOffMinutes }),
+		"max_per_class_per_day": field(graphql.Int, func(r *datamodel.BookingRules) interface{} { return r.MaxPerUserPerClassPerDay }),
+		"max_open_bookings":     field(graphql.Int, func(r *datamodel.BookingRules) interface{} { return r.MaxOpenBookings }),
+	},
+})
+
+func newSchema(srv *service.Service) (graphql.Schema, error) {
+	var userType, classType, bookingType *graphql.Object
+
+	userType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":         field(graphql.NewNonNull(graphql.ID), func(u *datamodel.User) interface{} { return u.ID }),
+				"version":    field(graphql.NewNonNull(graphql.Int), func(u *datamodel.User) interface{} { return u.Version }),
+				"name":       field(graphql.String, func(u *datamodel.User) interface{} { return u.Name }),
+				"surname":    field(graphql.String, func(u *datamodel.User) interface{} { return u.Surname }),
+				"email":      field(graphql.String, func(u *datamodel.User) interface{} { return u.Email }),
+				"phone":      field(graphql.String, func(u *datamodel.User) interface{} { return u.Phone }),
+				"studio":     field(graphql.String, func(u *datamodel.User) interface{} { return u.Studio }),
+				"membership": field(membershipType, func(u *datamodel.User) interface{} { return u.Membership }),
+				"erased_at":  field(graphql.DateTime, func(u *datamodel.User) interface{} { return u.ErasedAt }),
+				"bookings": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookingType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						u := p.Source.(*datamodel.User)
+						return bookingsThunk(loadersFromContext(p.Context).userBookings.load(p.Context, u.ID)), nil
+					},
+				},
+			}
+		}),
+	})
+
+	classType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Class",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":         field(graphql.NewNonNull(graphql.ID), func(c *datamodel.Class) interface{} { return c.ID }),
+				"version":    field(graphql.NewNonNull(graphql.Int), func(c *datamodel.Class) interface{} { return c.Version }),
+				"studio":     field(graphql.String, func(c *datamodel.Class) interface{} { return c.Studio }),
+				"room":       field(graphql.String, func(c *datamodel.Class) interface{} { return c.Room }),
+				"class_name": field(graphql.String, func(c *datamodel.Class) interface{} { return c.Name }),
+				"start_date": field(graphql.DateTime, func(c *datamodel.Class) interface{} { return c.StartDate }),
+				"end_date":   field(graphql.DateTime, func(c *datamodel.Class) interface{} { return c.EndDate }),
+				"duration":   field(graphql.Int, func(c *datamodel.Class) interface{} { return c.Duration }),
+				"capacity":   field(graphql.Int, func(c *datamodel.Class) interface{} { return c.DailyCapacity }),
+				"rules":      field(rulesType, func(c *datamodel.Class) interface{} { return c.Rules }),
+				"bookings": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookingType))),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						c := p.Source.(*datamodel.Class)
+						return bookingsThunk(loadersFromContext(p.Context).classBookings.load(p.Context, c.ID)), nil
+					},
+				},
+			}
+		}),
+	})
+
+	bookingType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Booking",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id":            field(graphql.NewNonNull(graphql.ID), func(b *datamodel.Booking) interface{} { return b.ID }),
+				"version":       field(graphql.NewNonNull(graphql.Int), func(b *datamodel.Booking) interface{} { return b.Version }),
+				"date":          field(graphql.DateTime, func(b *datamodel.Booking) interface{} { return b.Date }),
+				"status":        field(graphql.String, func(b *datamodel.Booking) interface{} { return string(b.Status) }),
+				"checked_in_at": field(graphql.DateTime, func(b *datamodel.Booking) interface{} { return b.CheckedInAt }),
+				"cancelled_at":  field(graphql.DateTime, func(b *datamodel.Booking) interface{} { return b.CancelledAt }),
+				"user": &graphql.Field{
+					Type: userType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						b := p.Source.(*datamodel.Booking)
+						return entityThunk(loadersFromContext(p.Context).users.load(p.Context, b.UserID)), nil
+					},
+				},
+				"class": &graphql.Field{
+					Type: classType,
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						b := p.Source.(*datamodel.Booking)
+						return entityThunk(loadersFromContext(p.Context).classes.load(p.Context, b.ClassID)), nil
+					},
+				},
+			}
+		}),
+	})
+
+	return graphql.NewSchema(graphql.SchemaConfig{
+		Query: graphql.NewObject(graphql.ObjectConfig{
+			Name: "Query",
+			Fields: graphql.Fields{
+				"user": &graphql.Field{
+					Type: userType,
+					Args: idArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						user, err := srv.GetUser(p.Context, p.Args["id"].(string))
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						loadersFromContext(p.Context).prime([]*datamodel.User{user}, nil)
+						return user, nil
+					},
+				},
+				"users": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(userType))),
+					Args: listArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						r, err := listRequest(p.Args)
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						users, err := srv.ListUsers(p.Context, r)
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						loadersFromContext(p.Context).prime(users, nil)
+						return nonNil(users), nil
+					},
+				},
+				"class": &graphql.Field{
+					Type: classType,
+					Args: idArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						class, err := srv.GetClass(p.Context, p.Args["id"].(string))
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						loadersFromContext(p.Context).prime(nil, []*datamodel.Class{class})
+						return class, nil
+					},
+				},
+				"classes": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(classType))),
+					Args: listArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						r, err := listRequest(p.Args)
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						classes, err := srv.ListClasses(p.Context, r)
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						loadersFromContext(p.Context).prime(nil, classes)
+						return nonNil(classes), nil
+					},
+				},
+				"booking": &graphql.Field{
+					Type: bookingType,
+					Args: idArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						info, err := srv.GetBooking(p.Context, p.Args["id"].(string))
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						loadersFromContext(p.Context).prime([]*datamodel.User{info.User}, []*datamodel.Class{info.Class})
+						return &info.Booking, nil
+					},
+				},
+				"bookings": &graphql.Field{
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(bookingType))),
+					Args: listArgs(),
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						r, err := listRequest(p.Args)
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						bookings, err := srv.ListBookings(p.Context, r)
+						if err != nil {
+							return nil, resolverError(err)
+						}
+						return nonNil(bookings), nil
+					},
+				},
+			},
+		}),
+	})
+}
+
+// field returns a field resolved by a getter of the entity of type T the field belongs to
+func field[T any](t graphql.Output, get func(T) interface{}) *graphql.Field {
+	return &graphql.Field{
+		Type: t,
+		Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+			return get(p.Source.(T)), nil
+		},
+	}
+}
+
+// entityThunk returns the thunk of a relationship, resolved once the loader has fetched the entities of the level of the query
+func entityThunk[T any](load func() (*T, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		v, err := load()
+		if err != nil {
+			return nil, resolverError(err)
+		}
+		if v == nil {
+			return nil, nil
+		}
+		return v, nil
+	}
+}
+
+func bookingsThunk(load func() ([]*datamodel.Booking, error)) func() (interface{}, error) {
+	return func() (interface{}, error) {
+		bookings, err := load()
+		if err != nil {
+			return nil, resolverError(err)
+		}
+		return nonNil(bookings), nil
+	}
+}
+
+func idArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+	}
+}
+
+// listArgs are the offset and count of the lists, a list returns a page of maxListCount at most
+func listArgs() graphql.FieldConfigArgument {
+	return graphql.FieldConfigArgument{
+		"offset": &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: 0},
+		"count":  &graphql.ArgumentConfig{Type: graphql.Int, DefaultValue: maxListCount},
+	}
+}
+
+// listRequest returns the page selected by the args, a validation error if it is not between 1 and maxListCount
+func listRequest(args map[string]interface{}) (*datamodel.ListRequest, error) {
+	r := &datamodel.ListRequest{
+		Offset: args["offset"].(int),
+		Count:  args["count"].(int),
+	}
+
+	if r.Offset < 0 {
+		return nil, ierrors.ErrorDecode("offset", 0, "the offset can't be negative")
+	}
+	if r.Count < 1 || r.Count > maxListCount {
+		return nil, ierrors.ErrorDecode("count", 0, fmt.Sprintf("the count must be between 1 and %d", maxListCount))
+	}
+
+	return r, nil
+}
+
+// nonNil returns an empty list instead of nil, the lists of the schema are never null
+func nonNil[T any](list []T) []T {
+	if list == nil {
+		return []T{}
+	}
+	return list
+}
@@ -0,0 +1,134 @@
+package grpcapi
+
+import (
+	"time"
+
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/grpcapi/pb"
+)
+
+func toUser(u *datamodel.User) *pb.User {
+	if u == nil {
+		return nil
+	}
+
+	return &pb.User{
+		Id:         u.ID,
+		Version:    int32(u.Version),
+		Name:       u.Name,
+		Surname:    u.Surname,
+		Email:      u.Email,
+		Phone:      u.Phone,
+		Membership: toMembership(u.Membership),
+		ErasedAt:   toTimestamp(u.ErasedAt),
+		Studio:     u.Studio,
+	}
+}
+
+func toMembership(m *datamodel.Membership) *pb.Membership {
+	if m == nil {
+		return nil
+	}
+
+	return &pb.Membership{
+		Plan:           string(m.Plan),
+		MonthlyClasses: int32(m.MonthlyClasses),
+		Credits:        int32(m.Credits),
+	}
+}
+
+func toClass(c *datamodel.Class) *pb.Class {
+	if c == nil {
+		return nil
+	}
+
+	return &pb.Class{
+		Id:        c.ID,
+		Version:   int32(c.Version),
+		Studio:    c.Studio,
+		Room:      c.Room,
+		ClassName: c.Name,
+		StartDate: toTimestamp(c.StartDate),
+		EndDate:   toTimestamp(c.EndDate),
+		Duration:  int32(c.Duration),
+		Capacity:  int32(c.DailyCapacity),
+		Rules:     toRules(c.Rules),
+	}
+}
+
+func toRules(r *datamodel.BookingRules) *pb.BookingRules {
+	if r == nil {
+		return nil
+	}
+
+	return &pb.BookingRules{
+		MaxAdvanceDays:    int32(r.MaxAdvanceDays),
+		CutoffMinutes:     int32(r.CutOffMinutes),
+		MaxPerClassPerDay: int32(r.MaxPerUserPerClassPerDay),
+		MaxOpenBookings:   int32(r.MaxOpenBookings),
+	}
+}
+
+func fromRules(r *pb.BookingRules) *datamodel.BookingRules {
+	if r == nil {
+		return nil
+	}
+
+	return &datamodel.BookingRules{
+		MaxAdvanceDays:           int(r.MaxAdvanceDays),
+		CutOffMinutes:            int(r.CutoffMinutes),
+		MaxPerUserPerClassPerDay: int(r.MaxPerClassPerDay),
+		MaxOpenBookings:          int(r.MaxOpenBookings),
+	}
+}
+
+func toBooking(b *datamodel.Booking) *pb.Booking {
+	if b == nil {
+		return nil
+	}
+
+	return &pb.Booking{
+		Id:          b.ID,
+		Version:     int32(b.Version),
+		Class:       b.ClassID,
+		User:        b.UserID,
+		Date:        timestamppb.New(b.Date),
+		Status:      string(b.Status),
+		CheckedInAt: toTimestamp(b.CheckedInAt),
+		CancelledAt: toTimestamp(b.CancelledAt),
+	}
+}
+
+func toBookings(bookings []*datamodel.Booking) []*pb.Booking {
+	resp := make([]*pb.Booking, 0, len(bookings))
+	for _, b := range bookings {
+		resp = append(resp, toBooking(b))
+	}
+	return resp
+}
+
+func toTimestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+	return timestamppb.New(*t)
+}
+
+// fromTimestamp returns nil for a missing timestamp
+func fromTimestamp(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+	t := ts.AsTime()
+	return &t
+}
+
+func optionalInt(v *int32) *int {
+	if v == nil {
+		return nil
+	}
+	i := int(*v)
+	return &i
+}
@@ -0,0 +1,82 @@
+package grpcapi
+
+//go:generate protoc -I ../../proto --go_out=../.. --go_opt=module=github.com/think-free/ABCFitness-challenge --go-grpc_out=../.. --go-grpc_opt=module=github.com/think-free/ABCFitness-challenge abcfitness/v1/abcfitness.proto
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/grpcapi/pb"
+	"github.com/think-free/ABCFitness-challenge/internal/service"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// Server exposes the user, class and booking operations of the service over grpc
+type Server struct {
+	srv  *service.Service
+	auth *auth.Authenticator
+	grpc *grpc.Server
+}
+
+// Option configures optional dependencies of the grpc server
+type Option func(*Server)
+
+// WithAuthenticator requires the calls to be authenticated by the given authenticator
+func WithAuthenticator(au *auth.Authenticator) Option {
+	return func(s *Server) {
+		s.auth = au
+	}
+}
+
+func New(ctx context.Context, srv *service.Service, opts ...Option) *Server {
+	s := &Server{
+		srv: srv,
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	interceptors := []grpc.UnaryServerInterceptor{s.recoverPanic, s.requestID}
+	if s.auth.Enabled() {
+		interceptors = append(interceptors, s.authenticate)
+	} else {
+		logging.Logger(ctx).Warn("grpc authentication disabled, all the methods are public")
+	}
+	interceptors = append(interceptors, s.logCall, s.mapErrors)
+
+	s.grpc = grpc.NewServer(grpc.ChainUnaryInterceptor(interceptors...))
+
+	pb.RegisterUserServiceServer(s.grpc, &userServer{srv: srv})
+	pb.RegisterClassServiceServer(s.grpc, &classServer{srv: srv})
+	pb.RegisterBookingServiceServer(s.grpc, &bookingServer{srv: srv})
+
+	return s
+}
+
+// Run serves the grpc api on the given port, it exits the program if the server fails
+func (s *Server) Run(port int) {
+	logging.Logger(context.Background()).Infof("grpc api running on port %d", port)
+
+	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Fatal(s.Serve(lis))
+}
+
+// Serve serves the grpc api on the listener until Stop is called
+func (s *Server) Serve(lis net.Listener) error {
+	return s.grpc.Serve(lis)
+}
+
+// Stop stops the server after the running calls finish
+func (s *Server) Stop() {
+	s.grpc.GracefulStop()
+}
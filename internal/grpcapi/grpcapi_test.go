@@ -0,0 +1,208 @@
+package grpcapi_test
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
+	"github.com/think-free/ABCFitness-challenge/internal/database"
+	"github.com/think-free/ABCFitness-challenge/internal/grpcapi"
+	"github.com/think-free/ABCFitness-challenge/internal/grpcapi/pb"
+	"github.com/think-free/ABCFitness-challenge/internal/service"
+)
+
+func TestGRPC(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(ctx, cliparams.New())
+	srv := service.New(ctx, db)
+	conn := dial(t, grpcapi.New(ctx, srv))
+
+	users := pb.NewUserServiceClient(conn)
+	classes := pb.NewClassServiceClient(conn)
+	bookings := pb.NewBookingServiceClient(conn)
+
+	// Users
+	userReq := &pb.CreateUserRequest{
+		Name:    "John",
+		Surname: "Doe",
+		Email:   "john.doe@example.com",
+		Phone:   "+34123456789",
+	}
+	var header metadata.MD
+	u, err := users.CreateUser(metadata.AppendToOutgoingContext(ctx, grpcapi.MetadataRequestID, "req-1"), userReq, grpc.Header(&header))
+	require.NoError(t, err)
+	require.NotEmpty(t, u.Id)
+	require.Equal(t, int32(1), u.Version)
+	require.Len(t, header.Get(grpcapi.MetadataRequestID), 1)
+	require.NotEqual(t, "req-1", header.Get(grpcapi.MetadataRequestID)[0])
+
+	_, err = users.CreateUser(ctx, userReq)
+	require.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = users.GetUser(ctx, &pb.GetRequest{Id: "unknown"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	_, err = users.CreateUser(ctx, &pb.CreateUserRequest{Name: "Jane", Email: "invalid"})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	// The membership is only set by the staff on the rest api
+	_, err = users.CreateUser(ctx, &pb.CreateUserRequest{Name: "Jane", Email: "jane.doe@example.com", Phone: "+34111111111", Membership: &pb.Membership{Plan: "pack", Credits: 1000}})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	u, err = users.UpdateUser(ctx, &pb.UpdateUserRequest{Id: u.Id, Version: proto.Int32(1), Phone: proto.String("+34987654321")})
+	require.NoError(t, err)
+	require.Equal(t, "+34987654321", u.Phone)
+	require.Equal(t, "John", u.Name)
+
+	_, err = users.UpdateUser(ctx, &pb.UpdateUserRequest{Id: u.Id, Version: proto.Int32(1), Name: proto.String("Johnny")})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	lstU, err := users.ListUsers(ctx, &pb.ListRequest{Count: 10})
+	require.NoError(t, err)
+	require.Len(t, lstU.Users, 1)
+
+	// Classes
+	start := time.Now().AddDate(0, 0, 1).Truncate(time.Hour)
+	c, err := classes.CreateClass(ctx, &pb.CreateClassRequest{
+		Studio:    "Studio 1",
+		ClassName: "Yoga",
+		StartDate: timestamppb.New(start),
+		EndDate:   timestamppb.New(start.AddDate(0, 0, 10)),
+		Capacity:  1,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, c.Id)
+	require.True(t, start.Equal(c.StartDate.AsTime()))
+
+	_, err = classes.CreateClass(ctx, &pb.CreateClassRequest{Studio: "Studio 1", ClassName: "Pilates", Capacity: 1})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	c, err = classes.UpdateClass(ctx, &pb.UpdateClassRequest{Id: c.Id, Room: proto.String("Room 2")})
+	require.NoError(t, err)
+	require.Equal(t, "Room 2", c.Room)
+	require.Equal(t, int32(1), c.Capacity)
+
+	// Bookings
+	b, err := bookings.CreateBooking(ctx, &pb.CreateBookingRequest{Class: c.Id, User: u.Id, Date: timestamppb.New(start)})
+	require.NoError(t, err)
+	require.Equal(t, "booked", b.Status)
+
+	_, err = bookings.CreateBooking(ctx, &pb.CreateBookingRequest{Class: c.Id, User: u.Id})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	details, err := bookings.GetBooking(ctx, &pb.GetRequest{Id: b.Id})
+	require.NoError(t, err)
+	require.Equal(t, b.Id, details.Booking.Id)
+	require.Equal(t, c.Id, details.Class.Id)
+	require.Equal(t, u.Id, details.User.Id)
+
+	lstB, err := bookings.ListUserBookings(ctx, &pb.ListUserBookingsRequest{User: u.Id})
+	require.NoError(t, err)
+	require.Len(t, lstB.Bookings, 1)
+
+	b, err = bookings.CancelBooking(ctx, &pb.GetRequest{Id: b.Id})
+	require.NoError(t, err)
+	require.Equal(t, "cancelled", b.Status)
+	require.NotNil(t, b.CancelledAt)
+
+	_, err = bookings.CancelBooking(ctx, &pb.GetRequest{Id: b.Id})
+	require.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestGRPCAuthentication(t *testing.T) {
+	ctx := context.Background()
+	db := database.New(ctx, cliparams.New())
+	srv := service.New(ctx, db)
+
+	au, err := auth.New(&auth.Config{APIKeys: "admin-key:admin-1:admin,member-key:member-1:member", JWTSecret: "secret"})
+	require.NoError(t, err)
+
+	users := pb.NewUserServiceClient(dial(t, grpcapi.New(ctx, srv, grpcapi.WithAuthenticator(au))))
+
+	_, err = users.ListUsers(ctx, &pb.ListRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = users.ListUsers(metadata.AppendToOutgoingContext(ctx, grpcapi.MetadataAPIKey, "unknown"), &pb.ListRequest{})
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = users.ListUsers(metadata.AppendToOutgoingContext(ctx, grpcapi.MetadataAPIKey, "admin-key"), &pb.ListRequest{})
+	require.NoError(t, err)
+
+	_, err = users.CreateUser(metadata.AppendToOutgoingContext(ctx, grpcapi.MetadataAPIKey, "member-key"), &pb.CreateUserRequest{
+		Name:    "John",
+		Surname: "Doe",
+		Email:   "john.doe@example.com",
+		Phone:   "+34123456789",
+	})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	token, err := auth.SignHS256(&auth.Claims{Subject: "admin-2", Role: "admin", ExpiresAt: time.Now().Add(time.Hour).Unix()}, []byte("secret"))
+	require.NoError(t, err)
+
+	_, err = users.ListUsers(metadata.AppendToOutgoingContext(ctx, grpcapi.MetadataAuthorization, "Bearer "+token), &pb.ListRequest{})
+	require.NoError(t, err)
+
+	// The staff create the members of their studio only, it is their home studio by default
+	token, err = auth.SignHS256(&auth.Claims{Subject: "staff-1", Role: "staff", Studio: "Studio 1", ExpiresAt: time.Now().Add(time.Hour).Unix()}, []byte("secret"))
+	require.NoError(t, err)
+	staff := metadata.AppendToOutgoingContext(ctx, grpcapi.MetadataAuthorization, "Bearer "+token)
+
+	u, err := users.CreateUser(staff, &pb.CreateUserRequest{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"})
+	require.NoError(t, err)
+	require.Equal(t, "Studio 1", u.Studio)
+
+	_, err = users.CreateUser(staff, &pb.CreateUserRequest{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", Phone: "+34987654321", Studio: "Studio 2"})
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	u, err = users.CreateUser(metadata.AppendToOutgoingContext(ctx, grpcapi.MetadataAPIKey, "admin-key"), &pb.CreateUserRequest{Name: "Jane", Surname: "Doe", Email: "jane.doe@example.com", Phone: "+34987654321", Studio: "Studio 2"})
+	require.NoError(t, err)
+	require.Equal(t, "Studio 2", u.Studio)
+}
+
+func TestGRPCPanic(t *testing.T) {
+	ctx := context.Background()
+
+	// Without service every call panics
+	conn := dial(t, grpcapi.New(ctx, nil))
+	users := pb.NewUserServiceClient(conn)
+
+	_, err := users.GetUser(ctx, &pb.GetRequest{Id: "id"})
+	require.Equal(t, codes.Internal, status.Code(err))
+
+	// The server is still running
+	_, err = users.GetUser(ctx, &pb.GetRequest{Id: "id"})
+	require.Equal(t, codes.Internal, status.Code(err))
+}
+
+// dial serves the server on an in memory listener and returns a client connection to it
+func dial(t *testing.T, s *grpcapi.Server) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	go func() {
+		_ = s.Serve(lis)
+	}()
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
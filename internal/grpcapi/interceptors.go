@@ -0,0 +1,150 @@
+package grpcapi
+
+import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/think-free/ABCFitness-challenge/internal/audit"
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+
+	ierrors "github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+// The metadata keys are the lower case http headers of the rest api
+const (
+	MetadataRequestID     = "x-request-id"
+	MetadataAPIKey        = "x-api-key"
+	MetadataAuthorization = "authorization"
+
+	maxRequestIDLength = 128
+)
+
+// recoverPanic returns an internal error for the calls whose handler panics instead of letting the panic stop the
+// server, it runs first so the panics of the other interceptors are recovered too
+func (s *Server) recoverPanic(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			logging.Logger(ctx).Errorf("call '%s' panicked : %v\n%s", info.FullMethod, p, debug.Stack())
+			resp, err = nil, status.Error(codes.Internal, "internal error")
+		}
+	}()
+
+	return handler(ctx, req)
+}
+
+// requestID stores a new request id in the context and sends it back in the header of the response, the id of the
+// metadata is stored apart as the id of the client
+func (s *Server) requestID(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	id := uuid.NewString()
+	_ = grpc.SetHeader(ctx, metadata.Pairs(MetadataRequestID, id))
+
+	clientID := firstMetadata(ctx, MetadataRequestID)
+	if clientID != "" && len(clientID) <= maxRequestIDLength {
+		ctx = audit.ContextWithClientRequestID(ctx, clientID)
+	}
+
+	return handler(audit.ContextWithRequestID(ctx, id), req)
+}
+
+// authenticate rejects the calls without valid credentials and stores the principal of the others in their context
+func (s *Server) authenticate(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	p, err := s.auth.AuthenticateCredentials(firstMetadata(ctx, MetadataAPIKey), firstMetadata(ctx, MetadataAuthorization))
+	if err != nil {
+		logging.Logger(ctx).Warnf("authentication failed for '%s' : %v", info.FullMethod, err)
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+
+	return handler(auth.ContextWithPrincipal(ctx, p), req)
+}
+
+// logCall adds the tags of the call to the logger of the context and logs the outcome of the call
+func (s *Server) logCall(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	ctx = logging.ContextWithLogger(ctx)
+	log := logging.Logger(ctx)
+
+	log.SetTag("grpc.method", info.FullMethod)
+	log.SetTag("grpc.request_id", audit.RequestIDFromContext(ctx))
+
+	if p := auth.PrincipalFromContext(ctx); p != nil {
+		log.SetTag("grpc.principal.id", p.ID)
+		log.SetTag("grpc.principal.role", p.Role)
+		log.SetTag("grpc.principal.method", p.Method)
+	}
+
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	if code == codes.Internal || code == codes.Unknown {
+		log.Errorf("call '%s' failed in %s : %v", info.FullMethod, time.Since(start), err)
+	} else {
+		log.Infof("call '%s' returned '%s' in %s", info.FullMethod, code, time.Since(start))
+	}
+
+	return resp, err
+}
+
+// mapErrors returns the errors of the service as grpc status errors
+func (s *Server) mapErrors(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return nil, statusError(err)
+	}
+
+	return resp, nil
+}
+
+// statusError returns the grpc status error of an internal error, the errors that already are status errors are kept
+func statusError(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	return status.Error(codeForError(err), err.Error())
+}
+
+// codeForError returns the grpc code for the given internal error
+func codeForError(err error) codes.Code {
+	switch ierrors.KindOf(err) {
+	case ierrors.KindValidation, ierrors.KindUnsupportedMediaType, ierrors.KindRequestTooLarge:
+		return codes.InvalidArgument
+	case ierrors.KindNotFound:
+		return codes.NotFound
+	case ierrors.KindAlreadyExists:
+		return codes.AlreadyExists
+	case ierrors.KindConflict:
+		return codes.Aborted
+	case ierrors.KindInvalidState, ierrors.KindPreconditionFailed, ierrors.KindRejected:
+		return codes.FailedPrecondition
+	case ierrors.KindClassFull, ierrors.KindNoCredits:
+		return codes.ResourceExhausted
+	case ierrors.KindUnauthorized:
+		return codes.Unauthenticated
+	case ierrors.KindForbidden:
+		return codes.PermissionDenied
+	default:
+		return codes.Internal
+	}
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(key)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return values[0]
+}
@@ -0,0 +1,218 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/grpcapi/pb"
+	"github.com/think-free/ABCFitness-challenge/internal/service"
+)
+
+// The servers only convert the messages, the errors of the service are mapped to grpc status by the interceptors
+
+type userServer struct {
+	pb.UnimplementedUserServiceServer
+	srv *service.Service
+}
+
+func (s *userServer) CreateUser(ctx context.Context, req *pb.CreateUserRequest) (*pb.User, error) {
+	// The membership is set by the staff on the rest api, the field is kept in the message for the compatibility
+	if req.Membership != nil {
+		return nil, errors.ErrorValidationError()
+	}
+
+	user, err := s.srv.CreateUser(ctx, &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{
+			Name:    req.Name,
+			Surname: req.Surname,
+			Email:   req.Email,
+			Phone:   req.Phone,
+		},
+		Studio: req.Studio,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toUser(user), nil
+}
+
+func (s *userServer) GetUser(ctx context.Context, req *pb.GetRequest) (*pb.User, error) {
+	user, err := s.srv.GetUser(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toUser(user), nil
+}
+
+func (s *userServer) UpdateUser(ctx context.Context, req *pb.UpdateUserRequest) (*pb.User, error) {
+	user, err := s.srv.UpdateUser(withVersion(ctx, req.Version), req.Id, &datamodel.UpdateUserRequest{
+		Name:    req.Name,
+		Surname: req.Surname,
+		Email:   req.Email,
+		Phone:   req.Phone,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toUser(user), nil
+}
+
+func (s *userServer) ListUsers(ctx context.Context, req *pb.ListRequest) (*pb.ListUsersResponse, error) {
+	users, err := s.srv.ListUsers(ctx, listRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListUsersResponse{Users: make([]*pb.User, 0, len(users))}
+	for _, u := range users {
+		resp.Users = append(resp.Users, toUser(u))
+	}
+
+	return resp, nil
+}
+
+type classServer struct {
+	pb.UnimplementedClassServiceServer
+	srv *service.Service
+}
+
+func (s *classServer) CreateClass(ctx context.Context, req *pb.CreateClassRequest) (*pb.Class, error) {
+	class, err := s.srv.CreateClass(ctx, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{
+			Studio:        req.Studio,
+			Room:          req.Room,
+			Name:          req.ClassName,
+			StartDate:     fromTimestamp(req.StartDate),
+			EndDate:       fromTimestamp(req.EndDate),
+			Duration:      int(req.Duration),
+			DailyCapacity: int(req.Capacity),
+			Rules:         fromRules(req.Rules),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toClass(class), nil
+}
+
+func (s *classServer) GetClass(ctx context.Context, req *pb.GetRequest) (*pb.Class, error) {
+	class, err := s.srv.GetClass(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toClass(class), nil
+}
+
+func (s *classServer) UpdateClass(ctx context.Context, req *pb.UpdateClassRequest) (*pb.Class, error) {
+	class, err := s.srv.UpdateClass(withVersion(ctx, req.Version), req.Id, &datamodel.UpdateClassRequest{
+		Name:          req.ClassName,
+		Room:          req.Room,
+		DailyCapacity: optionalInt(req.Capacity),
+		Rules:         fromRules(req.Rules),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toClass(class), nil
+}
+
+func (s *classServer) ListClasses(ctx context.Context, req *pb.ListRequest) (*pb.ListClassesResponse, error) {
+	classes, err := s.srv.ListClasses(ctx, listRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &pb.ListClassesResponse{Classes: make([]*pb.Class, 0, len(classes))}
+	for _, c := range classes {
+		resp.Classes = append(resp.Classes, toClass(c))
+	}
+
+	return resp, nil
+}
+
+type bookingServer struct {
+	pb.UnimplementedBookingServiceServer
+	srv *service.Service
+}
+
+func (s *bookingServer) CreateBooking(ctx context.Context, req *pb.CreateBookingRequest) (*pb.Booking, error) {
+	if req.Date == nil {
+		return nil, errors.ErrorValidationError()
+	}
+
+	booking, err := s.srv.CreateBooking(ctx, &datamodel.CreateBookingRequest{
+		BaseBooking: datamodel.BaseBooking{
+			ClassID: req.Class,
+			UserID:  req.User,
+			Date:    req.Date.AsTime(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return toBooking(booking), nil
+}
+
+func (s *bookingServer) GetBooking(ctx context.Context, req *pb.GetRequest) (*pb.BookingDetails, error) {
+	info, err := s.srv.GetBooking(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.BookingDetails{
+		Booking: toBooking(&info.Booking),
+		Class:   toClass(info.Class),
+		User:    toUser(info.User),
+	}, nil
+}
+
+func (s *bookingServer) ListBookings(ctx context.Context, req *pb.ListRequest) (*pb.ListBookingsResponse, error) {
+	bookings, err := s.srv.ListBookings(ctx, listRequest(req))
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListBookingsResponse{Bookings: toBookings(bookings)}, nil
+}
+
+func (s *bookingServer) ListUserBookings(ctx context.Context, req *pb.ListUserBookingsRequest) (*pb.ListBookingsResponse, error) {
+	bookings, err := s.srv.ListUserBookings(ctx, req.User)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pb.ListBookingsResponse{Bookings: toBookings(bookings)}, nil
+}
+
+func (s *bookingServer) CancelBooking(ctx context.Context, req *pb.GetRequest) (*pb.Booking, error) {
+	booking, err := s.srv.CancelBooking(ctx, req.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return toBooking(booking), nil
+}
+
+func listRequest(req *pb.ListRequest) *datamodel.ListRequest {
+	return &datamodel.ListRequest{
+		Offset: int(req.Offset),
+		Count:  int(req.Count),
+	}
+}
+
+// withVersion requires the entity changed by the call to be at the given version if it is set, like the If-Match
+// header of the rest api
+func withVersion(ctx context.Context, version *int32) context.Context {
+	if version == nil {
+		return ctx
+	}
+	return datamodel.ContextWithIfMatch(ctx, []int{int(*version)})
+}
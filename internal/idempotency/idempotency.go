@@ -0,0 +1,25 @@
+package idempotency
+
+import (
+	"context"
+	"net/http"
+)
+
+// Response is the response of a request, stored to be replayed to the retries of the request
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Store keeps the responses of the requests by idempotency key.
+//
+// Begin reserves the key for the request with the given fingerprint and returns nil, or returns the stored response
+// when the request was already done. It returns an idempotency key reused error if the key was used for a request with
+// another fingerprint, and a request in progress error while the first request is not completed.
+// Complete stores the response of a reserved key, Release frees a reserved key so the request can be retried.
+type Store interface {
+	Begin(ctx context.Context, key, fingerprint string) (*Response, error)
+	Complete(ctx context.Context, key string, resp *Response) error
+	Release(ctx context.Context, key string) error
+}
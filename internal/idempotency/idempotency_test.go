@@ -0,0 +1,51 @@
+package idempotency_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/idempotency"
+	"github.com/think-free/ABCFitness-challenge/internal/idempotency/memory"
+)
+
+func TestMemoryStore(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	var store idempotency.Store = memory.New(ctx, time.Hour).WithClock(func() time.Time { return now })
+
+	resp, err := store.Begin(ctx, "k", "a")
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The key is reserved until the first request completes
+	_, err = store.Begin(ctx, "k", "a")
+	assert.True(t, errors.IsRequestInProgress(err))
+
+	_, err = store.Begin(ctx, "k", "b")
+	assert.True(t, errors.IsIdempotencyKeyReused(err))
+
+	assert.NoError(t, store.Complete(ctx, "k", &idempotency.Response{Status: 201, Body: []byte("created")}))
+
+	resp, err = store.Begin(ctx, "k", "a")
+	assert.NoError(t, err)
+	assert.Equal(t, 201, resp.Status)
+	assert.Equal(t, "created", string(resp.Body))
+
+	// A released key can be used again
+	_, err = store.Begin(ctx, "r", "a")
+	assert.NoError(t, err)
+	assert.NoError(t, store.Release(ctx, "r"))
+	resp, err = store.Begin(ctx, "r", "b")
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+
+	// The key expires after the ttl
+	now = now.Add(time.Hour)
+	resp, err = store.Begin(ctx, "k", "b")
+	assert.NoError(t, err)
+	assert.Nil(t, resp)
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/idempotency"
+)
+
+type entry struct {
+	fingerprint string
+	resp        *idempotency.Response
+	expires     time.Time
+}
+
+// Memory implements the idempotency Store interface with a memory map, the keys expire ttl after they are reserved
+type Memory struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	now     func() time.Time
+	entries map[string]*entry
+	purged  time.Time
+}
+
+func New(ctx context.Context, ttl time.Duration) *Memory {
+	return &Memory{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]*entry),
+	}
+}
+
+// WithClock replaces the clock used to expire the keys, used for tests
+func (m *Memory) WithClock(now func() time.Time) *Memory {
+	m.now = now
+	return m
+}
+
+func (m *Memory) Begin(ctx context.Context, key, fingerprint string) (*idempotency.Response, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.purge(now)
+
+	e, ok := m.entries[key]
+	if !ok || !now.Before(e.expires) {
+		m.entries[key] = &entry{
+			fingerprint: fingerprint,
+			expires:     now.Add(m.ttl),
+		}
+		return nil, nil
+	}
+
+	if e.fingerprint != fingerprint {
+		return nil, errors.ErrorIdempotencyKeyReused()
+	}
+
+	if e.resp == nil {
+		return nil, errors.ErrorRequestInProgress()
+	}
+
+	return e.resp, nil
+}
+
+func (m *Memory) Complete(ctx context.Context, key string, resp *idempotency.Response) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.entries[key]
+	if !ok {
+		return errors.ErrorNotFound()
+	}
+
+	e.resp = resp
+	return nil
+}
+
+func (m *Memory) Release(ctx context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.entries, key)
+	return nil
+}
+
+// purge removes the expired keys, at most once per ttl so the reservations stay cheap
+func (m *Memory) purge(now time.Time) {
+	if now.Sub(m.purged) < m.ttl {
+		return
+	}
+	m.purged = now
+
+	for key, e := range m.entries {
+		if !now.Before(e.expires) {
+			delete(m.entries, key)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package policy
+
+import (
+	"context"
+
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+const (
+	RoleMember = "member"
+	RoleStaff  = "staff"
+	RoleAdmin  = "admin"
+)
+
+type Action string
+
+const (
+	ActionCreateUser        Action = "user.create"
+	ActionListUsers         Action = "user.list"
+	ActionReadUser          Action = "user.read"
+	ActionUpdateUser        Action = "user.update"
+	ActionManageMembership  Action = "user.membership"
+	ActionEraseUser         Action = "user.erase"
+	ActionListClasses       Action = "class.list"
+	ActionManageClass       Action = "class.manage"
+	ActionListAttendees     Action = "class.attendees"
+	ActionCreateBooking     Action = "booking.create"
+	ActionReadBooking       Action = "booking.read"
+	ActionCancelBooking     Action = "booking.cancel"
+	ActionCheckIn           Action = "booking.checkin"
+	ActionManageSuspensions Action = "suspension.manage"
+	ActionReadAudit         Action = "audit.read"
+	ActionManageWebhooks    Action = "webhook.manage"
+)
+
+// Resource identifies the owner of the entity an action is done on, empty fields are not checked. The studio of a user
+// is its home studio
+type Resource struct {
+	UserID string
+	Studio string
+}
+
+// Policy decides if the principal of a request can do an action on a resource
+type Policy interface {
+	Authorize(ctx context.Context, p *auth.Principal, action Action, res *Resource) error
+}
+
+// grant describes who besides the admins can do an action
+type grant struct {
+	// member allows the members to do the action on their own resources
+	member bool
+	// staff allows the staff to do the action, only on the resources of their studio if studioScoped is set
+	staff        bool
+	studioScoped bool
+}
+
+var grants = map[Action]grant{
+	ActionCreateUser:        {staff: true, studioScoped: true},
+	ActionListUsers:         {staff: true},
+	ActionReadUser:          {member: true, staff: true, studioScoped: true},
+	ActionUpdateUser:        {member: true, staff: true, studioScoped: true},
+	ActionManageMembership:  {staff: true, studioScoped: true},
+	ActionEraseUser:         {member: true},
+	ActionListClasses:       {member: true, staff: true},
+	ActionManageClass:       {staff: true, studioScoped: true},
+	ActionListAttendees:     {staff: true, studioScoped: true},
+	ActionCreateBooking:     {member: true, staff: true, studioScoped: true},
+	ActionReadBooking:       {member: true, staff: true, studioScoped: true},
+	ActionCancelBooking:     {member: true, staff: true, studioScoped: true},
+	ActionCheckIn:           {staff: true, studioScoped: true},
+	ActionManageSuspensions: {staff: true, studioScoped: true},
+}
+
+// RoleBased is the default policy : admins can do everything, staff manage their studio and the members whose home
+// studio it is, members can only see and book for themselves. The actions without grant are reserved to the admins.
+type RoleBased struct{}
+
+// Authorize returns a forbidden error if the principal can't do the action, a nil principal is an internal caller
+// (the authentication is disabled or the call comes from a job) and is always allowed
+func (RoleBased) Authorize(ctx context.Context, p *auth.Principal, action Action, res *Resource) error {
+	if p == nil {
+		return nil
+	}
+
+	if res == nil {
+		res = &Resource{}
+	}
+
+	g := grants[action]
+
+	switch p.Role {
+	case RoleAdmin:
+		return nil
+	case RoleStaff:
+		if !g.staff {
+			return errors.ErrorForbidden()
+		}
+		if g.studioScoped && (p.Studio == "" || p.Studio != res.Studio) {
+			return errors.ErrorForbidden()
+		}
+		return nil
+	case RoleMember:
+		if !g.member {
+			return errors.ErrorForbidden()
+		}
+		if res.UserID != "" && res.UserID != p.ID {
+			return errors.ErrorForbidden()
+		}
+		return nil
+	default:
+		return errors.ErrorForbidden()
+	}
+}
@@ -0,0 +1,64 @@
+package policy_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+)
+
+func TestRoleBased(t *testing.T) {
+	ctx := context.Background()
+	pol := policy.RoleBased{}
+
+	admin := &auth.Principal{ID: "admin", Role: policy.RoleAdmin}
+	staff := &auth.Principal{ID: "staff", Role: policy.RoleStaff, Studio: "Studio 1"}
+	member := &auth.Principal{ID: "member", Role: policy.RoleMember}
+	unknown := &auth.Principal{ID: "kiosk", Role: "kiosk"}
+
+	tests := []struct {
+		name    string
+		p       *auth.Principal
+		action  policy.Action
+		res     *policy.Resource
+		allowed bool
+	}{
+		{"internal caller", nil, policy.ActionListUsers, nil, true},
+		{"admin lists users", admin, policy.ActionListUsers, nil, true},
+		{"admin only action", admin, "audit.read", nil, true},
+		{"staff lists users", staff, policy.ActionListUsers, nil, true},
+		{"staff manages its studio", staff, policy.ActionManageClass, &policy.Resource{Studio: "Studio 1"}, true},
+		{"staff manages another studio", staff, policy.ActionManageClass, &policy.Resource{Studio: "Studio 2"}, false},
+		{"staff checks in at its studio", staff, policy.ActionCheckIn, &policy.Resource{UserID: "member", Studio: "Studio 1"}, true},
+		{"staff without admin grant", staff, "audit.read", nil, false},
+		{"staff reads a member of its studio", staff, policy.ActionReadUser, &policy.Resource{UserID: "member", Studio: "Studio 1"}, true},
+		{"staff reads a member of another studio", staff, policy.ActionReadUser, &policy.Resource{UserID: "member", Studio: "Studio 2"}, false},
+		{"staff reads a member without studio", staff, policy.ActionReadUser, &policy.Resource{UserID: "member"}, false},
+		{"staff sets a membership at another studio", staff, policy.ActionManageMembership, &policy.Resource{UserID: "member", Studio: "Studio 2"}, false},
+		{"staff suspends at another studio", staff, policy.ActionManageSuspensions, &policy.Resource{UserID: "member", Studio: "Studio 2"}, false},
+		{"staff creates a member of another studio", staff, policy.ActionCreateUser, &policy.Resource{Studio: "Studio 2"}, false},
+		{"admin reads a member without studio", admin, policy.ActionReadUser, &policy.Resource{UserID: "member"}, true},
+		{"member books for itself", member, policy.ActionCreateBooking, &policy.Resource{UserID: "member", Studio: "Studio 1"}, true},
+		{"member books for another", member, policy.ActionCreateBooking, &policy.Resource{UserID: "other", Studio: "Studio 1"}, false},
+		{"member reads itself", member, policy.ActionReadUser, &policy.Resource{UserID: "member"}, true},
+		{"member reads itself at any studio", member, policy.ActionReadUser, &policy.Resource{UserID: "member", Studio: "Studio 2"}, true},
+		{"member lists users", member, policy.ActionListUsers, nil, false},
+		{"member lists classes", member, policy.ActionListClasses, nil, true},
+		{"member creates class", member, policy.ActionManageClass, &policy.Resource{Studio: "Studio 1"}, false},
+		{"member checks in", member, policy.ActionCheckIn, &policy.Resource{UserID: "member", Studio: "Studio 1"}, false},
+		{"unknown role", unknown, policy.ActionListClasses, nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := pol.Authorize(ctx, tt.p, tt.action, tt.res)
+			if tt.allowed {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,154 @@
+package rules
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+)
+
+const (
+	RuleAdvanceWindow     = "advance_window"
+	RuleCutOff            = "cutoff"
+	RuleMaxPerClassPerDay = "max_per_class_per_day"
+	RuleMaxOpenBookings   = "max_open_bookings"
+)
+
+// Rule is a booking rule evaluated before a booking is saved
+type Rule interface {
+	// Name identifies the rule in the violation errors
+	Name() string
+	// Evaluate returns an error describing why the booking is rejected, nil if it is accepted
+	Evaluate(ctx context.Context, bc *BookingContext) error
+}
+
+// BookingContext is the information available to the rules to evaluate a booking
+type BookingContext struct {
+	Now          time.Time
+	Booking      *datamodel.Booking
+	Class        *datamodel.Class
+	UserBookings []*datamodel.Booking
+}
+
+// FromConfig returns the built-in rules enabled in the given configuration
+func FromConfig(cfg *datamodel.BookingRules) []Rule {
+	var rules []Rule
+	if cfg == nil {
+		return rules
+	}
+
+	if cfg.MaxAdvanceDays > 0 {
+		rules = append(rules, &AdvanceWindow{Max: time.Duration(cfg.MaxAdvanceDays) * 24 * time.Hour})
+	}
+	if cfg.CutOffMinutes > 0 {
+		rules = append(rules, &CutOff{Before: time.Duration(cfg.CutOffMinutes) * time.Minute})
+	}
+	if cfg.MaxPerUserPerClassPerDay > 0 {
+		rules = append(rules, &MaxPerClassPerDay{Max: cfg.MaxPerUserPerClassPerDay})
+	}
+	if cfg.MaxOpenBookings > 0 {
+		rules = append(rules, &MaxOpenBookings{Max: cfg.MaxOpenBookings})
+	}
+
+	return rules
+}
+
+// Evaluate runs the rules in order and returns a rule violation error for the first one rejecting the booking
+func Evaluate(ctx context.Context, bc *BookingContext, rules ...Rule) error {
+	for _, r := range rules {
+		err := r.Evaluate(ctx, bc)
+		if err != nil {
+			return errors.ErrorRuleViolation(r.Name(), err.Error())
+		}
+	}
+
+	return nil
+}
+
+// AdvanceWindow rejects the bookings of sessions starting more than Max after now
+type AdvanceWindow struct {
+	Max time.Duration
+}
+
+func (r *AdvanceWindow) Name() string {
+	return RuleAdvanceWindow
+}
+
+func (r *AdvanceWindow) Evaluate(ctx context.Context, bc *BookingContext) error {
+	start := bc.Class.SessionStart(bc.Booking.Date)
+	if start.Sub(bc.Now) > r.Max {
+		return fmt.Errorf("session starting at %s can't be booked more than %s ahead", start.Format(time.RFC3339), r.Max)
+	}
+
+	return nil
+}
+
+// CutOff rejects the bookings of sessions starting in less than Before, including the sessions already started
+type CutOff struct {
+	Before time.Duration
+}
+
+func (r *CutOff) Name() string {
+	return RuleCutOff
+}
+
+func (r *CutOff) Evaluate(ctx context.Context, bc *BookingContext) error {
+	start := bc.Class.SessionStart(bc.Booking.Date)
+	if start.Sub(bc.Now) < r.Before {
+		return fmt.Errorf("session starting at %s can't be booked less than %s before it starts", start.Format(time.RFC3339), r.Before)
+	}
+
+	return nil
+}
+
+// MaxPerClassPerDay limits the number of bookings of a user for the same class and day
+type MaxPerClassPerDay struct {
+	Max int
+}
+
+func (r *MaxPerClassPerDay) Name() string {
+	return RuleMaxPerClassPerDay
+}
+
+func (r *MaxPerClassPerDay) Evaluate(ctx context.Context, bc *BookingContext) error {
+	count := 0
+	day := datamodel.Day(bc.Booking.Date)
+	for _, b := range bc.UserBookings {
+		if b.IsActive() && b.ClassID == bc.Booking.ClassID && datamodel.Day(b.Date).Equal(day) {
+			count++
+		}
+	}
+
+	if count >= r.Max {
+		return fmt.Errorf("user already has %d bookings for this class on %s", count, day.Format(time.DateOnly))
+	}
+
+	return nil
+}
+
+// MaxOpenBookings limits the number of bookings of a user not yet attended for the sessions of today and the coming days
+type MaxOpenBookings struct {
+	Max int
+}
+
+func (r *MaxOpenBookings) Name() string {
+	return RuleMaxOpenBookings
+}
+
+func (r *MaxOpenBookings) Evaluate(ctx context.Context, bc *BookingContext) error {
+	count := 0
+	today := datamodel.Day(bc.Now)
+	for _, b := range bc.UserBookings {
+		if b.Status == datamodel.BookingStatusBooked && !datamodel.Day(b.Date).Before(today) {
+			count++
+		}
+	}
+
+	if count >= r.Max {
+		return fmt.Errorf("user already has %d open bookings", count)
+	}
+
+	return nil
+}
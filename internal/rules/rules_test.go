@@ -0,0 +1,98 @@
+package rules_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/rules"
+)
+
+func TestRules(t *testing.T) {
+	ctx := context.Background()
+
+	start := time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC)
+	end := time.Date(2023, 10, 31, 0, 0, 0, 0, time.UTC)
+	class := &datamodel.Class{
+		ID: "class-id",
+		BaseClass: datamodel.BaseClass{
+			StartDate: &start,
+			EndDate:   &end,
+			Duration:  60,
+		},
+	}
+
+	now := time.Date(2023, 10, 10, 12, 0, 0, 0, time.UTC)
+	bookingOn := func(day int) *datamodel.Booking {
+		return &datamodel.Booking{
+			BaseBooking: datamodel.BaseBooking{
+				ClassID: class.ID,
+				UserID:  "user-id",
+				Date:    time.Date(2023, 10, day, 0, 0, 0, 0, time.UTC),
+			},
+			Status: datamodel.BookingStatusBooked,
+		}
+	}
+
+	evaluate := func(cfg *datamodel.BookingRules, b *datamodel.Booking, userBookings ...*datamodel.Booking) error {
+		return rules.Evaluate(ctx, &rules.BookingContext{
+			Now:          now,
+			Booking:      b,
+			Class:        class,
+			UserBookings: userBookings,
+		}, rules.FromConfig(cfg)...)
+	}
+
+	// No rule configured, everything is accepted
+	require.NoError(t, evaluate(nil, bookingOn(1)))
+
+	// Advance window
+	cfg := &datamodel.BookingRules{MaxAdvanceDays: 14}
+	require.NoError(t, evaluate(cfg, bookingOn(23)))
+	err := evaluate(cfg, bookingOn(24))
+	require.True(t, errors.IsRuleViolation(err))
+	require.Contains(t, err.Error(), rules.RuleAdvanceWindow)
+
+	// Cut-off, the session of today starts at 18:00
+	cfg = &datamodel.BookingRules{CutOffMinutes: 60}
+	require.NoError(t, evaluate(cfg, bookingOn(10)))
+	now = time.Date(2023, 10, 10, 17, 30, 0, 0, time.UTC)
+	err = evaluate(cfg, bookingOn(10))
+	require.Contains(t, err.Error(), rules.RuleCutOff)
+	require.Contains(t, evaluate(cfg, bookingOn(9)).Error(), rules.RuleCutOff)
+
+	// One booking per class per day
+	cfg = &datamodel.BookingRules{MaxPerUserPerClassPerDay: 1}
+	require.NoError(t, evaluate(cfg, bookingOn(12), bookingOn(11)))
+	require.Contains(t, evaluate(cfg, bookingOn(12), bookingOn(12)).Error(), rules.RuleMaxPerClassPerDay)
+
+	// Open bookings, the bookings of the past days are not open anymore
+	cfg = &datamodel.BookingRules{MaxOpenBookings: 2}
+	require.NoError(t, evaluate(cfg, bookingOn(20), bookingOn(1), bookingOn(2), bookingOn(11)))
+	require.Contains(t, evaluate(cfg, bookingOn(20), bookingOn(10), bookingOn(11)).Error(), rules.RuleMaxOpenBookings)
+
+	// Cancelled bookings are not counted
+	cancelled, err := bookingOn(10).Cancel(class, 0, now)
+	require.NoError(t, err)
+	require.NoError(t, evaluate(cfg, bookingOn(20), cancelled, bookingOn(11)))
+}
+
+func TestMerge(t *testing.T) {
+	studio := &datamodel.BookingRules{MaxAdvanceDays: 14, MaxOpenBookings: 3}
+	class := &datamodel.BookingRules{MaxOpenBookings: 1, CutOffMinutes: 60}
+
+	require.Equal(t, &datamodel.BookingRules{MaxAdvanceDays: 14, MaxOpenBookings: 1, CutOffMinutes: 60}, studio.Merge(class))
+	require.Equal(t, studio, studio.Merge(nil))
+
+	var none *datamodel.BookingRules
+	require.Equal(t, class, none.Merge(class))
+
+	// A class can relax the rules of its studio or disable them
+	relaxed := &datamodel.BookingRules{MaxAdvanceDays: 30, MaxOpenBookings: datamodel.RuleDisabled}
+	require.Equal(t, &datamodel.BookingRules{MaxAdvanceDays: 30}, studio.Merge(relaxed))
+	require.Len(t, rules.FromConfig(studio.Merge(relaxed)), 1)
+	require.Equal(t, &datamodel.BookingRules{MaxAdvanceDays: 30}, relaxed.Merge(nil))
+}
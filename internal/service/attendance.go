@@ -0,0 +1,179 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// CheckIn marks the booking as attended, it is only possible around the session of the booking
+func (s *Service) CheckIn(ctx context.Context, id string) (*datamodel.Booking, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.checkin.booking_id", id)
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	booking, err := s.db.GetBookingByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting booking : %v", err)
+		return nil, err
+	}
+
+	class, err := s.db.GetClassByID(ctx, booking.ClassID)
+	if err != nil {
+		log.Errorf("error getting class : %v", err)
+		return nil, err
+	}
+
+	err = s.authorizeFound(ctx, policy.ActionCheckIn, policy.ActionReadBooking, &policy.Resource{UserID: booking.UserID, Studio: class.Studio})
+	if err != nil {
+		return nil, err
+	}
+
+	err = datamodel.CheckVersion(ctx, booking.Version)
+	if err != nil {
+		log.Errorf("booking '%s' changed : %v", booking.ID, err)
+		return nil, err
+	}
+
+	checkedIn, err := booking.CheckIn(class, s.now())
+	if err != nil {
+		log.Errorf("error checking in booking with status '%s' : %v", booking.Status, err)
+		return nil, err
+	}
+
+	err = s.db.UpdateBooking(ctx, checkedIn, s.newEvent(ctx, datamodel.EventBookingCheckedIn, checkedIn.ID, checkedIn))
+	if err != nil {
+		log.Errorf("error updating booking : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityBooking, booking.ID, booking, checkedIn)
+	s.relay.Notify()
+
+	log.Debugf("booking '%s' checked in", booking.ID)
+
+	return checkedIn, nil
+}
+
+// GetAttendance returns the booking history of the user sorted by date
+func (s *Service) GetAttendance(ctx context.Context, userID string) (*datamodel.Attendance, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.attendance.user_id", userID)
+
+	_, err := s.authorizeUser(ctx, policy.ActionReadUser, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	bookings, err := s.db.ListBookingsByUser(ctx, userID)
+	if err != nil {
+		log.Errorf("error listing bookings : %v", err)
+		return nil, err
+	}
+
+	sort.Slice(bookings, func(i, j int) bool {
+		return bookings[i].Date.Before(bookings[j].Date)
+	})
+
+	attendance := datamodel.NewAttendance(userID, bookings)
+
+	log.Debugf("user '%s' attended %d sessions and missed %d", userID, attendance.CheckedIn, attendance.NoShows)
+
+	return attendance, nil
+}
+
+// MarkNoShows marks as no-show the bookings whose session ended without check-in, it returns the updated bookings
+func (s *Service) MarkNoShows(ctx context.Context) ([]*datamodel.Booking, error) {
+	log := logging.Logger(ctx)
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	bookings, err := s.db.ListBookingsByStatus(ctx, datamodel.BookingStatusBooked)
+	if err != nil {
+		log.Errorf("error listing bookings : %v", err)
+		return nil, err
+	}
+
+	now := s.now()
+	classes := make(map[string]*datamodel.Class)
+
+	var marked []*datamodel.Booking
+	for _, booking := range bookings {
+		class, ok := classes[booking.ClassID]
+		if !ok {
+			class, err = s.db.GetClassByID(ctx, booking.ClassID)
+			if err != nil {
+				log.Errorf("error getting class '%s' of booking '%s' : %v", booking.ClassID, booking.ID, err)
+				continue
+			}
+			classes[class.ID] = class
+		}
+
+		noShow, ok := booking.MarkNoShow(class, now)
+		if !ok {
+			continue
+		}
+
+		err = s.db.UpdateBooking(ctx, noShow, s.newEvent(ctx, datamodel.EventBookingNoShow, noShow.ID, noShow))
+		if err != nil {
+			log.Errorf("error updating booking '%s' : %v", booking.ID, err)
+			continue
+		}
+
+		s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityBooking, booking.ID, booking, noShow)
+		s.relay.Notify()
+
+		marked = append(marked, noShow)
+	}
+
+	if len(marked) > 0 {
+		log.Infof("%d bookings marked as no-show", len(marked))
+	}
+
+	users := make(map[string]bool)
+	for _, b := range marked {
+		if users[b.UserID] {
+			continue
+		}
+		users[b.UserID] = true
+
+		err = s.applyNoShowPolicy(ctx, b.UserID)
+		if err != nil {
+			log.Errorf("error applying no-show policy to user '%s' : %v", b.UserID, err)
+		}
+	}
+
+	return marked, nil
+}
+
+// RunNoShowJob marks the no-shows every interval until the context is done
+func (s *Service) RunNoShowJob(ctx context.Context, interval time.Duration) {
+	log := logging.Logger(ctx)
+
+	log.Infof("no-show job running every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("no-show job stopped")
+			return
+		case <-ticker.C:
+			_, err := s.MarkNoShows(ctx)
+			if err != nil {
+				log.Errorf("error marking no-shows : %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/google/uuid"
+
+	"github.com/think-free/ABCFitness-challenge/internal/audit"
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// ListAudit returns the audit entries matching the filter in the order they were recorded
+func (s *Service) ListAudit(ctx context.Context, f *datamodel.AuditFilter) ([]*datamodel.AuditEntry, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.audit.actor", f.Actor)
+	log.SetTag("req.audit.action", f.Action)
+	log.SetTag("req.audit.entity", f.Entity)
+	log.SetTag("req.audit.entity_id", f.EntityID)
+
+	err := s.authorize(ctx, policy.ActionReadAudit, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.audit.List(ctx, f)
+	if err != nil {
+		log.Errorf("error listing audit entries : %v", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// record appends an entry to the audit trail, before is nil for a creation and after is nil for a deletion.
+// The change is already done, a failure is logged but not returned to the caller. The users are passed redacted so
+// the trail never holds the personal data an erasure removes
+func (s *Service) record(ctx context.Context, action, entity, entityID string, before, after interface{}) {
+	log := logging.Logger(ctx)
+
+	actor := datamodel.AuditActorSystem
+	if p := auth.PrincipalFromContext(ctx); p != nil {
+		actor = p.ID
+	}
+
+	entry := &datamodel.AuditEntry{
+		ID:              uuid.NewString(),
+		Timestamp:       s.now(),
+		Actor:           actor,
+		Action:          action,
+		Entity:          entity,
+		EntityID:        entityID,
+		Before:          snapshot(before),
+		After:           snapshot(after),
+		RequestID:       audit.RequestIDFromContext(ctx),
+		ClientRequestID: audit.ClientRequestIDFromContext(ctx),
+	}
+
+	err := s.audit.Append(ctx, entry)
+	if err != nil {
+		log.Errorf("error recording audit entry '%s' of %s '%s' : %v", action, entity, entityID, err)
+	}
+}
+
+// snapshot returns the json of the entity, nil for a nil entity
+func snapshot(v interface{}) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return nil
+	}
+
+	return b
+}
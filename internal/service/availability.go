@@ -0,0 +1,283 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+const (
+	// availabilityDays is the number of days of availability listed when the range is not given
+	availabilityDays = 31
+	// maxAvailabilityDays is the longest range of availability listed, a class has a session every day
+	maxAvailabilityDays = 366
+)
+
+// availabilityWatcher receives the availability of the sessions of a class, of a single day if date is set
+type availabilityWatcher struct {
+	classID string
+	date    *time.Time
+
+	// mu protects updates from being closed while an availability is pushed
+	mu      sync.Mutex
+	closed  bool
+	updates chan *datamodel.Availability
+}
+
+// push replaces the availability not read yet, a slow reader only gets the latest one instead of blocking the service
+func (w *availabilityWatcher) push(a *datamodel.Availability) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return
+	}
+
+	select {
+	case <-w.updates:
+	default:
+	}
+
+	w.updates <- a
+}
+
+func (w *availabilityWatcher) close() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if !w.closed {
+		w.closed = true
+		close(w.updates)
+	}
+}
+
+// wants returns true if the watcher follows the session of the day
+func (w *availabilityWatcher) wants(day time.Time) bool {
+	return w.date == nil || w.date.Equal(datamodel.Day(day))
+}
+
+// WatchAvailability returns the availability of the sessions of the class each time a booking of the class is created
+// or cancelled, only for the session of the given date if not nil. The current availability of that session is sent
+// first. The updates stop and the channel is closed when the context is done.
+func (s *Service) WatchAvailability(ctx context.Context, classID string, date *time.Time) (<-chan *datamodel.Availability, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.availability.class_id", classID)
+	log.SetTag("req.availability.date", date)
+
+	err := s.authorize(ctx, policy.ActionListClasses, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	class, err := s.db.GetClassByID(ctx, classID)
+	if err != nil {
+		log.Errorf("error getting class : %v", err)
+		return nil, err
+	}
+
+	w := &availabilityWatcher{
+		classID: class.ID,
+		updates: make(chan *datamodel.Availability, 1),
+	}
+
+	if date != nil {
+		if !class.HasSessionOn(*date) {
+			log.Errorf("class '%s' has no session on %s", class.ID, date)
+			return nil, errors.ErrorValidationError()
+		}
+
+		day := datamodel.Day(*date)
+		w.date = &day
+
+		a, err := s.availability(ctx, class, day)
+		if err != nil {
+			log.Errorf("error getting availability : %v", err)
+			return nil, err
+		}
+		w.push(a)
+	}
+
+	s.watchersMu.Lock()
+	if s.watchers[class.ID] == nil {
+		s.watchers[class.ID] = make(map[*availabilityWatcher]struct{})
+	}
+	s.watchers[class.ID][w] = struct{}{}
+	s.watchersMu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+
+		s.watchersMu.Lock()
+		delete(s.watchers[class.ID], w)
+		if len(s.watchers[class.ID]) == 0 {
+			delete(s.watchers, class.ID)
+		}
+		s.watchersMu.Unlock()
+
+		w.close()
+	}()
+
+	return w.updates, nil
+}
+
+// GetAvailability returns the availability of each session of the class between the given days, the range is
+// limited to the sessions of the class, starts today and lasts availabilityDays by default and can't be longer than
+// maxAvailabilityDays
+func (s *Service) GetAvailability(ctx context.Context, classID string, from, to *time.Time) ([]*datamodel.Availability, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.availability.class_id", classID)
+	log.SetTag("req.availability.from", from)
+	log.SetTag("req.availability.to", to)
+
+	err := s.authorize(ctx, policy.ActionListClasses, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	start := datamodel.Day(s.now())
+	if from != nil {
+		start = datamodel.Day(*from)
+	}
+	end := start.AddDate(0, 0, availabilityDays-1)
+	if to != nil {
+		end = datamodel.Day(*to)
+	}
+
+	if (from != nil && to != nil && from.After(*to)) || end.After(start.AddDate(0, 0, maxAvailabilityDays-1)) {
+		log.Errorf("invalid range between %s and %s", start, end)
+		return nil, errors.ErrorValidationError()
+	}
+
+	class, err := s.db.GetClassByID(ctx, classID)
+	if err != nil {
+		log.Errorf("error getting class : %v", err)
+		return nil, err
+	}
+
+	first, last := datamodel.Day(*class.StartDate), datamodel.Day(*class.EndDate)
+	if start.After(first) {
+		first = start
+	}
+	if end.Before(last) {
+		last = end
+	}
+
+	if first.After(last) {
+		log.Errorf("no session of class '%s' between %s and %s", class.ID, start, end)
+		return nil, errors.ErrorValidationError()
+	}
+
+	booked, err := s.db.CountBookingsByClassAndDays(ctx, class.ID, first, last)
+	if err != nil {
+		log.Errorf("error counting bookings : %v", err)
+		return nil, err
+	}
+
+	var availability []*datamodel.Availability
+	for day := first; !day.After(last); day = day.AddDate(0, 0, 1) {
+		availability = append(availability, datamodel.NewAvailability(class, day, booked[day]))
+	}
+
+	return availability, nil
+}
+
+// availability returns the availability of the session of the class on the day
+func (s *Service) availability(ctx context.Context, class *datamodel.Class, day time.Time) (*datamodel.Availability, error) {
+	booked, err := s.db.CountBookingsByClassAndDate(ctx, class.ID, day)
+	if err != nil {
+		return nil, err
+	}
+
+	return datamodel.NewAvailability(class, day, booked), nil
+}
+
+// publishAvailability pushes the availability changed by the event to the watchers of the class, it is the publisher
+// of the availability streams. The streams are best effort, their errors are logged and never retried.
+func (s *Service) publishAvailability(ctx context.Context, e *datamodel.Event) error {
+	log := logging.Logger(ctx)
+
+	var classID string
+	var days []time.Time
+
+	switch e.Type {
+	case datamodel.EventBookingCreated, datamodel.EventBookingCancelled:
+		var b datamodel.Booking
+		err := e.Decode(&b)
+		if err != nil {
+			log.Errorf("error decoding booking of event '%s' : %v", e.ID, err)
+			return nil
+		}
+		classID = b.ClassID
+		days = []time.Time{datamodel.Day(b.Date)}
+	case datamodel.EventClassUpdated:
+		// A new capacity changes the availability of the sessions followed
+		classID = e.EntityID
+	default:
+		return nil
+	}
+
+	watchers := s.availabilityWatchers(classID)
+	if len(watchers) == 0 {
+		return nil
+	}
+
+	if days == nil {
+		days = watchedDays(watchers)
+	}
+
+	class, err := s.db.GetClassByID(ctx, classID)
+	if err != nil {
+		log.Errorf("error getting class '%s' of event '%s' : %v", classID, e.ID, err)
+		return nil
+	}
+
+	for _, day := range days {
+		a, err := s.availability(ctx, class, day)
+		if err != nil {
+			log.Errorf("error getting availability of class '%s' : %v", classID, err)
+			return nil
+		}
+
+		for _, w := range watchers {
+			if w.wants(day) {
+				w.push(a)
+			}
+		}
+	}
+
+	return nil
+}
+
+// availabilityWatchers returns the watchers of the class
+func (s *Service) availabilityWatchers(classID string) []*availabilityWatcher {
+	s.watchersMu.Lock()
+	defer s.watchersMu.Unlock()
+
+	watchers := make([]*availabilityWatcher, 0, len(s.watchers[classID]))
+	for w := range s.watchers[classID] {
+		watchers = append(watchers, w)
+	}
+
+	return watchers
+}
+
+// watchedDays returns the days followed by the watchers of a single day
+func watchedDays(watchers []*availabilityWatcher) []time.Time {
+	seen := make(map[time.Time]bool)
+	var days []time.Time
+	for _, w := range watchers {
+		if w.date != nil && !seen[*w.date] {
+			seen[*w.date] = true
+			days = append(days, *w.date)
+		}
+	}
+
+	return days
+}
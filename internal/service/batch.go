@@ -0,0 +1,293 @@
+package service
+
+import (
+	"context"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// batchState is what the bookings already accepted in a batch change for the next ones : the entitlements they
+// consume, the bookings of their users and the spots they take in their sessions
+type batchState struct {
+	users       map[string]*datamodel.User
+	memberships map[string]*datamodel.Membership
+	bookings    map[string][]*datamodel.Booking
+	pending     map[string]int
+}
+
+func sessionKey(b *datamodel.Booking) string {
+	return b.ClassID + "/" + datamodel.Day(b.Date).Format("2006-01-02")
+}
+
+// CreateBookings books all the requests of the batch, each booking is checked like a single one taking into account
+// the bookings accepted before it in the batch. In atomic mode nothing is created if one booking fails, in best effort
+// mode the bookings that can be created are. The errors of the bookings are reported by item, the returned error is
+// only set if the batch itself is invalid
+func (s *Service) CreateBookings(ctx context.Context, req *datamodel.CreateBatchBookingRequest) (*datamodel.BatchBookingResponse, error) {
+	log := logging.Logger(ctx)
+
+	mode := req.Mode
+	if mode == "" {
+		mode = datamodel.BatchModeAtomic
+	}
+
+	log.SetTag("req.batch.mode", mode)
+	log.SetTag("req.batch.count", len(req.Bookings))
+
+	if mode != datamodel.BatchModeAtomic && mode != datamodel.BatchModeBestEffort {
+		log.Errorf("unknown batch mode '%s'", mode)
+		return nil, errors.ErrorValidationError()
+	}
+
+	if len(req.Bookings) == 0 || len(req.Bookings) > datamodel.MaxBatchBookings {
+		log.Errorf("batch of %d bookings, expected 1 to %d", len(req.Bookings), datamodel.MaxBatchBookings)
+		return nil, errors.ErrorValidationError()
+	}
+
+	resp := &datamodel.BatchBookingResponse{
+		Mode:    mode,
+		Results: make([]*datamodel.BatchItemResult, len(req.Bookings)),
+	}
+
+	bookings := make([]*datamodel.Booking, len(req.Bookings))
+	classes := make(map[string]*datamodel.Class)
+	for i, r := range req.Bookings {
+		resp.Results[i] = &datamodel.BatchItemResult{Index: i}
+		booking, err := s.newBatchBooking(ctx, r, classes)
+		if err != nil {
+			s.failBatchItem(resp, i, err)
+			continue
+		}
+		bookings[i] = booking
+	}
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	st := &batchState{
+		users:       make(map[string]*datamodel.User),
+		memberships: make(map[string]*datamodel.Membership),
+		bookings:    make(map[string][]*datamodel.Booking),
+		pending:     make(map[string]int),
+	}
+
+	for i, booking := range bookings {
+		if booking == nil {
+			continue
+		}
+
+		err := s.planBatchBooking(ctx, booking, classes[booking.ClassID], st)
+		if err != nil {
+			s.failBatchItem(resp, i, err)
+			bookings[i] = nil
+		}
+	}
+
+	if mode == datamodel.BatchModeAtomic && resp.Failed > 0 {
+		log.Errorf("atomic batch rejected, %d bookings failed", resp.Failed)
+		abortBatch(resp)
+		return resp, nil
+	}
+
+	s.commitBatch(ctx, mode, bookings, st, resp)
+
+	log.Infof("batch of %d bookings : %d created, %d failed", len(req.Bookings), resp.Created, resp.Failed)
+
+	return resp, nil
+}
+
+// newBatchBooking returns the booking of the request after checking the caller can book the class
+func (s *Service) newBatchBooking(ctx context.Context, r *datamodel.CreateBookingRequest, classes map[string]*datamodel.Class) (*datamodel.Booking, error) {
+	if r == nil {
+		return nil, errors.ErrorValidationError()
+	}
+
+	booking, err := datamodel.NewBooking(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	class, ok := classes[booking.ClassID]
+	if !ok {
+		class, err = s.db.GetClassByID(ctx, booking.ClassID)
+		if err != nil {
+			return nil, err
+		}
+		classes[class.ID] = class
+	}
+
+	err = s.authorize(ctx, policy.ActionCreateBooking, &policy.Resource{UserID: booking.UserID, Studio: class.Studio})
+	if err != nil {
+		return nil, err
+	}
+
+	return booking, nil
+}
+
+// planBatchBooking checks the booking like a single booking and adds it to the state of the batch if it is accepted
+func (s *Service) planBatchBooking(ctx context.Context, booking *datamodel.Booking, class *datamodel.Class, st *batchState) error {
+	user, ok := st.users[booking.UserID]
+	if !ok {
+		var err error
+		user, err = s.db.GetUserByID(ctx, booking.UserID)
+		if err != nil {
+			return err
+		}
+
+		userBookings, err := s.db.ListBookingsByUser(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+
+		st.users[user.ID] = user
+		st.memberships[user.ID] = user.Membership.Copy()
+		st.bookings[user.ID] = userBookings
+	}
+
+	err := s.checkSuspension(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range st.bookings[user.ID] {
+		if b.IsActive() && b.ClassID == booking.ClassID && datamodel.Day(b.Date).Equal(datamodel.Day(booking.Date)) {
+			return errors.ErrorAlreadyExists()
+		}
+	}
+
+	err = s.evaluateRules(ctx, booking, class, st.bookings[user.ID])
+	if err != nil {
+		return err
+	}
+
+	err = s.checkCapacity(ctx, class, booking.Date, st.pending[sessionKey(booking)])
+	if err != nil {
+		return err
+	}
+
+	booking.Consumed, err = st.memberships[user.ID].Consume(booking.Date)
+	if err != nil {
+		return err
+	}
+
+	st.bookings[user.ID] = append(st.bookings[user.ID], booking)
+	st.pending[sessionKey(booking)]++
+
+	return nil
+}
+
+// commitBatch saves the accepted bookings and the entitlements they consume. In atomic mode a failure rolls back the
+// whole batch, in best effort mode it only rolls back the bookings of the user concerned. The users are committed in
+// the order of their first booking in the batch.
+func (s *Service) commitBatch(ctx context.Context, mode datamodel.BatchMode, bookings []*datamodel.Booking, st *batchState, resp *datamodel.BatchBookingResponse) {
+	log := logging.Logger(ctx)
+
+	var users []string
+	saved := make(map[string][]int)
+	for i, booking := range bookings {
+		if booking == nil {
+			continue
+		}
+
+		err := s.db.SaveBooking(ctx, booking, s.newEvent(ctx, datamodel.EventBookingCreated, booking.ID, booking))
+		if err != nil {
+			log.Errorf("error saving booking %d of batch : %v", i, err)
+			s.failBatchItem(resp, i, err)
+			if mode == datamodel.BatchModeAtomic {
+				s.rollbackBatch(ctx, bookings, users, saved, nil, st)
+				abortBatch(resp)
+				return
+			}
+			st.memberships[booking.UserID].Refund(booking.Consumed)
+			continue
+		}
+
+		if _, ok := saved[booking.UserID]; !ok {
+			users = append(users, booking.UserID)
+		}
+		saved[booking.UserID] = append(saved[booking.UserID], i)
+	}
+
+	// updated are the users whose membership was saved, with their new version
+	updated := make(map[string]*datamodel.User)
+	for _, userID := range users {
+		user, err := s.updateMembership(ctx, st.users[userID], st.memberships[userID])
+		if err == nil {
+			updated[userID] = user
+			continue
+		}
+
+		log.Errorf("error updating entitlement of user '%s' : %v", userID, err)
+		if mode == datamodel.BatchModeAtomic {
+			for _, i := range saved[userID] {
+				s.failBatchItem(resp, i, err)
+			}
+			s.rollbackBatch(ctx, bookings, users, saved, updated, st)
+			abortBatch(resp)
+			return
+		}
+
+		s.rollbackBatch(ctx, bookings, []string{userID}, saved, nil, st)
+		for _, i := range saved[userID] {
+			s.failBatchItem(resp, i, err)
+		}
+		delete(saved, userID)
+	}
+
+	s.relay.Notify()
+
+	for _, userID := range users {
+		for _, i := range saved[userID] {
+			s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntityBooking, bookings[i].ID, nil, bookings[i])
+			resp.Results[i].Status = datamodel.BatchItemCreated
+			resp.Results[i].Booking = bookings[i]
+			resp.Created++
+		}
+	}
+}
+
+// rollbackBatch deletes the saved bookings of the users and gives back their membership before the batch to the
+// updated ones
+func (s *Service) rollbackBatch(ctx context.Context, bookings []*datamodel.Booking, users []string, saved map[string][]int, updated map[string]*datamodel.User, st *batchState) {
+	log := logging.Logger(ctx)
+
+	for _, userID := range users {
+		for _, i := range saved[userID] {
+			err := s.deleteBooking(ctx, bookings[i])
+			if err != nil {
+				log.Errorf("error rolling back booking '%s' : %v", bookings[i].ID, err)
+			}
+		}
+
+		user, ok := updated[userID]
+		if !ok {
+			continue
+		}
+
+		_, err := s.updateMembership(ctx, user, st.users[userID].Membership)
+		if err != nil {
+			log.Errorf("error restoring entitlement of user '%s' : %v", userID, err)
+		}
+	}
+}
+
+// failBatchItem reports the error of the item at index i
+func (s *Service) failBatchItem(resp *datamodel.BatchBookingResponse, i int, err error) {
+	resp.Results[i].Status = datamodel.BatchItemFailed
+	resp.Results[i].Error = err.Error()
+	resp.Failed++
+}
+
+// abortBatch reports the items that didn't fail as aborted, nothing is created
+func abortBatch(resp *datamodel.BatchBookingResponse) {
+	resp.Created = 0
+	for _, res := range resp.Results {
+		if res.Status != datamodel.BatchItemFailed {
+			res.Status = datamodel.BatchItemAborted
+			res.Booking = nil
+		}
+	}
+}
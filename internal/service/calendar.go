@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// ListAttendees returns the bookings of the class with the contact details of their users sorted by date and surname,
+// only the bookings of the day of date if it is set
+func (s *Service) ListAttendees(ctx context.Context, classID string, date *time.Time) ([]*datamodel.Attendee, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.attendees.class_id", classID)
+	log.SetTag("req.attendees.date", date)
+
+	class, err := s.db.GetClassByID(ctx, classID)
+	if err != nil {
+		log.Errorf("error getting class : %v", err)
+		return nil, err
+	}
+
+	err = s.authorize(ctx, policy.ActionListAttendees, &policy.Resource{Studio: class.Studio})
+	if err != nil {
+		return nil, err
+	}
+
+	bookings, err := s.db.ListBookingsByClass(ctx, class.ID)
+	if err != nil {
+		log.Errorf("error listing bookings : %v", err)
+		return nil, err
+	}
+
+	attendees := make([]*datamodel.Attendee, 0, len(bookings))
+	for _, b := range bookings {
+		if date != nil && !datamodel.Day(b.Date).Equal(datamodel.Day(*date)) {
+			continue
+		}
+
+		attendee := &datamodel.Attendee{
+			BookingID:   b.ID,
+			Date:        b.Date,
+			Status:      b.Status,
+			CheckedInAt: b.CheckedInAt,
+			UserID:      b.UserID,
+		}
+
+		user, err := s.db.GetUserByID(ctx, b.UserID)
+		if err != nil {
+			log.Warnf("error getting user '%s' of booking '%s' : %v", b.UserID, b.ID, err)
+		} else {
+			attendee.Name = user.Name
+			attendee.Surname = user.Surname
+			attendee.Email = user.Email
+			attendee.Phone = user.Phone
+		}
+
+		attendees = append(attendees, attendee)
+	}
+
+	sort.Slice(attendees, func(i, j int) bool {
+		if !attendees[i].Date.Equal(attendees[j].Date) {
+			return attendees[i].Date.Before(attendees[j].Date)
+		}
+		return attendees[i].Surname < attendees[j].Surname
+	})
+
+	log.Debugf("found %d attendees", len(attendees))
+
+	return attendees, nil
+}
+
+// ListUserSessions returns the active bookings of the user with their class sorted by date, used for the calendar of the user
+func (s *Service) ListUserSessions(ctx context.Context, userID string) ([]*datamodel.BookingFullInfo, error) {
+	log := logging.Logger(ctx)
+
+	bookings, err := s.ListUserBookings(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		log.Errorf("error getting user : %v", err)
+		return nil, err
+	}
+
+	classes := make(map[string]*datamodel.Class)
+	sessions := make([]*datamodel.BookingFullInfo, 0, len(bookings))
+	for _, b := range bookings {
+		if !b.IsActive() {
+			continue
+		}
+
+		class, ok := classes[b.ClassID]
+		if !ok {
+			class, err = s.db.GetClassByID(ctx, b.ClassID)
+			if err != nil {
+				log.Warnf("error getting class '%s' of booking '%s' : %v", b.ClassID, b.ID, err)
+				continue
+			}
+			classes[class.ID] = class
+		}
+
+		sessions = append(sessions, &datamodel.BookingFullInfo{Booking: *b, Class: class})
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,36 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/think-free/ABCFitness-challenge/internal/audit"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+)
+
+// PublishEvents publishes the events waiting in the outbox, it returns the number of events published
+func (s *Service) PublishEvents(ctx context.Context) (int, error) {
+	return s.relay.Flush(ctx)
+}
+
+// RunEventRelay publishes the events of the outbox as soon as they are saved and retries the failed ones every
+// interval until the context is done
+func (s *Service) RunEventRelay(ctx context.Context, interval time.Duration) {
+	s.relay.Run(ctx, interval)
+}
+
+// newEvent returns the event of a change of the entity, it is saved in the outbox with the change by the database and
+// the relay is notified once the change is done
+func (s *Service) newEvent(ctx context.Context, t datamodel.EventType, entityID string, entity interface{}) *datamodel.Event {
+	return &datamodel.Event{
+		ID:              uuid.NewString(),
+		Type:            t,
+		OccurredAt:      s.now(),
+		EntityID:        entityID,
+		Entity:          entity,
+		RequestID:       audit.RequestIDFromContext(ctx),
+		ClientRequestID: audit.ClientRequestIDFromContext(ctx),
+	}
+}
@@ -0,0 +1,144 @@
+package service
+
+import (
+	"context"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// ExportUser returns all the data kept about the user
+func (s *Service) ExportUser(ctx context.Context, id string) (*datamodel.UserExport, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.export.user_id", id)
+
+	user, err := s.authorizeUser(ctx, policy.ActionReadUser, id)
+	if err != nil {
+		return nil, err
+	}
+
+	attendance, err := s.GetAttendance(ctx, id)
+	if err != nil {
+		log.Errorf("error getting attendance : %v", err)
+		return nil, err
+	}
+
+	suspensions, err := s.db.ListSuspensionsByUser(ctx, id)
+	if err != nil {
+		log.Errorf("error listing suspensions : %v", err)
+		return nil, err
+	}
+
+	export := &datamodel.UserExport{
+		ExportedAt:  s.now(),
+		User:        user,
+		Attendance:  attendance,
+		Suspensions: suspensions,
+	}
+
+	s.record(ctx, datamodel.AuditActionExport, datamodel.AuditEntityUser, user.ID, nil, nil)
+
+	return export, nil
+}
+
+// EraseUser anonymizes the user, its bookings are kept for the statistics
+func (s *Service) EraseUser(ctx context.Context, id string) (*datamodel.User, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.erase.user_id", id)
+
+	err := s.authorize(ctx, policy.ActionEraseUser, &policy.Resource{UserID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	user, err := s.db.GetUserByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting user : %v", err)
+		return nil, err
+	}
+
+	err = datamodel.CheckVersion(ctx, user.Version)
+	if err != nil {
+		log.Errorf("user '%s' changed : %v", user.ID, err)
+		return nil, err
+	}
+
+	erased, err := user.Erase(s.now())
+	if err != nil {
+		log.Errorf("error erasing user : %v", err)
+		return nil, err
+	}
+
+	err = s.db.UpdateUser(ctx, erased, s.newEvent(ctx, datamodel.EventUserErased, erased.ID, erased))
+	if err != nil {
+		log.Errorf("error updating user : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionErase, datamodel.AuditEntityUser, user.ID, user.Redacted(), erased.Redacted())
+	s.relay.Notify()
+
+	err = s.scrubOutboxEvents(ctx, erased.ID)
+	if err != nil {
+		log.Errorf("error scrubbing outbox events of user '%s' : %v", erased.ID, err)
+		return nil, err
+	}
+
+	err = s.scrubWebhookDeliveries(ctx, erased.ID)
+	if err != nil {
+		log.Errorf("error scrubbing webhook deliveries of user '%s' : %v", erased.ID, err)
+		return nil, err
+	}
+
+	return erased, nil
+}
+
+// scrubOutboxEvents removes the personal data of the erased user from its events not published yet and from the ones
+// of the dead-letter list
+func (s *Service) scrubOutboxEvents(ctx context.Context, userID string) error {
+	return s.relay.Exclusive(func() error {
+		pending, err := s.db.ListOutboxEvents(ctx, 0)
+		if err != nil {
+			return err
+		}
+
+		err = scrubEvents(userID, pending, func(e *datamodel.Event) error { return s.db.UpdateOutboxEvent(ctx, e) })
+		if err != nil {
+			return err
+		}
+
+		dead, err := s.db.ListDeadOutboxEvents(ctx)
+		if err != nil {
+			return err
+		}
+
+		return scrubEvents(userID, dead, func(e *datamodel.Event) error { return s.db.UpdateDeadOutboxEvent(ctx, e) })
+	})
+}
+
+// scrubEvents saves the events of the user redacted with update
+func scrubEvents(userID string, events []*datamodel.Event, update func(e *datamodel.Event) error) error {
+	for _, e := range events {
+		if e.EntityID != userID || !e.HasUser() {
+			continue
+		}
+
+		redacted, err := e.Redacted()
+		if err != nil {
+			return err
+		}
+
+		err = update(redacted)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// ImportUsers creates the users of the rows that are valid and not already known, nothing is saved in dry-run mode
+func (s *Service) ImportUsers(ctx context.Context, rows []*datamodel.UserImportRow, dryRun bool) (*datamodel.ImportReport, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.import.rows", len(rows))
+	log.SetTag("req.import.dry_run", dryRun)
+
+	err := s.authorize(ctx, policy.ActionCreateUser, &policy.Resource{Studio: homeStudio(ctx, "")})
+	if err != nil {
+		return nil, err
+	}
+
+	report := &datamodel.ImportReport{DryRun: dryRun}
+	seen := make(map[string]int)
+	for _, row := range rows {
+		report.Add(s.importUser(ctx, row, dryRun, seen))
+	}
+
+	log.Infof("users import : %d created, %d duplicates, %d invalid", report.Created, report.Duplicates, report.Invalid)
+
+	return report, nil
+}
+
+// importUser imports a row, seen holds the line of the users already accepted in the same import
+func (s *Service) importUser(ctx context.Context, row *datamodel.UserImportRow, dryRun bool, seen map[string]int) *datamodel.ImportResult {
+	log := logging.Logger(ctx)
+
+	res := &datamodel.ImportResult{Line: row.Line, Status: datamodel.ImportStatusInvalid}
+	if row.Error != "" {
+		res.Error = row.Error
+		return res
+	}
+
+	req := *row.Request
+	req.Studio = homeStudio(ctx, row.Request.Studio)
+
+	err := s.authorize(ctx, policy.ActionCreateUser, &policy.Resource{Studio: req.Studio})
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	user, err := datamodel.NewUser(ctx, &req)
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+
+	key := user.Name + "\x00" + user.Surname + "\x00" + user.Email + "\x00" + user.Phone
+	if line, ok := seen[key]; ok {
+		res.Status = datamodel.ImportStatusDuplicate
+		res.Error = fmt.Sprintf("duplicate of line %d", line)
+		return res
+	}
+
+	if id, err := s.db.GetUserID(ctx, user); err == nil {
+		res.Status = datamodel.ImportStatusDuplicate
+		res.ID = id
+		return res
+	}
+
+	seen[key] = row.Line
+	res.Status = datamodel.ImportStatusCreated
+
+	if dryRun {
+		return res
+	}
+
+	err = s.db.SaveUser(ctx, user, s.newEvent(ctx, datamodel.EventUserCreated, user.ID, user))
+	if err != nil {
+		log.Errorf("error saving user of line %d : %v", row.Line, err)
+		if errors.IsAlreadyExists(err) {
+			res.Status = datamodel.ImportStatusDuplicate
+			res.ID, _ = s.db.GetUserID(ctx, user)
+			return res
+		}
+		res.Status = datamodel.ImportStatusInvalid
+		res.Error = err.Error()
+		return res
+	}
+
+	s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntityUser, user.ID, nil, user.Redacted())
+	s.relay.Notify()
+	res.ID = user.ID
+
+	return res
+}
+
+// ImportClasses creates the classes of the rows that are valid, not already known and whose room is free, nothing is
+// saved in dry-run mode. The rows of the studios the caller can't manage are invalid
+func (s *Service) ImportClasses(ctx context.Context, rows []*datamodel.ClassImportRow, dryRun bool) (*datamodel.ImportReport, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.import.rows", len(rows))
+	log.SetTag("req.import.dry_run", dryRun)
+
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	report := &datamodel.ImportReport{DryRun: dryRun}
+	seen := make(map[string]int)
+	var accepted []*importedClass
+	for _, row := range rows {
+		res, class := s.importClass(ctx, row, dryRun, seen, accepted)
+		if class != nil {
+			accepted = append(accepted, &importedClass{line: row.Line, class: class})
+		}
+		report.Add(res)
+	}
+
+	log.Infof("classes import : %d created, %d duplicates, %d invalid", report.Created, report.Duplicates, report.Invalid)
+
+	return report, nil
+}
+
+type importedClass struct {
+	line  int
+	class *datamodel.Class
+}
+
+// importClass imports a row and returns the accepted class, seen and accepted hold the classes already accepted in
+// the same import so the rows are checked against each other even in dry-run mode
+func (s *Service) importClass(ctx context.Context, row *datamodel.ClassImportRow, dryRun bool, seen map[string]int, accepted []*importedClass) (*datamodel.ImportResult, *datamodel.Class) {
+	log := logging.Logger(ctx)
+
+	res := &datamodel.ImportResult{Line: row.Line, Status: datamodel.ImportStatusInvalid}
+	if row.Error != "" {
+		res.Error = row.Error
+		return res, nil
+	}
+
+	err := s.authorize(ctx, policy.ActionManageClass, &policy.Resource{Studio: row.Request.Studio})
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+
+	class, err := datamodel.NewClass(ctx, row.Request)
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+
+	key := class.Studio + "\x00" + class.Name + "\x00" + strconv.FormatInt(class.StartDate.Unix(), 10)
+	if line, ok := seen[key]; ok {
+		res.Status = datamodel.ImportStatusDuplicate
+		res.Error = fmt.Sprintf("duplicate of line %d", line)
+		return res, nil
+	}
+
+	if id, err := s.db.GetClassID(ctx, class); err == nil {
+		res.Status = datamodel.ImportStatusDuplicate
+		res.ID = id
+		return res, nil
+	}
+
+	err = s.checkRoomAvailability(ctx, class)
+	if err != nil {
+		res.Error = err.Error()
+		return res, nil
+	}
+
+	if class.Room != "" {
+		for _, a := range accepted {
+			if a.class.Studio == class.Studio && a.class.Room == class.Room && a.class.Overlaps(class) {
+				res.Error = fmt.Sprintf("%s with line %d", errors.Conflict, a.line)
+				return res, nil
+			}
+		}
+	}
+
+	seen[key] = row.Line
+	res.Status = datamodel.ImportStatusCreated
+
+	if dryRun {
+		return res, class
+	}
+
+	err = s.db.SaveClass(ctx, class, s.newEvent(ctx, datamodel.EventClassCreated, class.ID, class))
+	if err != nil {
+		log.Errorf("error saving class of line %d : %v", row.Line, err)
+		res.Status = datamodel.ImportStatusInvalid
+		res.Error = err.Error()
+		return res, nil
+	}
+
+	s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntityClass, class.ID, nil, class)
+	s.relay.Notify()
+	res.ID = class.ID
+
+	return res, class
+}
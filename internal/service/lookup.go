@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"sort"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// The lookups read the entities of many ids at once for the callers resolving relationships, like the graphql api.
+// The ids that are unknown or that the principal is not allowed to read are skipped
+
+// GetUsers returns the users of the ids the principal of the context is allowed to read
+func (s *Service) GetUsers(ctx context.Context, ids []string) ([]*datamodel.User, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.lookup.users", len(ids))
+
+	users, err := s.db.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		log.Errorf("error getting users : %v", err)
+		return nil, err
+	}
+
+	return s.filterUsers(ctx, policy.ActionReadUser, users), nil
+}
+
+// GetClasses returns the classes of the ids
+func (s *Service) GetClasses(ctx context.Context, ids []string) ([]*datamodel.Class, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.lookup.classes", len(ids))
+
+	err := s.authorize(ctx, policy.ActionListClasses, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	classes, err := s.db.GetClassesByIDs(ctx, ids)
+	if err != nil {
+		log.Errorf("error getting classes : %v", err)
+		return nil, err
+	}
+
+	return classes, nil
+}
+
+// ListBookingsByUsers returns the bookings of the users the principal of the context is allowed to read sorted by date
+func (s *Service) ListBookingsByUsers(ctx context.Context, userIDs []string) ([]*datamodel.Booking, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.lookup.booking_users", len(userIDs))
+
+	bookings, err := s.db.ListBookingsByUsers(ctx, userIDs)
+	if err != nil {
+		log.Errorf("error listing bookings : %v", err)
+		return nil, err
+	}
+
+	return s.readableBookingsByDate(ctx, bookings)
+}
+
+// ListBookingsByClasses returns the bookings of the classes the principal of the context is allowed to read sorted by date
+func (s *Service) ListBookingsByClasses(ctx context.Context, classIDs []string) ([]*datamodel.Booking, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.lookup.booking_classes", len(classIDs))
+
+	bookings, err := s.db.ListBookingsByClasses(ctx, classIDs)
+	if err != nil {
+		log.Errorf("error listing bookings : %v", err)
+		return nil, err
+	}
+
+	return s.readableBookingsByDate(ctx, bookings)
+}
+
+func (s *Service) readableBookingsByDate(ctx context.Context, bookings []*datamodel.Booking) ([]*datamodel.Booking, error) {
+	bookings, err := s.filterReadableBookings(ctx, bookings)
+	if err != nil {
+		logging.Logger(ctx).Errorf("error filtering bookings : %v", err)
+		return nil, err
+	}
+
+	sort.SliceStable(bookings, func(i, j int) bool {
+		return bookings[i].Date.Before(bookings[j].Date)
+	})
+
+	return bookings, nil
+}
@@ -0,0 +1,94 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// GetCredits returns the remaining entitlement of the user for the month of the given date
+func (s *Service) GetCredits(ctx context.Context, userID string, date time.Time) (*datamodel.Credits, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.credits.user_id", userID)
+	log.SetTag("req.credits.date", date)
+
+	user, err := s.authorizeUser(ctx, policy.ActionReadUser, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credits := user.CreditsAt(date)
+
+	log.Debugf("user '%s' has %d credits left with plan '%s'", user.ID, credits.Remaining, credits.Plan)
+
+	return credits, nil
+}
+
+// SetMembership replaces the membership plan of the user, the usage of the previous plan is discarded
+func (s *Service) SetMembership(ctx context.Context, userID string, req *datamodel.Membership) (*datamodel.User, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.membership.user_id", userID)
+	log.SetTag("req.membership.plan", req.Plan)
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	user, err := s.authorizeUser(ctx, policy.ActionManageMembership, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	membership, err := datamodel.NewMembership(req)
+	if err != nil {
+		log.Errorf("error creating membership : %v", err)
+		return nil, err
+	}
+
+	err = datamodel.CheckVersion(ctx, user.Version)
+	if err != nil {
+		log.Errorf("user '%s' changed : %v", user.ID, err)
+		return nil, err
+	}
+
+	updated := *user
+	updated.Membership = membership
+
+	err = s.db.UpdateUser(ctx, &updated, s.newEvent(ctx, datamodel.EventMembershipChanged, updated.ID, &updated))
+	if err != nil {
+		log.Errorf("error updating user : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityUser, user.ID, user.Redacted(), updated.Redacted())
+	s.relay.Notify()
+
+	log.Debugf("user '%s' membership set to plan '%s'", user.ID, membership.GetPlan())
+
+	return &updated, nil
+}
+
+// updateMembership saves a copy of the user with the given membership and returns it, the stored user is never
+// modified in place
+func (s *Service) updateMembership(ctx context.Context, user *datamodel.User, membership *datamodel.Membership) (*datamodel.User, error) {
+	if membership.GetPlan() == datamodel.PlanUnlimited {
+		return user, nil
+	}
+
+	updated := *user
+	updated.Membership = membership
+
+	err := s.db.UpdateUser(ctx, &updated, s.newEvent(ctx, datamodel.EventMembershipChanged, updated.ID, &updated))
+	if err != nil {
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityUser, user.ID, user.Redacted(), updated.Redacted())
+	s.relay.Notify()
+
+	return &updated, nil
+}
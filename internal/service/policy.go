@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// authorize checks with the policy that the principal of the context can do the action on the resource
+func (s *Service) authorize(ctx context.Context, action policy.Action, res *policy.Resource) error {
+	log := logging.Logger(ctx)
+
+	p := auth.PrincipalFromContext(ctx)
+
+	err := s.policy.Authorize(ctx, p, action, res)
+	if err != nil {
+		log.Warnf("principal %+v is not allowed to do '%s' : %v", p, action, err)
+		return err
+	}
+
+	return nil
+}
+
+// authorizeFound checks the action on a resource that has been looked up, the principal that can't even read it gets a
+// not found error like for an unknown id so the denials don't tell which ids exist
+func (s *Service) authorizeFound(ctx context.Context, action, read policy.Action, res *policy.Resource) error {
+	err := s.authorize(ctx, action, res)
+	if err != nil && errors.IsForbidden(err) && s.policy.Authorize(ctx, auth.PrincipalFromContext(ctx), read, res) != nil {
+		return errors.ErrorNotFound()
+	}
+
+	return err
+}
+
+// authorizeUser looks up the user and checks the action on it, see authorizeFound
+func (s *Service) authorizeUser(ctx context.Context, action policy.Action, userID string) (*datamodel.User, error) {
+	user, err := s.db.GetUserByID(ctx, userID)
+	if err != nil {
+		logging.Logger(ctx).Errorf("error getting user : %v", err)
+		return nil, err
+	}
+
+	err = s.authorizeFound(ctx, action, policy.ActionReadUser, userResource(user))
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// userResource returns the resource of a user, owned by itself and its home studio
+func userResource(u *datamodel.User) *policy.Resource {
+	return &policy.Resource{UserID: u.ID, Studio: u.Studio}
+}
+
+// homeStudio returns the given studio, or the studio of the principal of the context if it is empty so the staff
+// create the members of their studio by default
+func homeStudio(ctx context.Context, studio string) string {
+	if p := auth.PrincipalFromContext(ctx); studio == "" && p != nil {
+		return p.Studio
+	}
+
+	return studio
+}
+
+// filterUsers returns the users the principal of the context is allowed to do the action on
+func (s *Service) filterUsers(ctx context.Context, action policy.Action, users []*datamodel.User) []*datamodel.User {
+	p := auth.PrincipalFromContext(ctx)
+	if p == nil || p.Role == policy.RoleAdmin {
+		return users
+	}
+
+	var allowed []*datamodel.User
+	for _, u := range users {
+		if s.policy.Authorize(ctx, p, action, userResource(u)) == nil {
+			allowed = append(allowed, u)
+		}
+	}
+
+	return allowed
+}
+
+// bookingResource returns the resource of a booking, owned by its user and the studio of its class
+func (s *Service) bookingResource(ctx context.Context, b *datamodel.Booking, classes map[string]*datamodel.Class) (*policy.Resource, error) {
+	class, ok := classes[b.ClassID]
+	if !ok {
+		var err error
+		class, err = s.db.GetClassByID(ctx, b.ClassID)
+		if err != nil {
+			return nil, err
+		}
+		classes[class.ID] = class
+	}
+
+	return &policy.Resource{UserID: b.UserID, Studio: class.Studio}, nil
+}
+
+// filterReadableBookings returns the bookings the principal of the context is allowed to read
+func (s *Service) filterReadableBookings(ctx context.Context, bookings []*datamodel.Booking) ([]*datamodel.Booking, error) {
+	p := auth.PrincipalFromContext(ctx)
+	if p == nil || p.Role == policy.RoleAdmin {
+		return bookings, nil
+	}
+
+	classes, err := s.classesOfBookings(ctx, bookings)
+	if err != nil {
+		return nil, err
+	}
+
+	var readable []*datamodel.Booking
+	for _, b := range bookings {
+		res, err := s.bookingResource(ctx, b, classes)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.policy.Authorize(ctx, p, policy.ActionReadBooking, res) == nil {
+			readable = append(readable, b)
+		}
+	}
+
+	return readable, nil
+}
+
+// classesOfBookings returns the classes of the bookings by id read in a single lookup
+func (s *Service) classesOfBookings(ctx context.Context, bookings []*datamodel.Booking) (map[string]*datamodel.Class, error) {
+	ids := make([]string, 0, len(bookings))
+	for _, b := range bookings {
+		ids = append(ids, b.ClassID)
+	}
+
+	found, err := s.db.GetClassesByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	classes := make(map[string]*datamodel.Class, len(found))
+	for _, c := range found {
+		classes[c.ID] = c
+	}
+
+	return classes, nil
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/internal/rules"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// SetStudioRules replaces the booking rules applied to the classes of the studio
+func (s *Service) SetStudioRules(ctx context.Context, studio string, req *datamodel.BookingRules) (*datamodel.StudioRules, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.rules.studio", studio)
+
+	err := s.authorize(ctx, policy.ActionManageClass, &policy.Resource{Studio: studio})
+	if err != nil {
+		return nil, err
+	}
+
+	sr, err := datamodel.NewStudioRules(ctx, studio, req)
+	if err != nil {
+		log.Errorf("error creating studio rules : %v", err)
+		return nil, err
+	}
+
+	before, err := s.db.GetStudioRules(ctx, studio)
+	if err != nil && !errors.IsNotFound(err) {
+		log.Errorf("error getting studio rules : %v", err)
+		return nil, err
+	}
+
+	err = s.db.SaveStudioRules(ctx, sr)
+	if err != nil {
+		log.Errorf("error saving studio rules : %v", err)
+		return nil, err
+	}
+
+	if before == nil {
+		s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntityStudioRules, sr.Studio, nil, sr)
+	} else {
+		s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityStudioRules, sr.Studio, before, sr)
+	}
+
+	log.Debugf("rules of studio '%s' saved", sr.Studio)
+
+	return sr, nil
+}
+
+// GetStudioRules returns the booking rules of the studio, a studio without rules has an empty set of rules
+func (s *Service) GetStudioRules(ctx context.Context, studio string) (*datamodel.StudioRules, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.rules.studio", studio)
+
+	err := s.authorize(ctx, policy.ActionListClasses, &policy.Resource{Studio: studio})
+	if err != nil {
+		return nil, err
+	}
+
+	sr, err := s.studioRules(ctx, studio)
+	if err != nil {
+		log.Errorf("error getting studio rules : %v", err)
+		return nil, err
+	}
+
+	return sr, nil
+}
+
+// studioRules returns the rules of the studio, an empty set of rules if none are configured
+func (s *Service) studioRules(ctx context.Context, studio string) (*datamodel.StudioRules, error) {
+	sr, err := s.db.GetStudioRules(ctx, studio)
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return &datamodel.StudioRules{Studio: studio}, nil
+		}
+		return nil, err
+	}
+
+	return sr, nil
+}
+
+// evaluateRules runs the custom rules of the service and the rules of the studio overridden by the ones of the class,
+// userBookings are the bookings the user already has
+func (s *Service) evaluateRules(ctx context.Context, booking *datamodel.Booking, class *datamodel.Class, userBookings []*datamodel.Booking) error {
+	sr, err := s.studioRules(ctx, class.Studio)
+	if err != nil {
+		return err
+	}
+
+	bc := &rules.BookingContext{
+		Now:          s.now(),
+		Booking:      booking,
+		Class:        class,
+		UserBookings: userBookings,
+	}
+
+	enabled := append(append([]rules.Rule{}, s.rules...), rules.FromConfig(sr.BookingRules.Merge(class.Rules))...)
+
+	return rules.Evaluate(ctx, bc, enabled...)
+}
+
+// cutOff returns how long before the start of its sessions the bookings of the class stop being taken, and so being
+// cancelled, with the rules of the studio overridden by the ones of the class
+func (s *Service) cutOff(ctx context.Context, class *datamodel.Class) (time.Duration, error) {
+	sr, err := s.studioRules(ctx, class.Studio)
+	if err != nil {
+		return 0, err
+	}
+
+	return time.Duration(sr.BookingRules.Merge(class.Rules).CutOffMinutes) * time.Minute, nil
+}
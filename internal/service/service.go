@@ -2,22 +2,139 @@ package service
 
 import (
 	"context"
+	"sort"
+	"sync"
+	"time"
 
+	"github.com/think-free/ABCFitness-challenge/internal/audit"
+	auditmemory "github.com/think-free/ABCFitness-challenge/internal/audit/memory"
 	"github.com/think-free/ABCFitness-challenge/internal/database"
 	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/events"
+	"github.com/think-free/ABCFitness-challenge/internal/events/inprocess"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/internal/rules"
+	"github.com/think-free/ABCFitness-challenge/internal/webhook"
 	"github.com/think-free/ABCFitness-challenge/lib/logging"
 )
 
 type Service struct {
-	db database.Database
+	db     database.Database
+	now    func() time.Time
+	rules  []rules.Rule
+	noShow *datamodel.NoShowPolicy
+	policy policy.Policy
+	audit  audit.Sink
+
+	publisher events.Publisher
+	relay     *events.Relay
+
+	webhookSender  *webhook.Sender
+	webhookPolicy  *webhook.RetryPolicy
+	webhookNotify  chan struct{}
+	webhookPrivate bool
+
+	// watchers are the availability streams by class
+	watchers   map[string]map[*availabilityWatcher]struct{}
+	watchersMu sync.Mutex
+
+	// roomsMu serializes the room availability check and the save of the classes
+	roomsMu sync.Mutex
+	// bookingsMu serializes the changes of the bookings and of the entitlements they consume
+	bookingsMu sync.Mutex
+	// webhooksMu serializes the passes of the webhook dispatcher, the creation of the deliveries and their scrub
+	webhooksMu sync.Mutex
 }
 
-func New(ctx context.Context, db database.Database) *Service {
-	return &Service{
-		db: db,
+// Option configures optional dependencies of the service
+type Option func(*Service)
+
+// WithClock replaces the clock used to evaluate the dates, used for tests
+func WithClock(now func() time.Time) Option {
+	return func(s *Service) {
+		s.now = now
+	}
+}
+
+// WithRules adds custom rules evaluated for every booking before the rules of the studio and the class
+func WithRules(r ...rules.Rule) Option {
+	return func(s *Service) {
+		s.rules = append(s.rules, r...)
+	}
+}
+
+// WithNoShowPolicy enables the suspension of the users missing too many sessions
+func WithNoShowPolicy(p *datamodel.NoShowPolicy) Option {
+	return func(s *Service) {
+		s.noShow = p
+	}
+}
+
+// WithPolicy replaces the default role based authorization policy
+func WithPolicy(p policy.Policy) Option {
+	return func(s *Service) {
+		s.policy = p
+	}
+}
+
+// WithAuditSink replaces the default memory sink where the changes are recorded
+func WithAuditSink(sink audit.Sink) Option {
+	return func(s *Service) {
+		s.audit = sink
+	}
+}
+
+// WithPublisher replaces the default in-process bus where the domain events are published
+func WithPublisher(p events.Publisher) Option {
+	return func(s *Service) {
+		s.publisher = p
+	}
+}
+
+// WithWebhookPolicy replaces the default retry policy of the webhook deliveries
+func WithWebhookPolicy(p *webhook.RetryPolicy) Option {
+	return func(s *Service) {
+		s.webhookPolicy = p
 	}
 }
 
+// WithPrivateWebhooks allows the webhooks on loopback and private addresses, only for the partners running on the
+// network of the server like in the tests or in local development
+func WithPrivateWebhooks() Option {
+	return func(s *Service) {
+		s.webhookPrivate = true
+	}
+}
+
+func New(ctx context.Context, db database.Database, opts ...Option) *Service {
+	s := &Service{
+		db:        db,
+		now:       time.Now,
+		policy:    policy.RoleBased{},
+		audit:     auditmemory.New(ctx),
+		publisher: inprocess.New(ctx),
+
+		webhookPolicy: webhook.DefaultRetryPolicy(),
+		webhookNotify: make(chan struct{}, 1),
+
+		watchers: make(map[string]map[*availabilityWatcher]struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	s.webhookSender = webhook.NewSender(webhookTimeout, s.webhookPrivate)
+	s.relay = events.NewRelay(db, events.Fanout(
+		s.publisher,
+		events.PublisherFunc(s.enqueueWebhooks),
+		events.PublisherFunc(s.publishAvailability),
+	))
+
+	return s
+}
+
 func (s *Service) CreateUser(ctx context.Context, r *datamodel.CreateUserRequest) (*datamodel.User, error) {
 	log := logging.Logger(ctx)
 
@@ -26,7 +143,17 @@ func (s *Service) CreateUser(ctx context.Context, r *datamodel.CreateUserRequest
 	log.SetTag("req.user.email", r.Email)
 	log.SetTag("req.user.phone", r.Phone)
 
-	user, err := datamodel.NewUser(ctx, r)
+	req := *r
+	req.Studio = homeStudio(ctx, r.Studio)
+
+	log.SetTag("req.user.studio", req.Studio)
+
+	err := s.authorize(ctx, policy.ActionCreateUser, &policy.Resource{Studio: req.Studio})
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := datamodel.NewUser(ctx, &req)
 	if err != nil {
 		log.Errorf("error creating user : %v", err)
 		return nil, err
@@ -38,7 +165,7 @@ func (s *Service) CreateUser(ctx context.Context, r *datamodel.CreateUserRequest
 	log.SetTag("user.email", user.Email)
 	log.SetTag("user.phone", user.Phone)
 
-	err = s.db.SaveUser(ctx, user)
+	err = s.db.SaveUser(ctx, user, s.newEvent(ctx, datamodel.EventUserCreated, user.ID, user))
 	if err != nil {
 		uid, errID := s.db.GetUserID(ctx, user)
 		if errID == nil {
@@ -49,23 +176,88 @@ func (s *Service) CreateUser(ctx context.Context, r *datamodel.CreateUserRequest
 		return nil, err
 	}
 
+	s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntityUser, user.ID, nil, user.Redacted())
+	s.relay.Notify()
+
 	log.Debugf("user '%s' created", user.ID)
 
 	return user, nil
 }
 
+func (s *Service) GetUser(ctx context.Context, id string) (*datamodel.User, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.user.id", id)
+
+	user, err := s.authorizeUser(ctx, policy.ActionReadUser, id)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debugf("user '%s' found", user.ID)
+
+	return user, nil
+}
+
+// UpdateUser changes the contact details of the user
+func (s *Service) UpdateUser(ctx context.Context, id string, r *datamodel.UpdateUserRequest) (*datamodel.User, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.user.id", id)
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	user, err := s.authorizeUser(ctx, policy.ActionUpdateUser, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = datamodel.CheckVersion(ctx, user.Version)
+	if err != nil {
+		log.Errorf("user '%s' changed : %v", user.ID, err)
+		return nil, err
+	}
+
+	updated, err := user.Update(r)
+	if err != nil {
+		log.Errorf("error updating user : %v", err)
+		return nil, err
+	}
+
+	err = s.db.UpdateUser(ctx, updated, s.newEvent(ctx, datamodel.EventUserUpdated, updated.ID, updated))
+	if err != nil {
+		log.Errorf("error saving user : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityUser, user.ID, user.Redacted(), updated.Redacted())
+	s.relay.Notify()
+
+	log.Debugf("user '%s' updated", user.ID)
+
+	return updated, nil
+}
+
 func (s *Service) ListUsers(ctx context.Context, r *datamodel.ListRequest) ([]*datamodel.User, error) {
 	log := logging.Logger(ctx)
 
 	log.SetTag("req.list.user.offset", r.Offset)
 	log.SetTag("req.list.user.count", r.Count)
 
+	err := s.authorize(ctx, policy.ActionListUsers, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	users, err := s.db.ListUsers(ctx, r.Offset, r.Count)
 	if err != nil {
 		log.Errorf("error listing users : %v", err)
 		return nil, err
 	}
 
+	users = s.filterUsers(ctx, policy.ActionReadUser, users)
+
 	if len(users) == 0 {
 		log.Warnf("no users found")
 		return nil, nil
@@ -80,11 +272,18 @@ func (s *Service) CreateClass(ctx context.Context, cl *datamodel.CreateClassRequ
 	log := logging.Logger(ctx)
 
 	log.SetTag("req.class.studio", cl.Studio)
+	log.SetTag("req.class.room", cl.Room)
 	log.SetTag("req.class.name", cl.Name)
 	log.SetTag("req.class.date.start", cl.StartDate)
 	log.SetTag("req.class.date.end", cl.EndDate)
+	log.SetTag("req.class.duration", cl.Duration)
 	log.SetTag("req.class.capacity", cl.DailyCapacity)
 
+	err := s.authorize(ctx, policy.ActionManageClass, &policy.Resource{Studio: cl.Studio})
+	if err != nil {
+		return nil, err
+	}
+
 	class, err := datamodel.NewClass(ctx, cl)
 	if err != nil {
 		log.Errorf("error creating class : %v", err)
@@ -94,11 +293,22 @@ func (s *Service) CreateClass(ctx context.Context, cl *datamodel.CreateClassRequ
 	log.SetTag("class.id", class.ID)
 	log.SetTag("class.name", class.Name)
 	log.SetTag("class.studio", class.Studio)
+	log.SetTag("class.room", class.Room)
 	log.SetTag("class.date.start", class.StartDate)
 	log.SetTag("class.date.end", class.EndDate)
+	log.SetTag("class.duration", class.Duration)
 	log.SetTag("class.capacity", class.DailyCapacity)
 
-	err = s.db.SaveClass(ctx, class)
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	err = s.checkRoomAvailability(ctx, class)
+	if err != nil {
+		log.Errorf("error reserving room : %v", err)
+		return nil, err
+	}
+
+	err = s.db.SaveClass(ctx, class, s.newEvent(ctx, datamodel.EventClassCreated, class.ID, class))
 	if err != nil {
 		cid, errID := s.db.GetClassID(ctx, class)
 		if errID == nil {
@@ -109,17 +319,124 @@ func (s *Service) CreateClass(ctx context.Context, cl *datamodel.CreateClassRequ
 		return nil, err
 	}
 
+	s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntityClass, class.ID, nil, class)
+	s.relay.Notify()
+
 	log.Debugf("class '%s' created", class.ID)
 
 	return class, nil
 }
 
+// GetClass returns the class with the given id
+func (s *Service) GetClass(ctx context.Context, id string) (*datamodel.Class, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.class.id", id)
+
+	err := s.authorize(ctx, policy.ActionListClasses, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	class, err := s.db.GetClassByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting class : %v", err)
+		return nil, err
+	}
+
+	return class, nil
+}
+
+// UpdateClass changes the name, room, capacity or rules of the class, a new room must be free for all its sessions
+func (s *Service) UpdateClass(ctx context.Context, id string, r *datamodel.UpdateClassRequest) (*datamodel.Class, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.class.id", id)
+
+	s.roomsMu.Lock()
+	defer s.roomsMu.Unlock()
+
+	class, err := s.db.GetClassByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting class : %v", err)
+		return nil, err
+	}
+
+	err = s.authorize(ctx, policy.ActionManageClass, &policy.Resource{Studio: class.Studio})
+	if err != nil {
+		return nil, err
+	}
+
+	err = datamodel.CheckVersion(ctx, class.Version)
+	if err != nil {
+		log.Errorf("class '%s' changed : %v", class.ID, err)
+		return nil, err
+	}
+
+	updated, err := class.Update(r)
+	if err != nil {
+		log.Errorf("error updating class : %v", err)
+		return nil, err
+	}
+
+	if updated.Room != class.Room {
+		err = s.checkRoomAvailability(ctx, updated)
+		if err != nil {
+			log.Errorf("error reserving room : %v", err)
+			return nil, err
+		}
+	}
+
+	err = s.db.UpdateClass(ctx, updated, s.newEvent(ctx, datamodel.EventClassUpdated, updated.ID, updated))
+	if err != nil {
+		log.Errorf("error saving class : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityClass, class.ID, class, updated)
+	s.relay.Notify()
+
+	log.Debugf("class '%s' updated", class.ID)
+
+	return updated, nil
+}
+
+// checkRoomAvailability returns a conflict error listing the classes of the same room whose sessions overlap the given class
+func (s *Service) checkRoomAvailability(ctx context.Context, class *datamodel.Class) error {
+	if class.Room == "" {
+		return nil
+	}
+
+	classes, err := s.db.ListClassesByRoom(ctx, class.Studio, class.Room)
+	if err != nil {
+		return err
+	}
+
+	var clashing []string
+	for _, c := range classes {
+		if c.ID != class.ID && c.Overlaps(class) {
+			clashing = append(clashing, c.ID)
+		}
+	}
+
+	if len(clashing) > 0 {
+		return errors.ErrorConflict(clashing...)
+	}
+
+	return nil
+}
+
 func (s *Service) ListClasses(ctx context.Context, r *datamodel.ListRequest) ([]*datamodel.Class, error) {
 	log := logging.Logger(ctx)
 
 	log.SetTag("req.list.classes.offset", r.Offset)
 	log.SetTag("req.list.classes.count", r.Count)
 
+	err := s.authorize(ctx, policy.ActionListClasses, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	classes, err := s.db.ListClasses(ctx, r.Offset, r.Count)
 	if err != nil {
 		log.Errorf("error listing classes : %v", err)
@@ -154,7 +471,58 @@ func (s *Service) CreateBooking(ctx context.Context, req *datamodel.CreateBookin
 	log.SetTag("booking.class_id", booking.ClassID)
 	log.SetTag("booking.date", booking.Date)
 
-	err = s.db.SaveBooking(ctx, booking)
+	class, err := s.db.GetClassByID(ctx, booking.ClassID)
+	if err != nil {
+		log.Errorf("error getting class : %v", err)
+		return nil, err
+	}
+
+	err = s.authorize(ctx, policy.ActionCreateBooking, &policy.Resource{UserID: booking.UserID, Studio: class.Studio})
+	if err != nil {
+		return nil, err
+	}
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	user, err := s.db.GetUserByID(ctx, booking.UserID)
+	if err != nil {
+		log.Errorf("error getting user : %v", err)
+		return nil, err
+	}
+
+	err = s.checkSuspension(ctx, user.ID)
+	if err != nil {
+		log.Errorf("booking rejected : %v", err)
+		return nil, err
+	}
+
+	userBookings, err := s.db.ListBookingsByUser(ctx, user.ID)
+	if err != nil {
+		log.Errorf("error listing bookings : %v", err)
+		return nil, err
+	}
+
+	err = s.evaluateRules(ctx, booking, class, userBookings)
+	if err != nil {
+		log.Errorf("booking rejected : %v", err)
+		return nil, err
+	}
+
+	err = s.checkCapacity(ctx, class, booking.Date, 0)
+	if err != nil {
+		log.Errorf("booking rejected : %v", err)
+		return nil, err
+	}
+
+	membership := user.Membership.Copy()
+	booking.Consumed, err = membership.Consume(booking.Date)
+	if err != nil {
+		log.Errorf("error consuming entitlement of plan '%s' : %v", membership.GetPlan(), err)
+		return nil, err
+	}
+
+	err = s.db.SaveBooking(ctx, booking, s.newEvent(ctx, datamodel.EventBookingCreated, booking.ID, booking))
 	if err != nil {
 		bid, errID := s.db.GetBookingID(ctx, booking)
 		if errID == nil {
@@ -165,10 +533,149 @@ func (s *Service) CreateBooking(ctx context.Context, req *datamodel.CreateBookin
 		return nil, err
 	}
 
+	_, err = s.updateMembership(ctx, user, membership)
+	if err != nil {
+		log.Errorf("error updating entitlement : %v", err)
+		if errDel := s.deleteBooking(ctx, booking); errDel != nil {
+			log.Errorf("error rolling back booking : %v", errDel)
+		}
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntityBooking, booking.ID, nil, booking)
+	s.relay.Notify()
+
 	log.Debugf("booking '%s' created", booking.ID)
 	return booking, nil
 }
 
+// deleteBooking rolls back a booking saved by a change failing after it, its creation may be published already so its
+// deletion is published as its cancellation
+func (s *Service) deleteBooking(ctx context.Context, booking *datamodel.Booking) error {
+	cancelled := booking.Revoke(s.now())
+
+	err := s.db.DeleteBooking(ctx, booking.ID, s.newEvent(ctx, datamodel.EventBookingCancelled, booking.ID, cancelled))
+	if err != nil {
+		return err
+	}
+
+	s.relay.Notify()
+	return nil
+}
+
+// checkCapacity returns a class full error if the session of the day has no spot left, pending is the number of spots
+// taken by bookings not saved yet
+func (s *Service) checkCapacity(ctx context.Context, class *datamodel.Class, date time.Time, pending int) error {
+	booked, err := s.db.CountBookingsByClassAndDate(ctx, class.ID, date)
+	if err != nil {
+		return err
+	}
+
+	if booked+pending >= class.DailyCapacity {
+		return errors.ErrorClassFull()
+	}
+
+	return nil
+}
+
+// CancelBooking cancels the booking and refunds the credit it consumed to the user
+func (s *Service) CancelBooking(ctx context.Context, id string) (*datamodel.Booking, error) {
+	return s.cancelBooking(ctx, id, "")
+}
+
+// CancelUserBooking cancels the booking only if it belongs to the user, the bookings of the other users are not found
+func (s *Service) CancelUserBooking(ctx context.Context, userID, id string) (*datamodel.Booking, error) {
+	return s.cancelBooking(ctx, id, userID)
+}
+
+func (s *Service) cancelBooking(ctx context.Context, id, owner string) (*datamodel.Booking, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.booking.id", id)
+	log.SetTag("req.booking.owner", owner)
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	booking, err := s.db.GetBookingByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting booking : %v", err)
+		return nil, err
+	}
+
+	if owner != "" && booking.UserID != owner {
+		log.Errorf("booking '%s' doesn't belong to user '%s'", booking.ID, owner)
+		return nil, errors.ErrorNotFound()
+	}
+
+	log.SetTag("booking.id", booking.ID)
+	log.SetTag("booking.user_id", booking.UserID)
+	log.SetTag("booking.class_id", booking.ClassID)
+	log.SetTag("booking.date", booking.Date)
+
+	classes := make(map[string]*datamodel.Class)
+	res, err := s.bookingResource(ctx, booking, classes)
+	if err != nil {
+		log.Errorf("error getting class : %v", err)
+		return nil, err
+	}
+
+	err = s.authorizeFound(ctx, policy.ActionCancelBooking, policy.ActionReadBooking, res)
+	if err != nil {
+		return nil, err
+	}
+
+	err = datamodel.CheckVersion(ctx, booking.Version)
+	if err != nil {
+		log.Errorf("booking '%s' changed : %v", booking.ID, err)
+		return nil, err
+	}
+
+	class := classes[booking.ClassID]
+	cutOff, err := s.cutOff(ctx, class)
+	if err != nil {
+		log.Errorf("error getting rules of studio '%s' : %v", class.Studio, err)
+		return nil, err
+	}
+
+	cancelled, err := booking.Cancel(class, cutOff, s.now())
+	if err != nil {
+		log.Errorf("error cancelling booking with status '%s' of session starting at %s : %v", booking.Status, class.SessionStart(booking.Date), err)
+		return nil, err
+	}
+
+	err = s.db.UpdateBooking(ctx, cancelled, s.newEvent(ctx, datamodel.EventBookingCancelled, cancelled.ID, cancelled))
+	if err != nil {
+		log.Errorf("error updating booking : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityBooking, booking.ID, booking, cancelled)
+	s.relay.Notify()
+
+	user, err := s.db.GetUserByID(ctx, booking.UserID)
+	if err != nil {
+		// The booking is cancelled anyway, there is nobody to refund
+		log.Warnf("booking cancelled without refund, error getting user : %v", err)
+		return cancelled, nil
+	}
+
+	membership := user.Membership.Copy()
+	if !membership.Refund(booking.Consumed) {
+		log.Debugf("booking '%s' cancelled without refund to plan '%s'", booking.ID, membership.GetPlan())
+		return cancelled, nil
+	}
+
+	_, err = s.updateMembership(ctx, user, membership)
+	if err != nil {
+		log.Errorf("error refunding entitlement : %v", err)
+		return nil, err
+	}
+
+	log.Debugf("booking '%s' cancelled", booking.ID)
+	return cancelled, nil
+}
+
 func (s *Service) GetBooking(ctx context.Context, id string) (*datamodel.BookingFullInfo, error) {
 	log := logging.Logger(ctx)
 
@@ -198,6 +705,11 @@ func (s *Service) GetBooking(ctx context.Context, id string) (*datamodel.Booking
 	log.SetTag("booking.class.date.end", class.EndDate)
 	log.SetTag("booking.class.capacity", class.DailyCapacity)
 
+	err = s.authorizeFound(ctx, policy.ActionReadBooking, policy.ActionReadBooking, &policy.Resource{UserID: booking.UserID, Studio: class.Studio})
+	if err != nil {
+		return nil, err
+	}
+
 	user, err := s.db.GetUserByID(ctx, booking.UserID)
 	if err != nil {
 		log.Errorf("error getting user : %v", err)
@@ -233,6 +745,12 @@ func (s *Service) ListBookings(ctx context.Context, r *datamodel.ListRequest) ([
 		return nil, err
 	}
 
+	bookings, err = s.filterReadableBookings(ctx, bookings)
+	if err != nil {
+		log.Errorf("error filtering bookings : %v", err)
+		return nil, err
+	}
+
 	if len(bookings) == 0 {
 		log.Warnf("no bookings found")
 		return nil, nil
@@ -242,3 +760,29 @@ func (s *Service) ListBookings(ctx context.Context, r *datamodel.ListRequest) ([
 
 	return bookings, nil
 }
+
+// ListUserBookings returns the bookings of the user sorted by date
+func (s *Service) ListUserBookings(ctx context.Context, userID string) ([]*datamodel.Booking, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.list.booking.user_id", userID)
+
+	_, err := s.authorizeUser(ctx, policy.ActionReadUser, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	bookings, err := s.db.ListBookingsByUser(ctx, userID)
+	if err != nil {
+		log.Errorf("error listing bookings : %v", err)
+		return nil, err
+	}
+
+	sort.Slice(bookings, func(i, j int) bool {
+		return bookings[i].Date.Before(bookings[j].Date)
+	})
+
+	log.Debugf("found %d bookings", len(bookings))
+
+	return bookings, nil
+}
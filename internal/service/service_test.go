@@ -1,5 +1,325 @@
 package service_test
 
-/* Tests are not implemented yet */
-/* Test coverage is done in the api_test.go file */
-/* TODO : implement tests */
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/think-free/ABCFitness-challenge/internal/cliparams"
+	"github.com/think-free/ABCFitness-challenge/internal/database"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/service"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+/* Test coverage of the business cases is done in the api_test.go file */
+
+// TestNoPIIInLogs checks that the personal data of the users never reach the log output with the default configuration
+func TestNoPIIInLogs(t *testing.T) {
+	ctx := context.Background()
+
+	var out bytes.Buffer
+	encoder := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	previous := logging.UseLogger(zap.New(zapcore.NewCore(encoder, zapcore.AddSync(&out), zapcore.DebugLevel)))
+	t.Cleanup(func() { logging.UseLogger(previous) })
+
+	db := database.New(ctx, cliparams.New())
+	srv := service.New(ctx, db)
+
+	req := &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{
+			Name:    "Elon",
+			Surname: "Musk",
+			Email:   "elon.musk@example.com",
+			Phone:   "+34123456789",
+		},
+	}
+
+	user, err := srv.CreateUser(logging.ContextWithLogger(ctx), req)
+	require.NoError(t, err)
+
+	// Creating the same user again logs the error with the tags of the request
+	_, err = srv.CreateUser(logging.ContextWithLogger(ctx), req)
+	require.Error(t, err)
+
+	start, end := mustDate(t, "2023-10-01T18:00:00Z"), mustDate(t, "2023-10-15T00:00:00Z")
+	class, err := srv.CreateClass(ctx, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{Studio: "Studio 1", Name: "Yoga", StartDate: &start, EndDate: &end, DailyCapacity: 10},
+	})
+	require.NoError(t, err)
+
+	booking, err := srv.CreateBooking(ctx, &datamodel.CreateBookingRequest{
+		BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: mustDate(t, "2023-10-10T00:00:00Z")},
+	})
+	require.NoError(t, err)
+
+	_, err = srv.GetBooking(logging.ContextWithLogger(ctx), booking.ID)
+	require.NoError(t, err)
+
+	logs := out.String()
+	require.Contains(t, logs, user.ID)
+	require.Contains(t, logs, logging.Redacted)
+	for _, v := range []string{req.Email, req.Phone, req.Surname} {
+		require.NotContains(t, logs, v)
+	}
+}
+
+func mustDate(t *testing.T, s string) time.Time {
+	d, err := time.Parse(time.RFC3339, s)
+	require.NoError(t, err)
+	return d
+}
+
+// broker is a publisher recording the events, failing while down is set
+type broker struct {
+	down   bool
+	events []*datamodel.Event
+}
+
+func (b *broker) Publish(ctx context.Context, e *datamodel.Event) error {
+	if b.down {
+		return errors.New("broker down")
+	}
+	b.events = append(b.events, e)
+	return nil
+}
+
+// TestEvents checks that the changes publish their events and that they are kept until the publisher is available
+func TestEvents(t *testing.T) {
+	ctx := context.Background()
+
+	pub := &broker{down: true}
+	db := database.New(ctx, cliparams.New())
+	now := mustDate(t, "2023-10-05T12:00:00Z")
+	srv := service.New(ctx, db, service.WithPublisher(pub), service.WithClock(func() time.Time { return now }))
+
+	user, err := srv.CreateUser(ctx, &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"},
+	})
+	require.NoError(t, err)
+
+	start, end := mustDate(t, "2023-10-01T18:00:00Z"), mustDate(t, "2023-10-15T00:00:00Z")
+	class, err := srv.CreateClass(ctx, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{Studio: "Studio 1", Name: "Yoga", StartDate: &start, EndDate: &end, DailyCapacity: 10},
+	})
+	require.NoError(t, err)
+
+	booking, err := srv.CreateBooking(ctx, &datamodel.CreateBookingRequest{
+		BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: mustDate(t, "2023-10-10T00:00:00Z")},
+	})
+	require.NoError(t, err)
+
+	_, err = srv.CancelBooking(ctx, booking.ID)
+	require.NoError(t, err)
+
+	// The changes are saved even if the events can't be published
+	_, err = srv.PublishEvents(ctx)
+	require.Error(t, err)
+	require.Empty(t, pub.events)
+
+	pub.down = false
+	n, err := srv.PublishEvents(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 4, n)
+
+	types := make([]datamodel.EventType, 0, len(pub.events))
+	for _, e := range pub.events {
+		types = append(types, e.Type)
+	}
+	require.Equal(t, []datamodel.EventType{
+		datamodel.EventUserCreated,
+		datamodel.EventClassCreated,
+		datamodel.EventBookingCreated,
+		datamodel.EventBookingCancelled,
+	}, types)
+
+	var cancelled datamodel.Booking
+	require.NoError(t, pub.events[3].Decode(&cancelled))
+	require.Equal(t, booking.ID, cancelled.ID)
+	require.Equal(t, datamodel.BookingStatusCancelled, cancelled.Status)
+	// The events are saved with the changes, they have the version given by the database
+	require.Equal(t, 2, cancelled.Version)
+
+	n, err = srv.PublishEvents(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+// TestWatchAvailability checks that a slow watcher only gets the latest availability and that it is released with its context
+// TestEraseEvents checks that the erasure removes the personal data from the events not published yet and from the
+// dead-letter list
+func TestEraseEvents(t *testing.T) {
+	ctx := context.Background()
+
+	pub := &broker{down: true}
+	db := database.New(ctx, cliparams.New())
+	srv := service.New(ctx, db, service.WithPublisher(pub))
+
+	user, err := srv.CreateUser(ctx, &datamodel.CreateUserRequest{
+		BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: "john.doe@example.com", Phone: "+34123456789"},
+	})
+	require.NoError(t, err)
+
+	// The creation fails all its attempts and goes to the dead-letter list, the update stays in the outbox
+	for {
+		dead, err := db.ListDeadOutboxEvents(ctx)
+		require.NoError(t, err)
+		if len(dead) > 0 {
+			break
+		}
+		_, err = srv.PublishEvents(ctx)
+		require.Error(t, err)
+	}
+
+	email := "johnny.doe@example.com"
+	_, err = srv.UpdateUser(ctx, user.ID, &datamodel.UpdateUserRequest{Email: &email})
+	require.NoError(t, err)
+
+	_, err = srv.EraseUser(ctx, user.ID)
+	require.NoError(t, err)
+
+	dead, err := db.ListDeadOutboxEvents(ctx)
+	require.NoError(t, err)
+	pending, err := db.ListOutboxEvents(ctx, 0)
+	require.NoError(t, err)
+	require.Len(t, dead, 1)
+	require.Len(t, pending, 2)
+
+	for _, e := range append(dead, pending...) {
+		for _, pii := range []string{user.Name, user.Surname, user.Email, user.Phone, email} {
+			require.NotContains(t, string(e.Data), pii)
+		}
+	}
+
+	// The redacted events are still published
+	pub.down = false
+	n, err := srv.PublishEvents(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+}
+
+func TestWatchAvailability(t *testing.T) {
+	ctx := context.Background()
+
+	db := database.New(ctx, cliparams.New())
+	srv := service.New(ctx, db)
+
+	start, end := mustDate(t, "2023-10-01T18:00:00Z"), mustDate(t, "2023-10-15T00:00:00Z")
+	class, err := srv.CreateClass(ctx, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{Studio: "Studio 1", Name: "Yoga", StartDate: &start, EndDate: &end, DailyCapacity: 10},
+	})
+	require.NoError(t, err)
+
+	watchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Only the days with a session can be watched
+	day := mustDate(t, "2023-10-10T00:00:00Z")
+	after := end.AddDate(0, 0, 1)
+	_, err = srv.WatchAvailability(watchCtx, class.ID, &after)
+	require.Error(t, err)
+
+	updates, err := srv.WatchAvailability(watchCtx, class.ID, &day)
+	require.NoError(t, err)
+
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		user, err := srv.CreateUser(ctx, &datamodel.CreateUserRequest{
+			BaseUser: datamodel.BaseUser{Name: "John", Surname: "Doe", Email: email, Phone: "+34123456789"},
+		})
+		require.NoError(t, err)
+
+		_, err = srv.CreateBooking(ctx, &datamodel.CreateBookingRequest{
+			BaseBooking: datamodel.BaseBooking{UserID: user.ID, ClassID: class.ID, Date: day},
+		})
+		require.NoError(t, err)
+
+		_, err = srv.PublishEvents(ctx)
+		require.NoError(t, err)
+	}
+
+	// The updates not read were replaced by the latest one
+	a := <-updates
+	require.Equal(t, 3, a.Booked)
+	require.Equal(t, 7, a.Remaining)
+	require.Empty(t, updates)
+
+	cancel()
+	require.Eventually(t, func() bool {
+		select {
+		case _, ok := <-updates:
+			return !ok
+		default:
+			return false
+		}
+	}, time.Second, 10*time.Millisecond)
+}
+
+// failingUsers is a database failing the updates of some users
+type failingUsers struct {
+	database.Database
+	fail map[string]bool
+}
+
+func (db *failingUsers) UpdateUser(ctx context.Context, u *datamodel.User, events ...*datamodel.Event) error {
+	if db.fail[u.ID] {
+		return errors.New("database down")
+	}
+	return db.Database.UpdateUser(ctx, u, events...)
+}
+
+// TestBatchRollback checks that an atomic batch failing while it is saved gives back the entitlements it consumed
+func TestBatchRollback(t *testing.T) {
+	ctx := context.Background()
+
+	db := &failingUsers{Database: database.New(ctx, cliparams.New()), fail: make(map[string]bool)}
+	srv := service.New(ctx, db)
+
+	var users []*datamodel.User
+	for _, email := range []string{"john.doe@example.com", "jane.doe@example.com"} {
+		user, err := srv.CreateUser(ctx, &datamodel.CreateUserRequest{
+			BaseUser: datamodel.BaseUser{Name: "Doe", Surname: email, Email: email, Phone: "+34123456789"},
+		})
+		require.NoError(t, err)
+		_, err = srv.SetMembership(ctx, user.ID, &datamodel.Membership{Plan: datamodel.PlanPack, Credits: 5})
+		require.NoError(t, err)
+		users = append(users, user)
+	}
+
+	start, end := mustDate(t, "2023-10-01T18:00:00Z"), mustDate(t, "2023-10-15T00:00:00Z")
+	class, err := srv.CreateClass(ctx, &datamodel.CreateClassRequest{
+		BaseClass: datamodel.BaseClass{Studio: "Studio 1", Name: "Yoga", StartDate: &start, EndDate: &end, DailyCapacity: 10},
+	})
+	require.NoError(t, err)
+
+	// The entitlement of the first user is saved before the one of the second fails
+	db.fail[users[1].ID] = true
+
+	resp, err := srv.CreateBookings(ctx, &datamodel.CreateBatchBookingRequest{
+		Mode: datamodel.BatchModeAtomic,
+		Bookings: []*datamodel.CreateBookingRequest{
+			{BaseBooking: datamodel.BaseBooking{UserID: users[0].ID, ClassID: class.ID, Date: mustDate(t, "2023-10-10T00:00:00Z")}},
+			{BaseBooking: datamodel.BaseBooking{UserID: users[0].ID, ClassID: class.ID, Date: mustDate(t, "2023-10-11T00:00:00Z")}},
+			{BaseBooking: datamodel.BaseBooking{UserID: users[1].ID, ClassID: class.ID, Date: mustDate(t, "2023-10-10T00:00:00Z")}},
+		},
+	})
+	require.NoError(t, err)
+	require.Zero(t, resp.Created)
+	require.Equal(t, datamodel.BatchItemAborted, resp.Results[0].Status)
+	require.Equal(t, datamodel.BatchItemFailed, resp.Results[2].Status)
+
+	bookings, err := db.ListBookings(ctx, 0, 0)
+	require.NoError(t, err)
+	require.Empty(t, bookings)
+
+	for _, user := range users {
+		credits, err := srv.GetCredits(ctx, user.ID, mustDate(t, "2023-10-10T00:00:00Z"))
+		require.NoError(t, err)
+		require.Equal(t, 5, credits.Remaining)
+	}
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/auth"
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+// ListSuspensions returns the suspensions of all the users the principal manages, only the ones active now if
+// activeOnly is set
+func (s *Service) ListSuspensions(ctx context.Context, r *datamodel.ListRequest, activeOnly bool) ([]*datamodel.Suspension, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.list.suspensions.offset", r.Offset)
+	log.SetTag("req.list.suspensions.count", r.Count)
+	log.SetTag("req.list.suspensions.active", activeOnly)
+
+	err := s.authorize(ctx, policy.ActionManageSuspensions, &policy.Resource{Studio: homeStudio(ctx, "")})
+	if err != nil {
+		return nil, err
+	}
+
+	suspensions, err := s.db.ListSuspensions(ctx, r.Offset, r.Count)
+	if err != nil {
+		log.Errorf("error listing suspensions : %v", err)
+		return nil, err
+	}
+
+	suspensions, err = s.filterManagedSuspensions(ctx, suspensions)
+	if err != nil {
+		log.Errorf("error filtering suspensions : %v", err)
+		return nil, err
+	}
+
+	if activeOnly {
+		suspensions = filterActive(suspensions, s.now())
+	}
+
+	if len(suspensions) == 0 {
+		log.Warnf("no suspensions found")
+		return nil, nil
+	}
+
+	log.Debugf("found %d suspensions", len(suspensions))
+
+	return suspensions, nil
+}
+
+// ListUserSuspensions returns all the suspensions of the user
+func (s *Service) ListUserSuspensions(ctx context.Context, userID string) ([]*datamodel.Suspension, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.suspensions.user_id", userID)
+
+	_, err := s.authorizeUser(ctx, policy.ActionReadUser, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	suspensions, err := s.db.ListSuspensionsByUser(ctx, userID)
+	if err != nil {
+		log.Errorf("error listing suspensions : %v", err)
+		return nil, err
+	}
+
+	log.Debugf("found %d suspensions", len(suspensions))
+
+	return suspensions, nil
+}
+
+// LiftSuspension ends an active suspension before its term
+func (s *Service) LiftSuspension(ctx context.Context, id string) (*datamodel.Suspension, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.suspension.id", id)
+
+	s.bookingsMu.Lock()
+	defer s.bookingsMu.Unlock()
+
+	suspension, err := s.db.GetSuspensionByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting suspension : %v", err)
+		return nil, err
+	}
+
+	_, err = s.authorizeUser(ctx, policy.ActionManageSuspensions, suspension.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	lifted, err := suspension.Lift(s.now())
+	if err != nil {
+		log.Errorf("error lifting suspension : %v", err)
+		return nil, err
+	}
+
+	err = s.db.UpdateSuspension(ctx, lifted, s.newEvent(ctx, datamodel.EventSuspensionLifted, lifted.ID, lifted))
+	if err != nil {
+		log.Errorf("error updating suspension : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntitySuspension, lifted.ID, suspension, lifted)
+	s.relay.Notify()
+
+	log.Debugf("suspension '%s' of user '%s' lifted", lifted.ID, lifted.UserID)
+
+	return lifted, nil
+}
+
+// filterManagedSuspensions returns the suspensions of the users the principal of the context manages, their users are
+// read in a single lookup
+func (s *Service) filterManagedSuspensions(ctx context.Context, suspensions []*datamodel.Suspension) ([]*datamodel.Suspension, error) {
+	p := auth.PrincipalFromContext(ctx)
+	if p == nil || p.Role == policy.RoleAdmin {
+		return suspensions, nil
+	}
+
+	ids := make([]string, 0, len(suspensions))
+	for _, suspension := range suspensions {
+		ids = append(ids, suspension.UserID)
+	}
+
+	users, err := s.db.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	managed := make(map[string]bool, len(users))
+	for _, u := range s.filterUsers(ctx, policy.ActionManageSuspensions, users) {
+		managed[u.ID] = true
+	}
+
+	var filtered []*datamodel.Suspension
+	for _, suspension := range suspensions {
+		if managed[suspension.UserID] {
+			filtered = append(filtered, suspension)
+		}
+	}
+
+	return filtered, nil
+}
+
+// checkSuspension returns a suspended error if the user has an active suspension
+func (s *Service) checkSuspension(ctx context.Context, userID string) error {
+	suspensions, err := s.db.ListSuspensionsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	active := filterActive(suspensions, s.now())
+	if len(active) > 0 {
+		return errors.ErrorSuspended(active[0].Until)
+	}
+
+	return nil
+}
+
+// applyNoShowPolicy suspends the user if its no-shows reach the limit of the policy
+func (s *Service) applyNoShowPolicy(ctx context.Context, userID string) error {
+	log := logging.Logger(ctx)
+
+	if !s.noShow.Enabled() {
+		return nil
+	}
+
+	bookings, err := s.db.ListBookingsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	suspensions, err := s.db.ListSuspensionsByUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	var last *datamodel.Suspension
+	if len(suspensions) > 0 {
+		last = suspensions[len(suspensions)-1]
+	}
+
+	suspension := s.noShow.Evaluate(ctx, userID, s.now(), bookings, last)
+	if suspension == nil {
+		return nil
+	}
+
+	err = s.db.SaveSuspension(ctx, suspension, s.newEvent(ctx, datamodel.EventUserSuspended, suspension.ID, suspension))
+	if err != nil {
+		return err
+	}
+
+	s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntitySuspension, suspension.ID, nil, suspension)
+	s.relay.Notify()
+
+	log.Infof("user '%s' suspended until %s after %d no-shows", userID, suspension.Until, suspension.NoShows)
+
+	return nil
+}
+
+// filterActive returns the suspensions active at the given time
+func filterActive(suspensions []*datamodel.Suspension, at time.Time) []*datamodel.Suspension {
+	var active []*datamodel.Suspension
+	for _, suspension := range suspensions {
+		if suspension.IsActive(at) {
+			active = append(active, suspension)
+		}
+	}
+
+	return active
+}
@@ -0,0 +1,484 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/think-free/ABCFitness-challenge/internal/datamodel"
+	"github.com/think-free/ABCFitness-challenge/internal/errors"
+	"github.com/think-free/ABCFitness-challenge/internal/policy"
+	"github.com/think-free/ABCFitness-challenge/internal/webhook"
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+const (
+	// webhookBatch is the number of due deliveries sent by a pass of the dispatcher
+	webhookBatch = 100
+	// webhookWorkers is the number of deliveries sent at the same time
+	webhookWorkers = 8
+	// webhookTimeout is the time a webhook has to answer a delivery
+	webhookTimeout = 10 * time.Second
+)
+
+// CreateWebhook subscribes the url of the request to the events of its types, the webhook is returned with its secret
+func (s *Service) CreateWebhook(ctx context.Context, r *datamodel.CreateWebhookRequest) (*datamodel.Webhook, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.webhook.url", r.URL)
+	log.SetTag("req.webhook.events", r.Events)
+
+	err := s.authorize(ctx, policy.ActionManageWebhooks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := datamodel.NewWebhook(ctx, r, s.now())
+	if err != nil {
+		log.Errorf("error creating webhook : %v", err)
+		return nil, err
+	}
+
+	err = s.checkWebhookURL(ctx, webhook.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.SaveWebhook(ctx, webhook)
+	if err != nil {
+		log.Errorf("error saving webhook : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionCreate, datamodel.AuditEntityWebhook, webhook.ID, nil, webhook.Redacted())
+
+	log.Debugf("webhook '%s' created", webhook.ID)
+
+	return webhook, nil
+}
+
+// ListWebhooks returns the webhooks without their secret
+func (s *Service) ListWebhooks(ctx context.Context, r *datamodel.ListRequest) ([]*datamodel.Webhook, error) {
+	log := logging.Logger(ctx)
+
+	err := s.authorize(ctx, policy.ActionManageWebhooks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	webhooks, err := s.db.ListWebhooks(ctx, r.Offset, r.Count)
+	if err != nil {
+		log.Errorf("error listing webhooks : %v", err)
+		return nil, err
+	}
+
+	redacted := make([]*datamodel.Webhook, 0, len(webhooks))
+	for _, w := range webhooks {
+		redacted = append(redacted, w.Redacted())
+	}
+
+	return redacted, nil
+}
+
+// GetWebhook returns the webhook without its secret
+func (s *Service) GetWebhook(ctx context.Context, id string) (*datamodel.Webhook, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.webhook.id", id)
+
+	err := s.authorize(ctx, policy.ActionManageWebhooks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := s.db.GetWebhookByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting webhook : %v", err)
+		return nil, err
+	}
+
+	return webhook.Redacted(), nil
+}
+
+// UpdateWebhook changes the url, the events or the secret of the webhook, the secret is only returned if it was replaced
+func (s *Service) UpdateWebhook(ctx context.Context, id string, r *datamodel.UpdateWebhookRequest) (*datamodel.Webhook, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.webhook.id", id)
+
+	err := s.authorize(ctx, policy.ActionManageWebhooks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := s.db.GetWebhookByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting webhook : %v", err)
+		return nil, err
+	}
+
+	err = datamodel.CheckVersion(ctx, webhook.Version)
+	if err != nil {
+		log.Errorf("webhook '%s' changed : %v", webhook.ID, err)
+		return nil, err
+	}
+
+	updated, err := webhook.Update(r)
+	if err != nil {
+		log.Errorf("error updating webhook : %v", err)
+		return nil, err
+	}
+
+	err = s.checkWebhookURL(ctx, updated.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.db.UpdateWebhook(ctx, updated)
+	if err != nil {
+		log.Errorf("error saving webhook : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityWebhook, webhook.ID, webhook.Redacted(), updated.Redacted())
+
+	log.Debugf("webhook '%s' updated", webhook.ID)
+
+	if r.Secret != nil {
+		return updated, nil
+	}
+	return updated.Redacted(), nil
+}
+
+// DeleteWebhook removes the webhook, its pending deliveries go to the dead-letter list
+func (s *Service) DeleteWebhook(ctx context.Context, id string) (*datamodel.Webhook, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.webhook.id", id)
+
+	err := s.authorize(ctx, policy.ActionManageWebhooks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	webhook, err := s.db.GetWebhookByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting webhook : %v", err)
+		return nil, err
+	}
+
+	err = datamodel.CheckVersion(ctx, webhook.Version)
+	if err != nil {
+		log.Errorf("webhook '%s' changed : %v", webhook.ID, err)
+		return nil, err
+	}
+
+	err = s.db.DeleteWebhook(ctx, id)
+	if err != nil {
+		log.Errorf("error deleting webhook : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionDelete, datamodel.AuditEntityWebhook, webhook.ID, webhook.Redacted(), nil)
+
+	log.Debugf("webhook '%s' deleted", webhook.ID)
+
+	return webhook.Redacted(), nil
+}
+
+// ListWebhookDeliveries returns the deliveries matching the filter in the order they were created
+func (s *Service) ListWebhookDeliveries(ctx context.Context, f *datamodel.WebhookDeliveryFilter) ([]*datamodel.WebhookDelivery, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.deliveries.webhook", f.WebhookID)
+	log.SetTag("req.deliveries.status", f.Status)
+
+	err := s.authorize(ctx, policy.ActionManageWebhooks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.WebhookID != "" {
+		_, err = s.db.GetWebhookByID(ctx, f.WebhookID)
+		if err != nil {
+			log.Errorf("error getting webhook : %v", err)
+			return nil, err
+		}
+	}
+
+	deliveries, err := s.db.ListWebhookDeliveries(ctx, f)
+	if err != nil {
+		log.Errorf("error listing deliveries : %v", err)
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+// RetryWebhookDelivery moves a delivery of the dead-letter list back to the pending ones with new attempts
+func (s *Service) RetryWebhookDelivery(ctx context.Context, id string) (*datamodel.WebhookDelivery, error) {
+	log := logging.Logger(ctx)
+
+	log.SetTag("req.delivery.id", id)
+
+	err := s.authorize(ctx, policy.ActionManageWebhooks, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	delivery, err := s.db.GetWebhookDeliveryByID(ctx, id)
+	if err != nil {
+		log.Errorf("error getting delivery : %v", err)
+		return nil, err
+	}
+
+	if delivery.Status != datamodel.WebhookDeliveryDead {
+		log.Errorf("delivery '%s' is %s", delivery.ID, delivery.Status)
+		return nil, errors.ErrorInvalidState()
+	}
+
+	now := s.now()
+	retried := *delivery
+	retried.Status = datamodel.WebhookDeliveryPending
+	retried.Attempts = 0
+	retried.NextAttemptAt = &now
+
+	err = s.db.UpdateWebhookDelivery(ctx, &retried)
+	if err != nil {
+		log.Errorf("error saving delivery : %v", err)
+		return nil, err
+	}
+
+	s.record(ctx, datamodel.AuditActionUpdate, datamodel.AuditEntityDelivery, delivery.ID, delivery, &retried)
+
+	s.notifyWebhooks()
+
+	log.Debugf("delivery '%s' retried", delivery.ID)
+
+	return &retried, nil
+}
+
+// DeliverWebhooks sends the due deliveries once, it returns the number of deliveries accepted by the webhooks
+func (s *Service) DeliverWebhooks(ctx context.Context) (int, error) {
+	log := logging.Logger(ctx)
+
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+
+	now := s.now()
+	due, err := s.db.ListDueWebhookDeliveries(ctx, now, webhookBatch)
+	if err != nil {
+		log.Errorf("error listing due deliveries : %v", err)
+		return 0, err
+	}
+
+	var delivered int64
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, webhookWorkers)
+
+	for _, d := range due {
+		wg.Add(1)
+		workers <- struct{}{}
+
+		go func(d *datamodel.WebhookDelivery) {
+			defer wg.Done()
+			defer func() { <-workers }()
+
+			if s.deliverWebhook(ctx, d, now) {
+				atomic.AddInt64(&delivered, 1)
+			}
+		}(d)
+	}
+
+	wg.Wait()
+
+	// There may be more due deliveries than a pass sends
+	if len(due) == webhookBatch {
+		s.notifyWebhooks()
+	}
+
+	return int(delivered), nil
+}
+
+// RunWebhookDispatcher sends the deliveries as soon as they are created and the retries when they are due, checked
+// every interval, until the context is done
+func (s *Service) RunWebhookDispatcher(ctx context.Context, interval time.Duration) {
+	log := logging.Logger(ctx)
+
+	log.Infof("webhook dispatcher running every %s", interval)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Infof("webhook dispatcher stopped")
+			return
+		case <-ticker.C:
+		case <-s.webhookNotify:
+		}
+
+		_, err := s.DeliverWebhooks(ctx)
+		if err != nil {
+			log.Errorf("error delivering webhooks : %v", err)
+		}
+	}
+}
+
+// enqueueWebhooks creates the deliveries of the event to the webhooks subscribed to its type, it is the publisher of
+// the webhooks. A delivery already created for a republished event is kept as it is.
+func (s *Service) enqueueWebhooks(ctx context.Context, e *datamodel.Event) error {
+	webhooks, err := s.db.ListWebhooks(ctx, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	// The erasure scrubs the deliveries under the same lock, so a delivery is either saved redacted or saved before
+	// the scrub
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+
+	// An event of a user published again after its erasure, the relay retrying it, doesn't send its personal data
+	if e.HasUser() {
+		user, err := s.db.GetUserByID(ctx, e.EntityID)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		if user != nil && user.ErasedAt != nil {
+			e, err = e.Redacted()
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	now := s.now()
+	for _, w := range webhooks {
+		if !w.Subscribes(e.Type) {
+			continue
+		}
+
+		err = s.db.SaveWebhookDelivery(ctx, datamodel.NewWebhookDelivery(w, e, now))
+		if err != nil && !errors.IsAlreadyExists(err) {
+			return err
+		}
+	}
+
+	s.notifyWebhooks()
+
+	return nil
+}
+
+// deliverWebhook sends the delivery and saves the outcome of the attempt, it returns true if the webhook accepted it
+func (s *Service) deliverWebhook(ctx context.Context, d *datamodel.WebhookDelivery, now time.Time) bool {
+	log := logging.Logger(ctx)
+
+	attempt := *d
+	attempt.Attempts++
+	attempt.LastAttemptAt = &now
+	attempt.NextAttemptAt = nil
+
+	w, err := s.db.GetWebhookByID(ctx, d.WebhookID)
+	switch {
+	case err != nil && errors.IsNotFound(err):
+		attempt.Status = datamodel.WebhookDeliveryDead
+		attempt.ResponseCode = 0
+		attempt.Error = "webhook deleted"
+	case err != nil:
+		log.Errorf("error getting webhook '%s' of delivery '%s' : %v", d.WebhookID, d.ID, err)
+		return false
+	default:
+		attempt.URL = w.URL
+		attempt.ResponseCode, err = s.webhookSender.Send(ctx, w, d, now)
+		if err == nil {
+			attempt.Status = datamodel.WebhookDeliveryDelivered
+			attempt.Error = ""
+		} else if attempt.Attempts >= s.webhookPolicy.MaxAttempts {
+			attempt.Status = datamodel.WebhookDeliveryDead
+			attempt.Error = err.Error()
+		} else {
+			next := now.Add(s.webhookPolicy.Delay(attempt.Attempts))
+			attempt.NextAttemptAt = &next
+			attempt.Error = err.Error()
+		}
+	}
+
+	err = s.db.UpdateWebhookDelivery(ctx, &attempt)
+	if err != nil {
+		log.Errorf("error saving delivery '%s' : %v", d.ID, err)
+		return false
+	}
+
+	switch attempt.Status {
+	case datamodel.WebhookDeliveryDelivered:
+		log.Debugf("event '%s' delivered to webhook '%s'", d.Event.ID, d.WebhookID)
+		return true
+	case datamodel.WebhookDeliveryDead:
+		log.Warnf("delivery '%s' to webhook '%s' dead after %d attempts : %s", d.ID, d.WebhookID, attempt.Attempts, attempt.Error)
+	default:
+		log.Infof("delivery '%s' to webhook '%s' failed, retrying at %s : %s", d.ID, d.WebhookID, attempt.NextAttemptAt, attempt.Error)
+	}
+
+	return false
+}
+
+// scrubWebhookDeliveries removes the personal data of the erased user from the events of its deliveries, they are
+// kept for the retries and the dead-letter list
+func (s *Service) scrubWebhookDeliveries(ctx context.Context, userID string) error {
+	// A pass of the dispatcher saves the deliveries it sends with the event it read
+	s.webhooksMu.Lock()
+	defer s.webhooksMu.Unlock()
+
+	deliveries, err := s.db.ListWebhookDeliveries(ctx, &datamodel.WebhookDeliveryFilter{EntityID: userID})
+	if err != nil {
+		return err
+	}
+
+	for _, d := range deliveries {
+		if !d.Event.HasUser() {
+			continue
+		}
+
+		event, err := d.Event.Redacted()
+		if err != nil {
+			return err
+		}
+
+		scrubbed := *d
+		scrubbed.Event = event
+		err = s.db.UpdateWebhookDelivery(ctx, &scrubbed)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkWebhookURL rejects the urls of the webhooks that are not on a public address, the sender checks the address
+// again when it connects since the name of the host can resolve to another one later
+func (s *Service) checkWebhookURL(ctx context.Context, url string) error {
+	log := logging.Logger(ctx)
+
+	if s.webhookPrivate {
+		return nil
+	}
+
+	err := webhook.CheckURL(ctx, url)
+	if err != nil {
+		log.Errorf("webhook url '%s' rejected : %v", url, err)
+		return errors.ErrorValidationError()
+	}
+
+	return nil
+}
+
+// notifyWebhooks wakes up the running dispatcher without waiting for the next interval
+func (s *Service) notifyWebhooks() {
+	select {
+	case s.webhookNotify <- struct{}{}:
+	default:
+	}
+}
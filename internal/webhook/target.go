@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+)
+
+// nonPublic are the ranges a partner can't be reached on that IsPublic doesn't find with the netip methods
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsPublic returns true if the address is a public unicast one, the loopback, private, link-local (like the cloud
+// metadata at 169.254.169.254), shared and reserved addresses are the ones of the network of the server
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() || !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+
+	for _, p := range nonPublic {
+		if p.Contains(addr) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// CheckURL returns an error if the host of the url is not public or resolves to an address that is not
+func CheckURL(ctx context.Context, rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+
+	host := u.Hostname()
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("host '%s' is not public", host)
+	}
+
+	if addr, err := netip.ParseAddr(host); err == nil {
+		if !IsPublic(addr) {
+			return fmt.Errorf("address %s is not public", addr)
+		}
+		return nil
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return err
+	}
+
+	for _, addr := range addrs {
+		if !IsPublic(addr) {
+			return fmt.Errorf("host '%s' resolves to %s that is not public", host, addr)
+		}
+	}
+
+	return nil
+}
+
+// dialPublic is the Control of the dialer of the sender, it runs after the resolution of the host so a name resolving
+// to another address than when the webhook was checked can't reach the network of the server
+func dialPublic(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+
+	if !IsPublic(addrPort.Addr()) {
+		return fmt.Errorf("address %s is not public", addrPort.Addr())
+	}
+
+	return nil
+}
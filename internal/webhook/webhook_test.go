@@ -0,0 +1,58 @@
+package webhook_test
+
+import (
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/think-free/ABCFitness-challenge/internal/webhook"
+)
+
+func TestSignature(t *testing.T) {
+	at := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"id":"1","type":"booking.created"}`)
+
+	sig := webhook.Sign("secret", at, body)
+	assert.Regexp(t, `^t=1696161600,v1=[0-9a-f]{64}$`, sig)
+
+	assert.NoError(t, webhook.Verify("secret", sig, body, at.Add(time.Minute), 5*time.Minute))
+	assert.EqualError(t, webhook.Verify("other", sig, body, at, 5*time.Minute), "invalid signature")
+	assert.EqualError(t, webhook.Verify("secret", sig, []byte(`{"id":"2"}`), at, 5*time.Minute), "invalid signature")
+	assert.EqualError(t, webhook.Verify("secret", sig, body, at.Add(time.Hour), 5*time.Minute), "signature expired")
+	assert.EqualError(t, webhook.Verify("secret", "v1=abc", body, at, 5*time.Minute), "malformed signature")
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := &webhook.RetryPolicy{MaxAttempts: 10, Backoff: 30 * time.Second, MaxBackoff: 10 * time.Minute}
+
+	assert.Equal(t, 30*time.Second, p.Delay(1))
+	assert.Equal(t, time.Minute, p.Delay(2))
+	assert.Equal(t, 2*time.Minute, p.Delay(3))
+	assert.Equal(t, 8*time.Minute, p.Delay(5))
+	assert.Equal(t, 10*time.Minute, p.Delay(6))
+	assert.Equal(t, 10*time.Minute, p.Delay(100))
+}
+
+func TestIsPublic(t *testing.T) {
+	for addr, public := range map[string]bool{
+		"203.0.113.10":    true,
+		"8.8.8.8":         true,
+		"2001:4860::8888": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"172.16.0.1":      false,
+		"192.168.1.1":     false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"0.0.0.0":         false,
+		"224.0.0.1":       false,
+		"::1":             false,
+		"fe80::1":         false,
+		"fd00::1":         false,
+		"::ffff:10.0.0.1": false,
+	} {
+		assert.Equal(t, public, webhook.IsPublic(netip.MustParseAddr(addr)), addr)
+	}
+}
@@ -0,0 +1,132 @@
+// Package ical writes calendars in the iCalendar format (RFC 5545) read by the calendar apps
+package ical
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	ContentType = "text/calendar; charset=utf-8"
+
+	dateTimeFormat = "20060102T150405Z"
+	maxLineLength  = 75
+)
+
+// Calendar is a named list of events
+type Calendar struct {
+	ProdID string
+	Name   string
+	Events []*Event
+}
+
+// Event is a calendar event, it repeats every day until RepeatDailyUntil if set
+type Event struct {
+	UID              string
+	Stamp            time.Time
+	Start            time.Time
+	End              time.Time
+	Summary          string
+	Location         string
+	Description      string
+	Status           string
+	RepeatDailyUntil *time.Time
+}
+
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusCancelled = "CANCELLED"
+)
+
+// Write encodes the calendar, the times are written in UTC
+func (c *Calendar) Write(w io.Writer) error {
+	cw := &writer{w: w}
+
+	cw.line("BEGIN", "VCALENDAR")
+	cw.line("VERSION", "2.0")
+	cw.line("PRODID", c.ProdID)
+	cw.line("CALSCALE", "GREGORIAN")
+	cw.line("METHOD", "PUBLISH")
+	if c.Name != "" {
+		cw.line("X-WR-CALNAME", escape(c.Name))
+	}
+
+	for _, e := range c.Events {
+		cw.line("BEGIN", "VEVENT")
+		cw.line("UID", e.UID)
+		cw.line("DTSTAMP", formatTime(e.Stamp))
+		cw.line("DTSTART", formatTime(e.Start))
+		cw.line("DTEND", formatTime(e.End))
+		if e.RepeatDailyUntil != nil {
+			cw.line("RRULE", "FREQ=DAILY;UNTIL="+formatTime(*e.RepeatDailyUntil))
+		}
+		cw.line("SUMMARY", escape(e.Summary))
+		if e.Location != "" {
+			cw.line("LOCATION", escape(e.Location))
+		}
+		if e.Description != "" {
+			cw.line("DESCRIPTION", escape(e.Description))
+		}
+		if e.Status != "" {
+			cw.line("STATUS", e.Status)
+		}
+		cw.line("END", "VEVENT")
+	}
+
+	cw.line("END", "VCALENDAR")
+
+	return cw.err
+}
+
+// writer writes the content lines ended by CRLF and folded at 75 octets, it keeps the first error
+type writer struct {
+	w   io.Writer
+	err error
+}
+
+func (cw *writer) line(name, value string) {
+	if cw.err != nil {
+		return
+	}
+
+	_, cw.err = io.WriteString(cw.w, fold(name+":"+value)+"\r\n")
+}
+
+// fold splits the line in lines of at most 75 octets, the next lines start with a space. A line is never split inside
+// a multi-byte character
+func fold(line string) string {
+	if len(line) <= maxLineLength {
+		return line
+	}
+
+	var b strings.Builder
+	limit := maxLineLength
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !isCharStart(line[cut]) {
+			cut--
+		}
+		b.WriteString(line[:cut])
+		b.WriteString("\r\n ")
+		line = line[cut:]
+		// the leading space of the next lines counts in their length
+		limit = maxLineLength - 1
+	}
+	b.WriteString(line)
+
+	return b.String()
+}
+
+func isCharStart(b byte) bool {
+	return b&0xC0 != 0x80
+}
+
+// escape escapes the characters with a meaning in the text values
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`).Replace(s)
+}
+
+func formatTime(t time.Time) string {
+	return t.UTC().Format(dateTimeFormat)
+}
@@ -0,0 +1,51 @@
+package ical_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/think-free/ABCFitness-challenge/lib/ical"
+)
+
+func TestWrite(t *testing.T) {
+	until := time.Date(2023, 10, 31, 18, 0, 0, 0, time.UTC)
+	cal := &ical.Calendar{
+		ProdID: "-//test//EN",
+		Name:   "Yoga",
+		Events: []*ical.Event{
+			{
+				UID:              "1@test",
+				Stamp:            time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC),
+				Start:            time.Date(2023, 10, 1, 18, 0, 0, 0, time.UTC),
+				End:              time.Date(2023, 10, 1, 19, 0, 0, 0, time.UTC),
+				Summary:          "Yoga, stretching; relax",
+				Location:         "Studio 1",
+				Description:      strings.Repeat("é", 60),
+				Status:           ical.StatusConfirmed,
+				RepeatDailyUntil: &until,
+			},
+		},
+	}
+
+	var b bytes.Buffer
+	assert.NoError(t, cal.Write(&b))
+	out := b.String()
+
+	assert.True(t, strings.HasPrefix(out, "BEGIN:VCALENDAR\r\n"))
+	assert.True(t, strings.HasSuffix(out, "END:VCALENDAR\r\n"))
+	assert.Contains(t, out, "DTSTART:20231001T180000Z\r\n")
+	assert.Contains(t, out, "RRULE:FREQ=DAILY;UNTIL=20231031T180000Z\r\n")
+	assert.Contains(t, out, `SUMMARY:Yoga\, stretching\; relax`+"\r\n")
+
+	// The long lines are folded at 75 octets without splitting the characters
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n") {
+		assert.LessOrEqual(t, len(line), 75)
+		assert.True(t, strings.ToValidUTF8(line, "?") == line)
+	}
+	unfolded := strings.ReplaceAll(out, "\r\n ", "")
+	assert.Contains(t, unfolded, "DESCRIPTION:"+strings.Repeat("é", 60)+"\r\n")
+}
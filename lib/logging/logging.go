@@ -2,6 +2,7 @@
 	This is a simple logging helper that use zap and permit
 	- to add tags to the log
 	- to save the logger in the context to allow the tags to be added in the next log
+	- to redact or hash the tags classified as personal data
 	(C)2022 - Christophe Meurice (meumeu1402@gmail.com)
 */
 
@@ -66,10 +67,22 @@ func Logger(ctx context.Context) *Lg {
 	}
 }
 
+// SetTag adds a tag to the next logs, the tags classified as personal data are redacted or hashed depending on the pii mode
 func (l *Lg) SetTag(key string, value interface{}) {
+	if IsPII(key) {
+		value = protect(value)
+	}
 	l.SugaredLogger = l.With(key, value)
 }
 
+// UseLogger replaces the default logger and returns the previous one, used by tests to capture the logs and restore
+// the logger once done
+func UseLogger(l *zap.Logger) *zap.Logger {
+	previous := defaultLogger
+	defaultLogger = l
+	return previous
+}
+
 func getZapLevelFromString(level string) zapcore.Level {
 	switch level {
 	case "debug":
@@ -0,0 +1,78 @@
+package logging_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/think-free/ABCFitness-challenge/lib/logging"
+)
+
+func TestPII(t *testing.T) {
+	ctx := context.Background()
+
+	require.True(t, logging.IsPII("req.user.email"))
+	require.True(t, logging.IsPII("booking.user.name"))
+	require.False(t, logging.IsPII("class.name"))
+	require.False(t, logging.IsPII("user.id"))
+	require.False(t, logging.IsPII("superuser.email"))
+
+	logging.ClassifyPII("user.address")
+	require.True(t, logging.IsPII("req.user.address"))
+
+	tests := []struct {
+		mode  string
+		check func(t *testing.T, v interface{})
+	}{
+		{"redact", func(t *testing.T, v interface{}) { require.Equal(t, logging.Redacted, v) }},
+		{"hash", func(t *testing.T, v interface{}) { require.Contains(t, v, "sha256:") }},
+		{"plain", func(t *testing.T, v interface{}) { require.Equal(t, "elon.musk@example.com", v) }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			require.NoError(t, logging.ConfigurePII(tt.mode, "salt"))
+			t.Cleanup(func() { logging.ConfigurePII(string(logging.PIIRedact), "") })
+
+			core, logs := observer.New(zapcore.DebugLevel)
+			previous := logging.UseLogger(zap.New(core))
+			t.Cleanup(func() { logging.UseLogger(previous) })
+
+			log := logging.Logger(logging.ContextWithLogger(ctx))
+			log.SetTag("req.user.email", "elon.musk@example.com")
+			log.SetTag("class.name", "Yoga")
+			log.Debug("tagged")
+
+			fields := logs.All()[0].ContextMap()
+			tt.check(t, fields["req.user.email"])
+			require.Equal(t, "Yoga", fields["class.name"])
+		})
+	}
+
+	// The hash is stable for a same salt, allowing to correlate the logs
+	require.NoError(t, logging.ConfigurePII("hash", "salt"))
+	t.Cleanup(func() { logging.ConfigurePII(string(logging.PIIRedact), "") })
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	previous := logging.UseLogger(zap.New(core))
+	t.Cleanup(func() { logging.UseLogger(previous) })
+	for i := 0; i < 2; i++ {
+		log := logging.Logger(ctx)
+		log.SetTag("user.email", "elon.musk@example.com")
+		log.Debug("tagged")
+	}
+	require.Equal(t, logs.All()[0].ContextMap()["user.email"], logs.All()[1].ContextMap()["user.email"])
+
+	require.Error(t, logging.ConfigurePII("unknown", ""))
+
+	// The hash without salt is refused and the mode is left as it was
+	require.Error(t, logging.ConfigurePII("hash", ""))
+	log := logging.Logger(ctx)
+	log.SetTag("user.email", "elon.musk@example.com")
+	log.Debug("tagged")
+	require.Equal(t, logs.All()[0].ContextMap()["user.email"], logs.All()[2].ContextMap()["user.email"])
+}
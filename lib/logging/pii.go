@@ -0,0 +1,95 @@
+package logging
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+type PIIMode string
+
+const (
+	// PIIPlain logs the personal data as is, only for local development
+	PIIPlain PIIMode = "plain"
+	// PIIRedact replaces the personal data with a placeholder
+	PIIRedact PIIMode = "redact"
+	// PIIHash replaces the personal data with a salted hash, allowing to correlate the logs of a same person
+	PIIHash PIIMode = "hash"
+
+	Redacted = "[REDACTED]"
+)
+
+var pii = struct {
+	sync.RWMutex
+	mode     PIIMode
+	salt     []byte
+	suffixes []string
+}{
+	mode:     PIIRedact,
+	suffixes: []string{"user.name", "user.surname", "user.email", "user.phone"},
+}
+
+// ConfigurePII sets how the tags classified as personal data are logged, the hash needs a salt as the hashes of the
+// few possible values of a phone or a known email could be reversed without it
+func ConfigurePII(mode string, salt string) error {
+	m := PIIMode(mode)
+	switch m {
+	case PIIPlain, PIIRedact:
+	case PIIHash:
+		if salt == "" {
+			return fmt.Errorf("pii mode '%s' requires a salt", mode)
+		}
+	default:
+		return fmt.Errorf("unknown pii mode '%s'", mode)
+	}
+
+	pii.Lock()
+	defer pii.Unlock()
+
+	pii.mode = m
+	pii.salt = []byte(salt)
+
+	return nil
+}
+
+// ClassifyPII marks the tags whose key ends with one of the given suffixes as personal data
+func ClassifyPII(suffixes ...string) {
+	pii.Lock()
+	defer pii.Unlock()
+
+	pii.suffixes = append(pii.suffixes, suffixes...)
+}
+
+// IsPII returns true if the tag key is classified as personal data
+func IsPII(key string) bool {
+	pii.RLock()
+	defer pii.RUnlock()
+
+	for _, suffix := range pii.suffixes {
+		if key == suffix || strings.HasSuffix(key, "."+suffix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// protect returns the value as it must be logged with the configured mode
+func protect(value interface{}) interface{} {
+	pii.RLock()
+	defer pii.RUnlock()
+
+	switch pii.mode {
+	case PIIPlain:
+		return value
+	case PIIHash:
+		mac := hmac.New(sha256.New, pii.salt)
+		fmt.Fprint(mac, value)
+		return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+	default:
+		return Redacted
+	}
+}